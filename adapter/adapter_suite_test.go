@@ -6,6 +6,8 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
+	"github.com/pivotal-cf-experimental/redis-example-service-adapter/adapter"
 
 	"testing"
 )
@@ -20,3 +22,18 @@ func getFixturePath(filename string) string {
 	Expect(err).ToNot(HaveOccurred())
 	return filepath.Join(cwd, "fixtures", filename)
 }
+
+func operatorMessage(err error) string {
+	adapterErr, ok := err.(*adapter.Error)
+	if !ok {
+		return ""
+	}
+	return adapterErr.OperatorMessage
+}
+
+func matchAdapterError(userMessage interface{}, operatorMessageMatcher types.GomegaMatcher) types.GomegaMatcher {
+	return And(
+		MatchError(userMessage),
+		WithTransform(operatorMessage, operatorMessageMatcher),
+	)
+}
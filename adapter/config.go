@@ -3,6 +3,7 @@ package adapter
 import (
 	"io/ioutil"
 	"log"
+	"os"
 
 	"github.com/pkg/errors"
 	yaml "gopkg.in/yaml.v2"
@@ -12,22 +13,166 @@ type Config struct {
 	RedisInstanceGroupName         string `yaml:"redis_instance_group_name"`
 	IgnoreODBManagedSecretOnUpdate bool   `yaml:"ignore_odb_managed_secret_on_update"`
 	SecureManifestsEnabled         bool   `yaml:"secure_manifests_enabled"`
+	PersistencePropertyKey         string `yaml:"persistence_property_key"`
+}
+
+// persistencePropertyKey lets plans that predate the adapter name the
+// persistence toggle differently, such as enable_persistence.
+func (c Config) persistencePropertyKey() string {
+	if c.PersistencePropertyKey == "" {
+		return RedisServerPersistencePropertyKey
+	}
+	return c.PersistencePropertyKey
+}
+
+const AdapterConfigPathEnvVar = "REDIS_ADAPTER_CONFIG_PATH"
+
+// AdapterConfig holds operator defaults that apply when neither the plan nor
+// the arbitrary parameters set a value. Zero fields keep the built-in default.
+type AdapterConfig struct {
+	MaxClients     int                 `yaml:"maxclients"`
+	PasswordLength int                 `yaml:"password_length"`
+	Port           int                 `yaml:"port"`
+	Update         UpdateDefaultConfig `yaml:"update"`
+	// AllowedVMExtensions restricts the vm_extensions plans may use. Without
+	// the key any extension is allowed; an empty list allows none.
+	AllowedVMExtensions []string `yaml:"allowed_vm_extensions"`
+	// DefaultNetworkName is used for redis-server when the plan names no
+	// network.
+	DefaultNetworkName string `yaml:"default_network_name"`
+}
+
+// UpdateDefaultConfig is the update block for plans without one. Canaries is
+// a pointer as 0, deploying without a canary, is a legal value.
+type UpdateDefaultConfig struct {
+	Canaries        *int   `yaml:"canaries"`
+	MaxInFlight     int    `yaml:"max_in_flight"`
+	CanaryWatchTime string `yaml:"canary_watch_time"`
+	UpdateWatchTime string `yaml:"update_watch_time"`
+}
+
+func DefaultAdapterConfig() AdapterConfig {
+	return AdapterConfig{
+		MaxClients:     10000,
+		PasswordLength: 20,
+		Port:           RedisServerPort,
+		Update: UpdateDefaultConfig{
+			Canaries:        IntPointer(4),
+			MaxInFlight:     4,
+			CanaryWatchTime: "30000-240000",
+			UpdateWatchTime: "30000-240000",
+		},
+	}
+}
+
+func (c AdapterConfig) withDefaults() AdapterConfig {
+	defaults := DefaultAdapterConfig()
+	if c.MaxClients == 0 {
+		c.MaxClients = defaults.MaxClients
+	}
+	if c.PasswordLength == 0 {
+		c.PasswordLength = defaults.PasswordLength
+	}
+	if c.Port == 0 {
+		c.Port = defaults.Port
+	}
+	if c.Update.Canaries == nil {
+		c.Update.Canaries = defaults.Update.Canaries
+	}
+	if c.Update.MaxInFlight == 0 {
+		c.Update.MaxInFlight = defaults.Update.MaxInFlight
+	}
+	if c.Update.CanaryWatchTime == "" {
+		c.Update.CanaryWatchTime = defaults.Update.CanaryWatchTime
+	}
+	if c.Update.UpdateWatchTime == "" {
+		c.Update.UpdateWatchTime = defaults.Update.UpdateWatchTime
+	}
+	return c
+}
+
+func IntPointer(i int) *int {
+	return &i
+}
+
+func (c AdapterConfig) validate() error {
+	var errs []error
+	type count struct {
+		key   string
+		value int
+	}
+	counts := []count{
+		{"maxclients", c.MaxClients},
+		{"password_length", c.PasswordLength},
+		{"port", c.Port},
+		{"update.max_in_flight", c.Update.MaxInFlight},
+	}
+	if c.Update.Canaries != nil {
+		counts = append(counts, count{"update.canaries", *c.Update.Canaries})
+	}
+	for _, count := range counts {
+		if count.value < 0 {
+			errs = append(errs, errors.Errorf("'%s' must not be negative, got %d", count.key, count.value))
+		}
+	}
+	if c.Port > 65535 {
+		errs = append(errs, errors.Errorf("'port' must be at most 65535, got %d", c.Port))
+	}
+	if c.Update.CanaryWatchTime != "" && !watchTimeRegexp.MatchString(c.Update.CanaryWatchTime) {
+		errs = append(errs, errors.Errorf("'update.canary_watch_time' must be a min-max range in milliseconds, got %q", c.Update.CanaryWatchTime))
+	}
+	if c.Update.UpdateWatchTime != "" && !watchTimeRegexp.MatchString(c.Update.UpdateWatchTime) {
+		errs = append(errs, errors.Errorf("'update.update_watch_time' must be a min-max range in milliseconds, got %q", c.Update.UpdateWatchTime))
+	}
+	return combineErrors(errs)
+}
+
+// LoadAdapterConfig reads operator defaults from the file named by
+// REDIS_ADAPTER_CONFIG_PATH. Without the variable the built-in defaults apply.
+func LoadAdapterConfig(logger *log.Logger) (AdapterConfig, error) {
+	path := os.Getenv(AdapterConfigPathEnvVar)
+	if path == "" {
+		return DefaultAdapterConfig(), nil
+	}
+	events := newEventLogger(logger, "", "", "load-config", nil)
+
+	ymlFile, err := ioutil.ReadFile(path)
+	if err != nil {
+		wrappedErr := errors.Wrap(err, "Error, could not read adapter config file")
+		events.Error(wrappedErr.Error())
+		return AdapterConfig{}, wrappedErr
+	}
+
+	config := AdapterConfig{}
+	if err := yaml.UnmarshalStrict(ymlFile, &config); err != nil {
+		wrappedErr := errors.Wrap(err, "Error, could not parse adapter config YAML")
+		events.Error(wrappedErr.Error())
+		return AdapterConfig{}, wrappedErr
+	}
+
+	if err := config.validate(); err != nil {
+		wrappedErr := errors.Errorf("Error, invalid adapter config in %s: %s", path, asAdapterError(err).OperatorMessage)
+		events.Error(wrappedErr.Error())
+		return AdapterConfig{}, wrappedErr
+	}
+	return config.withDefaults(), nil
 }
 
 func LoadConfig(path string, logger *log.Logger) (Config, error) {
 	config := Config{}
+	events := newEventLogger(logger, "", "", "load-config", nil)
 
 	ymlFile, err := ioutil.ReadFile(path)
 	if err != nil {
 		wrappedErr := errors.Wrap(err, "Error, could not read config file")
-		logger.Println(wrappedErr.Error())
+		events.Error(wrappedErr.Error())
 		return Config{}, wrappedErr
 	}
 
 	err = yaml.Unmarshal(ymlFile, &config)
 	if err != nil {
 		wrappedErr := errors.Wrap(err, "Error, could not parse config YAML")
-		logger.Println(wrappedErr.Error())
+		events.Error(wrappedErr.Error())
 		return Config{}, wrappedErr
 	}
 	return config, nil
@@ -3,6 +3,7 @@ package adapter_test
 import (
 	"io"
 	"log"
+	"os"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -47,4 +48,82 @@ var _ = Describe("Config", func() {
 		Expect(err).To(MatchError(ContainSubstring("Error, could not parse config YAML")))
 		Expect(stderr).To(gbytes.Say("Error, could not parse config YAML"))
 	})
+
+	Describe("adapter config", func() {
+		loadAdapterConfig := func(fixture string) (adapter.AdapterConfig, error) {
+			os.Setenv(adapter.AdapterConfigPathEnvVar, getFixturePath(fixture))
+			defer os.Unsetenv(adapter.AdapterConfigPathEnvVar)
+			return adapter.LoadAdapterConfig(stderrLogger)
+		}
+
+		It("uses the built-in defaults when the path is not set", func() {
+			config, err := adapter.LoadAdapterConfig(stderrLogger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config).To(Equal(adapter.DefaultAdapterConfig()))
+			Expect(config.MaxClients).To(Equal(10000))
+			Expect(config.PasswordLength).To(Equal(20))
+			Expect(config.Port).To(Equal(adapter.RedisServerPort))
+		})
+
+		It("loads operator defaults from the file", func() {
+			config, err := loadAdapterConfig("adapter-config.yml")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config).To(Equal(adapter.AdapterConfig{
+				MaxClients:     20000,
+				PasswordLength: 32,
+				Port:           6380,
+				Update: adapter.UpdateDefaultConfig{
+					Canaries:        adapter.IntPointer(2),
+					MaxInFlight:     3,
+					CanaryWatchTime: "1000-60000",
+					UpdateWatchTime: "2000-90000",
+				},
+				AllowedVMExtensions: []string{"public_ip", "100GB_ephemeral_disk"},
+				DefaultNetworkName:  "redis-network",
+			}))
+		})
+
+		It("allows no vm extensions when the file lists none", func() {
+			config, err := loadAdapterConfig("adapter-config-no-vm-extensions.yml")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.AllowedVMExtensions).To(Equal([]string{}))
+		})
+
+		It("keeps the built-in defaults for values missing from the file", func() {
+			config, err := loadAdapterConfig("adapter-config-partial.yml")
+			Expect(err).NotTo(HaveOccurred())
+			expected := adapter.DefaultAdapterConfig()
+			expected.MaxClients = 500
+			Expect(config).To(Equal(expected))
+		})
+
+		It("keeps an explicit canaries: 0", func() {
+			config, err := loadAdapterConfig("adapter-config-no-canaries.yml")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Update.Canaries).To(Equal(adapter.IntPointer(0)))
+			Expect(config.Update.MaxInFlight).To(Equal(adapter.DefaultAdapterConfig().Update.MaxInFlight))
+		})
+
+		It("errors when the file does not exist", func() {
+			_, err := loadAdapterConfig("does-not-exist.yml")
+			Expect(err).To(MatchError(ContainSubstring("Error, could not read adapter config file")))
+			Expect(stderr).To(gbytes.Say("Error, could not read adapter config file"))
+		})
+
+		It("errors when the file has an unknown key", func() {
+			_, err := loadAdapterConfig("adapter-config-unknown-key.yml")
+			Expect(err).To(MatchError(ContainSubstring("Error, could not parse adapter config YAML")))
+			Expect(err).To(MatchError(ContainSubstring("max_clients")))
+		})
+
+		It("errors when the file has invalid values", func() {
+			_, err := loadAdapterConfig("adapter-config-invalid-values.yml")
+			Expect(err).To(MatchError(And(
+				ContainSubstring("Error, invalid adapter config in"),
+				ContainSubstring("'port' must be at most 65535, got 70000"),
+				ContainSubstring(`'update.canary_watch_time' must be a min-max range in milliseconds, got "30s"`),
+			)))
+			Expect(stderr).To(gbytes.Say("Error, invalid adapter config"))
+		})
+	})
 })
@@ -0,0 +1,19 @@
+package adapter
+
+import (
+	"github.com/pivotal-cf/on-demand-services-sdk/bosh"
+	"github.com/pivotal-cf/on-demand-services-sdk/serviceadapter"
+)
+
+type DashboardUrlGenerator struct{}
+
+// DashboardUrl serves the route recorded by GenerateManifest. Instances whose
+// manifest predates dashboard routes, or whose plan has no dashboard domain,
+// get an empty URL.
+func (d DashboardUrlGenerator) DashboardUrl(instanceID string, plan serviceadapter.Plan, manifest bosh.BoshManifest) (serviceadapter.DashboardUrl, error) {
+	route, _ := manifest.Tags[DashboardRouteTagKey].(string)
+	if route == "" {
+		return serviceadapter.DashboardUrl{}, nil
+	}
+	return serviceadapter.DashboardUrl{DashboardUrl: "https://" + route}, nil
+}
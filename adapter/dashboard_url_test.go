@@ -0,0 +1,75 @@
+package adapter_test
+
+import (
+	"log"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf-experimental/redis-example-service-adapter/adapter"
+	"github.com/pivotal-cf/on-demand-services-sdk/bosh"
+	"github.com/pivotal-cf/on-demand-services-sdk/serviceadapter"
+)
+
+var _ = Describe("DashboardUrlGenerator", func() {
+	var (
+		plan     serviceadapter.Plan
+		manifest bosh.BoshManifest
+	)
+
+	BeforeEach(func() {
+		plan = serviceadapter.Plan{Properties: serviceadapter.Properties{adapter.DashboardDomainPropertyKey: "apps.example.com"}}
+		manifest = bosh.BoshManifest{
+			Name: "service-instance_some-instance-id",
+			Tags: map[string]interface{}{
+				"product":                    "redis",
+				adapter.DashboardRouteTagKey: "redis-some-instance-id.apps.example.com",
+			},
+		}
+	})
+
+	It("returns the route recorded in the manifest", func() {
+		url, err := adapter.DashboardUrlGenerator{}.DashboardUrl("some-instance-id", plan, manifest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(url.DashboardUrl).To(Equal("https://redis-some-instance-id.apps.example.com"))
+	})
+
+	It("returns an empty URL for manifests generated before dashboard routes", func() {
+		delete(manifest.Tags, adapter.DashboardRouteTagKey)
+		url, err := adapter.DashboardUrlGenerator{}.DashboardUrl("some-instance-id", plan, manifest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(url).To(Equal(serviceadapter.DashboardUrl{}))
+	})
+
+	It("agrees with the route registered by the manifest generator", func() {
+		manifestGenerator := adapter.ManifestGenerator{
+			StderrLogger: log.New(GinkgoWriter, "", log.LstdFlags),
+			Config:       adapter.Config{RedisInstanceGroupName: "redis-server"},
+		}
+		generated, err := manifestGenerator.GenerateManifest(
+			serviceadapter.ServiceDeployment{
+				DeploymentName: "service-instance_some-instance-id",
+				Releases: serviceadapter.ServiceReleases{{
+					Name:    "some-release-name",
+					Version: "4",
+					Jobs:    []string{adapter.RedisJobName, adapter.HealthCheckErrandName, adapter.CleanupDataErrandName},
+				}},
+				Stemcell: serviceadapter.Stemcell{OS: "some-stemcell-os", Version: "1234"},
+			},
+			serviceadapter.Plan{
+				Properties: serviceadapter.Properties{
+					"persistence":                      false,
+					adapter.DashboardDomainPropertyKey: "apps.example.com",
+				},
+				InstanceGroups: []serviceadapter.InstanceGroup{
+					{Name: "redis-server", VMType: "some-vm", Networks: []string{"some-network"}, Instances: 1, AZs: []string{"some-az"}},
+				},
+			},
+			nil, nil, nil, nil,
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		url, err := adapter.DashboardUrlGenerator{}.DashboardUrl("some-instance-id", plan, generated.Manifest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(url.DashboardUrl).To(Equal("https://redis-some-instance-id.apps.example.com"))
+	})
+})
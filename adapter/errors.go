@@ -0,0 +1,87 @@
+package adapter
+
+import (
+	"fmt"
+	"strings"
+)
+
+const ContactOperatorMessage = "Contact your operator, service configuration issue occurred"
+
+// Error separates the detail logged for the operator from the message
+// returned to the user through the SDK.
+type Error struct {
+	OperatorMessage string
+	UserMessage     string
+}
+
+func (e *Error) Error() string {
+	return e.UserMessage
+}
+
+func operatorError(format string, args ...interface{}) *Error {
+	return &Error{
+		OperatorMessage: fmt.Sprintf(format, args...),
+		UserMessage:     ContactOperatorMessage,
+	}
+}
+
+func userError(format string, args ...interface{}) *Error {
+	message := fmt.Sprintf(format, args...)
+	return &Error{
+		OperatorMessage: message,
+		UserMessage:     message,
+	}
+}
+
+// asAdapterError treats errors that are not an *Error as operator-only detail.
+func asAdapterError(err error) *Error {
+	if adapterErr, ok := err.(*Error); ok {
+		return adapterErr
+	}
+	return operatorError("%s", err)
+}
+
+// combineErrors folds several failures into one error whose messages are
+// bulleted lists. Identical user messages are only listed once, so several
+// operator-only failures still surface as the single generic message.
+func combineErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+
+	var operatorMessages, userMessages []string
+	seenUserMessages := map[string]bool{}
+	for _, err := range errs {
+		adapterErr := asAdapterError(err)
+		operatorMessages = append(operatorMessages, "- "+adapterErr.OperatorMessage)
+		if !seenUserMessages[adapterErr.UserMessage] {
+			seenUserMessages[adapterErr.UserMessage] = true
+			userMessages = append(userMessages, "- "+adapterErr.UserMessage)
+		}
+	}
+
+	userMessage := strings.TrimPrefix(userMessages[0], "- ")
+	if len(userMessages) > 1 {
+		userMessage = fmt.Sprintf("the following problems must be fixed:\n%s", strings.Join(userMessages, "\n"))
+	}
+
+	return &Error{
+		OperatorMessage: fmt.Sprintf("%d problems found:\n%s", len(errs), strings.Join(operatorMessages, "\n")),
+		UserMessage:     userMessage,
+	}
+}
+
+// reportError logs the operator message tagged with the deployment name.
+func reportError(events *eventLogger, err error) *Error {
+	adapterErr := asAdapterError(err)
+
+	reported := &Error{
+		OperatorMessage: fmt.Sprintf("deployment %s: %s", events.deployment, adapterErr.OperatorMessage),
+		UserMessage:     adapterErr.UserMessage,
+	}
+	events.Error(reported.OperatorMessage)
+	return reported
+}
@@ -0,0 +1,229 @@
+package adapter
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/on-demand-services-sdk/serviceadapter"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var redactedKeyFragments = []string{"password", "secret", "token"}
+
+// secretAssignment finds key: value and key=value pairs in free text, such as
+// an error that quotes a property, whose key names a secret.
+var secretAssignment = regexp.MustCompile(`(?i)([\w.-]*(?:password|secret|token)[\w.-]*)(\s*[:=]\s*)('[^']*'|"[^"]*"|[^\s,;&)]+)`)
+
+const (
+	LogFormatEnvVar = "ADAPTER_LOG_FORMAT"
+	LogFormatPlain  = "plain"
+	LogFormatJSON   = "json"
+
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+
+	RedactedValue = "***"
+)
+
+type logEvent struct {
+	Level      string `json:"level"`
+	Msg        string `json:"msg"`
+	Deployment string `json:"deployment"`
+	Operation  string `json:"operation"`
+	Timestamp  string `json:"timestamp"`
+}
+
+// eventLogger writes adapter log events either as the plain lines the
+// StderrLogger has always produced or, in the json format, as one JSON object
+// per line. Secret values are masked in both formats.
+type eventLogger struct {
+	logger     *log.Logger
+	json       bool
+	deployment string
+	operation  string
+	secrets    []string
+	// warnings keeps every redacted warning, for GenerateManifestStrict.
+	warnings []string
+}
+
+// newEventLogger falls back to the ADAPTER_LOG_FORMAT environment variable
+// when no format is configured.
+func newEventLogger(logger *log.Logger, format, deployment, operation string, secrets serviceadapter.ManifestSecrets) *eventLogger {
+	if format == "" {
+		format = os.Getenv(LogFormatEnvVar)
+	}
+
+	var secretValues []string
+	for _, value := range secrets {
+		if value != "" {
+			secretValues = append(secretValues, value)
+		}
+	}
+	l := &eventLogger{
+		logger:     logger,
+		json:       format == LogFormatJSON,
+		deployment: deployment,
+		operation:  operation,
+	}
+	l.addSecrets(secretValues...)
+	return l
+}
+
+func (l *eventLogger) addSecrets(values ...string) {
+	l.secrets = append(l.secrets, values...)
+	// Longer secrets first, so one that contains another is masked whole.
+	sort.Slice(l.secrets, func(i, j int) bool { return len(l.secrets[i]) > len(l.secrets[j]) })
+}
+
+// addManifestSecrets masks the literal values of the password, secret and
+// token fields of a manifest from then on. Credhub references are left alone,
+// they are what an operator needs to see when interpolation fails.
+func (l *eventLogger) addManifestSecrets(manifest interface{}) {
+	manifestYAML, err := yaml.Marshal(manifest)
+	if err != nil {
+		return
+	}
+	var generic interface{}
+	if err := yaml.Unmarshal(manifestYAML, &generic); err != nil {
+		return
+	}
+	l.addSecrets(literalSecretValues(generic, false)...)
+}
+
+func literalSecretValues(value interface{}, secretKey bool) []string {
+	var values []string
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		for key, nested := range v {
+			values = append(values, literalSecretValues(nested, isSecretKey(key))...)
+		}
+	case []interface{}:
+		for _, nested := range v {
+			values = append(values, literalSecretValues(nested, secretKey)...)
+		}
+	case string:
+		if secretKey && v != "" && !isCredhubRef(v) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func isCredhubRef(value string) bool {
+	return strings.HasPrefix(value, "((") && strings.HasSuffix(value, "))")
+}
+
+func (l *eventLogger) Info(msg string) {
+	l.log(LogLevelInfo, msg)
+}
+
+func (l *eventLogger) Warn(msg string) {
+	l.warnings = append(l.warnings, l.redact(msg))
+	l.log(LogLevelWarn, msg)
+}
+
+func (l *eventLogger) Error(msg string) {
+	l.log(LogLevelError, msg)
+}
+
+func (l *eventLogger) log(level, msg string) {
+	msg = l.redact(msg)
+	if !l.json {
+		l.logger.Println(msg)
+		return
+	}
+
+	event, err := json.Marshal(logEvent{
+		Level:      level,
+		Msg:        msg,
+		Deployment: l.deployment,
+		Operation:  l.operation,
+		Timestamp:  time.Now().UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		l.logger.Println(msg)
+		return
+	}
+	l.logger.Writer().Write(append(event, '\n'))
+}
+
+func (l *eventLogger) redact(msg string) string {
+	for _, secret := range l.secrets {
+		msg = strings.Replace(msg, secret, RedactedValue, -1)
+	}
+	return secretAssignment.ReplaceAllStringFunc(msg, func(assignment string) string {
+		parts := secretAssignment.FindStringSubmatch(assignment)
+		value := parts[3]
+		if quote := value[:1]; (quote == "'" || quote == `"`) && len(value) > 1 {
+			return parts[1] + parts[2] + quote + RedactedValue + quote
+		}
+		return parts[1] + parts[2] + RedactedValue
+	})
+}
+
+// Manifest logs a manifest, or part of one, as YAML after masking every
+// password, secret and token field as well as any resolved secret value.
+func (l *eventLogger) Manifest(level, msg string, manifest interface{}) {
+	manifestYAML, err := yaml.Marshal(manifest)
+	if err != nil {
+		l.log(level, msg)
+		return
+	}
+
+	var generic interface{}
+	if err := yaml.Unmarshal(manifestYAML, &generic); err != nil {
+		l.log(level, msg)
+		return
+	}
+
+	redactedYAML, err := yaml.Marshal(l.redactValue(generic))
+	if err != nil {
+		l.log(level, msg)
+		return
+	}
+	l.log(level, msg+":\n"+string(redactedYAML))
+}
+
+func (l *eventLogger) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		redacted := make(map[interface{}]interface{}, len(v))
+		for key, nested := range v {
+			if isSecretKey(key) {
+				redacted[key] = RedactedValue
+			} else {
+				redacted[key] = l.redactValue(nested)
+			}
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, nested := range v {
+			redacted[i] = l.redactValue(nested)
+		}
+		return redacted
+	case string:
+		return l.redact(v)
+	}
+	return value
+}
+
+func isSecretKey(key interface{}) bool {
+	name, ok := key.(string)
+	if !ok {
+		return false
+	}
+	name = strings.ToLower(name)
+	for _, fragment := range redactedKeyFragments {
+		if strings.Contains(name, fragment) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package adapter
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/pivotal-cf/on-demand-services-sdk/bosh"
+	"gopkg.in/yaml.v2"
+)
+
+const generatedFieldTag = "generated"
+
+const stemcellAliasField = "Stemcells.Alias"
+
+// The version tags change with every adapter build, so they must not make an
+// otherwise unchanged manifest look like it needs a deploy. Stemcell aliases
+// are only the names instance groups refer to stemcells by.
+var DefaultIgnoredManifestFields = []string{
+	"Name",
+	stemcellAliasField,
+	"Tags." + AdapterVersionTagKey,
+	"Tags." + RedisReleaseVersionTagKey,
+}
+
+// ManifestComparator compares BOSH manifests while ignoring fields that are
+// expected to differ between generations. IgnoredFields holds Go field paths
+// such as "Name" or "Stemcells.Alias"; slices are traversed element-wise and
+// map entries are addressed by key, as in "Tags.adapter_version".
+type ManifestComparator struct {
+	IgnoredFields []string
+}
+
+// Equal compares the manifests as BOSH would read them, so that a generated
+// manifest equals the same manifest decoded from YAML.
+func (c ManifestComparator) Equal(a, b bosh.BoshManifest) bool {
+	decodedA, errA := decodedManifest(a)
+	decodedB, errB := decodedManifest(b)
+	if errA != nil || errB != nil {
+		return reflect.DeepEqual(c.normalise(a), c.normalise(b))
+	}
+	return reflect.DeepEqual(c.normalise(decodedA), c.normalise(decodedB))
+}
+
+func decodedManifest(manifest bosh.BoshManifest) (bosh.BoshManifest, error) {
+	manifestYAML, err := yaml.Marshal(manifest)
+	if err != nil {
+		return bosh.BoshManifest{}, err
+	}
+	var decoded bosh.BoshManifest
+	err = yaml.Unmarshal(manifestYAML, &decoded)
+	return decoded, err
+}
+
+func (c ManifestComparator) normalise(manifest bosh.BoshManifest) interface{} {
+	ignoredFields := c.IgnoredFields
+	if ignoredFields == nil {
+		ignoredFields = DefaultIgnoredManifestFields
+	}
+
+	for _, field := range ignoredFields {
+		if field == stemcellAliasField {
+			manifest = resolveStemcellAliases(manifest)
+			break
+		}
+	}
+
+	value := clearGeneratedFields(reflect.ValueOf(manifest))
+	for _, field := range ignoredFields {
+		value = clearField(value, strings.Split(field, "."))
+	}
+	return value.Interface()
+}
+
+// resolveStemcellAliases has each instance group name the stemcell it runs on
+// rather than its alias, so that ignoring the aliases still tells apart
+// manifests whose instance groups moved to another stemcell.
+func resolveStemcellAliases(manifest bosh.BoshManifest) bosh.BoshManifest {
+	stemcells := map[string]string{}
+	for _, stemcell := range manifest.Stemcells {
+		stemcells[stemcell.Alias] = stemcell.OS + "/" + stemcell.Version
+	}
+
+	instanceGroups := make([]bosh.InstanceGroup, len(manifest.InstanceGroups))
+	for i, instanceGroup := range manifest.InstanceGroups {
+		if stemcell, found := stemcells[instanceGroup.Stemcell]; found {
+			instanceGroup.Stemcell = stemcell
+		}
+		instanceGroups[i] = instanceGroup
+	}
+	manifest.InstanceGroups = instanceGroups
+	return manifest
+}
+
+func clearField(value reflect.Value, path []string) reflect.Value {
+	switch value.Kind() {
+	case reflect.Struct:
+		field, found := value.Type().FieldByName(path[0])
+		if !found {
+			return value
+		}
+		cleared := reflect.New(value.Type()).Elem()
+		cleared.Set(value)
+		if len(path) == 1 {
+			cleared.FieldByIndex(field.Index).Set(reflect.Zero(field.Type))
+		} else {
+			cleared.FieldByIndex(field.Index).Set(clearField(value.FieldByIndex(field.Index), path[1:]))
+		}
+		return cleared
+	case reflect.Slice:
+		if value.IsNil() {
+			return value
+		}
+		cleared := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+		for i := 0; i < value.Len(); i++ {
+			cleared.Index(i).Set(clearField(value.Index(i), path))
+		}
+		return cleared
+	case reflect.Ptr:
+		if value.IsNil() {
+			return value
+		}
+		cleared := reflect.New(value.Type().Elem())
+		cleared.Elem().Set(clearField(value.Elem(), path))
+		return cleared
+	case reflect.Map:
+		if value.IsNil() || value.Type().Key().Kind() != reflect.String {
+			return value
+		}
+		key := reflect.ValueOf(path[0]).Convert(value.Type().Key())
+		entry := value.MapIndex(key)
+		if !entry.IsValid() {
+			return value
+		}
+		cleared := reflect.MakeMap(value.Type())
+		for _, existingKey := range value.MapKeys() {
+			cleared.SetMapIndex(existingKey, value.MapIndex(existingKey))
+		}
+		if len(path) == 1 {
+			cleared.SetMapIndex(key, reflect.Value{})
+		} else {
+			cleared.SetMapIndex(key, clearField(entry, path[1:]))
+		}
+		return cleared
+	}
+	return value
+}
+
+func clearGeneratedFields(value reflect.Value) reflect.Value {
+	switch value.Kind() {
+	case reflect.Struct:
+		cleared := reflect.New(value.Type()).Elem()
+		cleared.Set(value)
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			if field.Tag.Get("bosh") == generatedFieldTag {
+				cleared.Field(i).Set(reflect.Zero(field.Type))
+				continue
+			}
+			cleared.Field(i).Set(clearGeneratedFields(value.Field(i)))
+		}
+		return cleared
+	case reflect.Slice:
+		if value.IsNil() {
+			return value
+		}
+		cleared := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+		for i := 0; i < value.Len(); i++ {
+			cleared.Index(i).Set(clearGeneratedFields(value.Index(i)))
+		}
+		return cleared
+	case reflect.Ptr:
+		if value.IsNil() {
+			return value
+		}
+		cleared := reflect.New(value.Type().Elem())
+		cleared.Elem().Set(clearGeneratedFields(value.Elem()))
+		return cleared
+	}
+	return value
+}
@@ -0,0 +1,123 @@
+package adapter_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf-experimental/redis-example-service-adapter/adapter"
+	"github.com/pivotal-cf/on-demand-services-sdk/bosh"
+	"gopkg.in/yaml.v2"
+)
+
+var _ = Describe("ManifestComparator", func() {
+	var manifest bosh.BoshManifest
+
+	BeforeEach(func() {
+		manifest = bosh.BoshManifest{
+			Name:      "some-instance-id",
+			Releases:  []bosh.Release{{Name: "some-release-name", Version: "4"}},
+			Stemcells: []bosh.Stemcell{{Alias: "only-stemcell", OS: "some-stemcell-os", Version: "1234"}},
+			InstanceGroups: []bosh.InstanceGroup{
+				{Name: "redis-server", Instances: 1, Stemcell: "only-stemcell", Properties: map[string]interface{}{"redis": "value"}},
+			},
+			Addons:     []bosh.Addon{{Name: "some-addon", Jobs: []bosh.Job{{Name: "some-job", Release: "some-release-name"}}}},
+			Update:     &bosh.Update{Canaries: 1, MaxInFlight: 1},
+			Properties: map[string]interface{}{},
+			Variables:  []bosh.Variable{{Name: "secret_pass", Type: "password"}},
+			Tags:       map[string]interface{}{"product": "redis"},
+		}
+	})
+
+	DescribeTable("comparing manifests",
+		func(comparator adapter.ManifestComparator, modify func(*bosh.BoshManifest), expectedEqual bool) {
+			other := manifest
+			other.Stemcells = append([]bosh.Stemcell{}, manifest.Stemcells...)
+			other.InstanceGroups = append([]bosh.InstanceGroup{}, manifest.InstanceGroups...)
+			modify(&other)
+			Expect(comparator.Equal(manifest, other)).To(Equal(expectedEqual))
+		},
+		Entry("identical manifests", adapter.ManifestComparator{}, func(m *bosh.BoshManifest) {}, true),
+		Entry("ignores Name by default", adapter.ManifestComparator{}, func(m *bosh.BoshManifest) {
+			m.Name = "other-instance-id"
+		}, true),
+		Entry("ignores stemcell Alias when configured", adapter.ManifestComparator{IgnoredFields: []string{"Name", "Stemcells.Alias"}}, func(m *bosh.BoshManifest) {
+			m.Stemcells[0].Alias = "other-stemcell"
+			m.InstanceGroups[0].Stemcell = "other-stemcell"
+		}, true),
+		Entry("ignores a renamed stemcell Alias by default", adapter.ManifestComparator{}, func(m *bosh.BoshManifest) {
+			m.Stemcells[0].Alias = "other-stemcell"
+			m.InstanceGroups[0].Stemcell = "other-stemcell"
+		}, true),
+		Entry("compares the stemcell an instance group runs on while ignoring Alias", adapter.ManifestComparator{}, func(m *bosh.BoshManifest) {
+			m.Stemcells = append(m.Stemcells, bosh.Stemcell{Alias: "pinned-stemcell", OS: "some-stemcell-os", Version: "5678"})
+			m.InstanceGroups[0].Stemcell = "pinned-stemcell"
+		}, false),
+		Entry("compares stemcell Alias when not ignored", adapter.ManifestComparator{IgnoredFields: []string{"Name"}}, func(m *bosh.BoshManifest) {
+			m.Stemcells[0].Alias = "other-stemcell"
+			m.InstanceGroups[0].Stemcell = "other-stemcell"
+		}, false),
+		Entry("compares Addons", adapter.ManifestComparator{}, func(m *bosh.BoshManifest) {
+			m.Addons = []bosh.Addon{{Name: "some-addon", Jobs: []bosh.Job{{Name: "other-job", Release: "some-release-name"}}}}
+		}, false),
+		Entry("ignores Addons when configured", adapter.ManifestComparator{IgnoredFields: []string{"Addons"}}, func(m *bosh.BoshManifest) {
+			m.Addons = nil
+		}, true),
+		Entry("compares Name when not ignored", adapter.ManifestComparator{IgnoredFields: []string{}}, func(m *bosh.BoshManifest) {
+			m.Name = "other-instance-id"
+		}, false),
+		Entry("compares Releases", adapter.ManifestComparator{}, func(m *bosh.BoshManifest) {
+			m.Releases = []bosh.Release{{Name: "some-release-name", Version: "5"}}
+		}, false),
+		Entry("compares Stemcells", adapter.ManifestComparator{}, func(m *bosh.BoshManifest) {
+			m.Stemcells[0].Version = "5678"
+		}, false),
+		Entry("compares InstanceGroups", adapter.ManifestComparator{}, func(m *bosh.BoshManifest) {
+			m.InstanceGroups[0].Instances = 2
+		}, false),
+		Entry("compares Update", adapter.ManifestComparator{}, func(m *bosh.BoshManifest) {
+			m.Update = &bosh.Update{Canaries: 2, MaxInFlight: 1}
+		}, false),
+		Entry("compares Properties", adapter.ManifestComparator{}, func(m *bosh.BoshManifest) {
+			m.Properties = map[string]interface{}{"foo": "bar"}
+		}, false),
+		Entry("compares Variables", adapter.ManifestComparator{}, func(m *bosh.BoshManifest) {
+			m.Variables = []bosh.Variable{{Name: "other", Type: "password"}}
+		}, false),
+		Entry("compares Tags", adapter.ManifestComparator{}, func(m *bosh.BoshManifest) {
+			m.Tags = map[string]interface{}{"product": "other"}
+		}, false),
+		Entry("ignores the version tags by default", adapter.ManifestComparator{}, func(m *bosh.BoshManifest) {
+			m.Tags = map[string]interface{}{"product": "redis", adapter.AdapterVersionTagKey: "1.2.3", adapter.RedisReleaseVersionTagKey: "5"}
+		}, true),
+		Entry("compares the version tags when not ignored", adapter.ManifestComparator{IgnoredFields: []string{"Name"}}, func(m *bosh.BoshManifest) {
+			m.Tags = map[string]interface{}{"product": "redis", adapter.AdapterVersionTagKey: "1.2.3"}
+		}, false),
+		Entry("compares Features", adapter.ManifestComparator{}, func(m *bosh.BoshManifest) {
+			m.Features.UseShortDNSAddresses = bosh.BoolPointer(true)
+		}, false),
+	)
+
+	It("equals the same manifest decoded from YAML", func() {
+		manifest.InstanceGroups[0].Properties = map[string]interface{}{"redis": map[interface{}]interface{}{"maxclients": 100}}
+		manifestYAML, err := yaml.Marshal(manifest)
+		Expect(err).NotTo(HaveOccurred())
+		var decoded bosh.BoshManifest
+		Expect(yaml.Unmarshal(manifestYAML, &decoded)).To(Succeed())
+
+		Expect(adapter.ManifestComparator{}.Equal(manifest, decoded)).To(BeTrue())
+	})
+
+	It("does not modify the manifests being compared", func() {
+		comparator := adapter.ManifestComparator{IgnoredFields: []string{"Name", "Stemcells.Alias"}}
+		comparator.Equal(manifest, manifest)
+		Expect(manifest.Name).To(Equal("some-instance-id"))
+		Expect(manifest.Stemcells[0].Alias).To(Equal("only-stemcell"))
+		Expect(manifest.InstanceGroups[0].Stemcell).To(Equal("only-stemcell"))
+	})
+
+	It("does not modify the maps of the manifests being compared", func() {
+		manifest.Tags[adapter.AdapterVersionTagKey] = "1.2.3"
+		adapter.ManifestComparator{}.Equal(manifest, manifest)
+		Expect(manifest.Tags).To(HaveKeyWithValue(adapter.AdapterVersionTagKey, "1.2.3"))
+	})
+})
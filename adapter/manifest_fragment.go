@@ -0,0 +1,119 @@
+package adapter
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/pivotal-cf/on-demand-services-sdk/serviceadapter"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// generatedRedisProperties differ on every generation, so they never count as
+// a plan customisation.
+var generatedRedisProperties = map[interface{}]bool{
+	"password":    true,
+	"plan_secret": true,
+}
+
+// ManifestFragment returns a BOSH ops-file with the redis properties the plan
+// changes from those of a plan that only disables persistence, so the
+// customisation can be inspected without a whole deployment manifest.
+func (m ManifestGenerator) ManifestFragment(plan serviceadapter.Plan) ([]byte, error) {
+	m.events = newEventLogger(m.StderrLogger, m.LogFormat, "", "manifest-fragment", nil)
+
+	fragment, err := m.manifestFragment(plan)
+	if err != nil {
+		// There is no deployment or broker user here, so the operator detail
+		// is what needs to surface.
+		return nil, errors.New(asAdapterError(err).OperatorMessage)
+	}
+	return fragment, nil
+}
+
+func (m ManifestGenerator) manifestFragment(plan serviceadapter.Plan) ([]byte, error) {
+	if len(plan.InstanceGroups) == 0 {
+		return nil, operatorError("plan defines no instance groups")
+	}
+	redisServerInstanceGroup := m.findRedisServerInstanceGroup(plan)
+	if redisServerInstanceGroup == nil {
+		return nil, operatorError("no %s instance group definition found", m.Config.RedisInstanceGroupName)
+	}
+
+	planRedisProperties, err := m.defaultRedisProperties(plan.Properties)
+	if err != nil {
+		return nil, err
+	}
+	baseRedisProperties, err := m.defaultRedisProperties(serviceadapter.Properties{m.Config.persistencePropertyKey(): false})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[string]bool{}
+	for key := range planRedisProperties {
+		keys[fmt.Sprint(key)] = true
+	}
+	for key := range baseRedisProperties {
+		keys[fmt.Sprint(key)] = true
+	}
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		if !generatedRedisProperties[key] {
+			sortedKeys = append(sortedKeys, key)
+		}
+	}
+	sort.Strings(sortedKeys)
+
+	pathPrefix, err := redisPropertiesPath(redisServerInstanceGroup.Name, plan.Properties)
+	if err != nil {
+		return nil, err
+	}
+	operations := []yaml.MapSlice{}
+	for _, key := range sortedKeys {
+		value, inPlan := planRedisProperties[key]
+		baseValue, inBase := baseRedisProperties[key]
+		switch {
+		case !inPlan:
+			operations = append(operations, yaml.MapSlice{
+				{Key: "type", Value: "remove"},
+				{Key: "path", Value: pathPrefix + key},
+			})
+		case !inBase || !reflect.DeepEqual(value, baseValue):
+			operations = append(operations, yaml.MapSlice{
+				{Key: "type", Value: "replace"},
+				{Key: "path", Value: pathPrefix + key + "?"},
+				{Key: "value", Value: value},
+			})
+		}
+	}
+
+	fragment, err := yaml.Marshal(operations)
+	if err != nil {
+		return nil, operatorError("error encoding the manifest fragment: %s", err)
+	}
+	return fragment, nil
+}
+
+// redisPropertiesPath is where the generator puts the redis block for the
+// plan's property_scope: on the instance group, or on the redis server job.
+func redisPropertiesPath(instanceGroupName string, planProperties serviceadapter.Properties) (string, error) {
+	scope, err := propertyScope(planProperties)
+	if err != nil {
+		return "", err
+	}
+	if scope == PropertyScopeJob {
+		return fmt.Sprintf("/instance_groups/name=%s/jobs/name=%s/properties/redis/", instanceGroupName, redisJobName(planProperties)), nil
+	}
+	return fmt.Sprintf("/instance_groups/name=%s/properties/redis/", instanceGroupName), nil
+}
+
+// defaultRedisProperties is what a create with no arbitrary parameters would
+// write into the redis block.
+func (m ManifestGenerator) defaultRedisProperties(planProperties serviceadapter.Properties) (map[interface{}]interface{}, error) {
+	properties, err := m.redisServerProperties("", planProperties, map[string]interface{}{}, nil, serviceadapter.ODBManagedSecrets{}, nil, OperationCreate)
+	if err != nil {
+		return nil, err
+	}
+	return properties["redis"].(map[interface{}]interface{}), nil
+}
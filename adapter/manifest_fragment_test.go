@@ -0,0 +1,103 @@
+package adapter_test
+
+import (
+	"log"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf-experimental/redis-example-service-adapter/adapter"
+	"github.com/pivotal-cf/on-demand-services-sdk/serviceadapter"
+)
+
+var _ = Describe("ManifestFragment", func() {
+	var (
+		generator adapter.ManifestGenerator
+		plan      serviceadapter.Plan
+	)
+
+	BeforeEach(func() {
+		generator = adapter.ManifestGenerator{
+			Config:       adapter.Config{RedisInstanceGroupName: "redis-server", SecureManifestsEnabled: true},
+			StderrLogger: log.New(GinkgoWriter, "", log.LstdFlags),
+		}
+		plan = serviceadapter.Plan{
+			InstanceGroups: []serviceadapter.InstanceGroup{{Name: "redis-server", Instances: 1}},
+			Properties:     serviceadapter.Properties{"persistence": false},
+		}
+	})
+
+	It("returns an empty ops-file for a plan without customisations", func() {
+		fragment, err := generator.ManifestFragment(plan)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(fragment)).To(Equal("[]\n"))
+	})
+
+	It("replaces only the redis properties that differ from the defaults", func() {
+		plan.Properties["persistence"] = true
+		plan.Properties[adapter.ShareablePropertyKey] = true
+		plan.Properties[adapter.BindingTTLSecondsPropertyKey] = 60
+		plan.Properties["plan_secret"] = "some-plan-secret"
+
+		fragment, err := generator.ManifestFragment(plan)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(fragment)).To(MatchYAML(`
+- type: replace
+  path: /instance_groups/name=redis-server/properties/redis/binding_ttl_seconds?
+  value: 60
+- type: replace
+  path: /instance_groups/name=redis-server/properties/redis/persistence?
+  value: "yes"
+- type: replace
+  path: /instance_groups/name=redis-server/properties/redis/shareable?
+  value: true
+`))
+		Expect(string(fragment)).To(HavePrefix("- type: replace\n  path: "))
+	})
+
+	It("addresses the redis server job when the plan scopes properties to the job", func() {
+		plan.Properties[adapter.PropertyScopePropertyKey] = adapter.PropertyScopeJob
+		plan.Properties[adapter.ShareablePropertyKey] = true
+
+		fragment, err := generator.ManifestFragment(plan)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(fragment)).To(MatchYAML(`
+- type: replace
+  path: /instance_groups/name=redis-server/jobs/name=redis-server/properties/redis/shareable?
+  value: true
+`))
+	})
+
+	It("addresses the job named by the plan when the plan scopes properties to the job", func() {
+		plan.Properties[adapter.PropertyScopePropertyKey] = adapter.PropertyScopeJob
+		plan.Properties[adapter.RedisJobNamePropertyKey] = "redis-6"
+		plan.Properties[adapter.ShareablePropertyKey] = true
+
+		fragment, err := generator.ManifestFragment(plan)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(fragment)).To(ContainSubstring("path: /instance_groups/name=redis-server/jobs/name=redis-6/properties/redis/shareable?"))
+	})
+
+	It("returns an error when the plan has an unknown property scope", func() {
+		plan.Properties[adapter.PropertyScopePropertyKey] = "deployment"
+		_, err := generator.ManifestFragment(plan)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("returns an error when the plan cannot generate a manifest", func() {
+		delete(plan.Properties, "persistence")
+		_, err := generator.ManifestFragment(plan)
+		Expect(err).To(MatchError("the plan property 'persistence' is missing"))
+	})
+
+	It("returns an error when the plan has no redis instance group", func() {
+		plan.InstanceGroups[0].Name = "other"
+		_, err := generator.ManifestFragment(plan)
+		Expect(err).To(MatchError("no redis-server instance group definition found"))
+	})
+
+	It("returns a distinct error when the plan has no instance groups", func() {
+		plan.InstanceGroups = nil
+		_, err := generator.ManifestFragment(plan)
+		Expect(err).To(MatchError("plan defines no instance groups"))
+	})
+})
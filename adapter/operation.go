@@ -0,0 +1,37 @@
+package adapter
+
+import (
+	"github.com/pivotal-cf/on-demand-services-sdk/bosh"
+	"github.com/pivotal-cf/on-demand-services-sdk/serviceadapter"
+)
+
+// Operation is the kind of request GenerateManifest is serving.
+type Operation string
+
+const (
+	OperationCreate     Operation = "create"
+	OperationUpdate     Operation = "update"
+	OperationPlanChange Operation = "plan-change"
+	OperationUpgrade    Operation = "upgrade"
+)
+
+// classifyOperation tells the ODB upgrade-all-instances runs, which send the
+// same plan with no arbitrary parameters and no request context, apart from
+// user-initiated updates.
+func classifyOperation(
+	plan serviceadapter.Plan,
+	requestParams serviceadapter.RequestParameters,
+	previousManifest *bosh.BoshManifest,
+	previousPlan *serviceadapter.Plan,
+) Operation {
+	if previousManifest == nil {
+		return OperationCreate
+	}
+	if previousPlan != nil && planIdentity(*previousPlan) != planIdentity(plan) {
+		return OperationPlanChange
+	}
+	if len(requestParams.ArbitraryParams()) == 0 && len(requestParams.ArbitraryContext()) == 0 {
+		return OperationUpgrade
+	}
+	return OperationUpdate
+}
@@ -1,97 +1,312 @@
 package adapter
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"net"
+	"net/url"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/pivotal-cf/on-demand-services-sdk/bosh"
 	"github.com/pivotal-cf/on-demand-services-sdk/serviceadapter"
 	"github.com/pkg/errors"
 )
 
+const (
+	ReplicaInstanceGroupName = "redis-replica"
+	BindingRoleKey           = "role"
+	BindingRoleMaster        = "master"
+	BindingRoleReplica       = "replica"
+	TLSPortKey               = "tls-port"
+	BindHostnameKey          = "bind_hostname"
+	CredentialsJSONKey       = "credentials_json"
+	MetricsJobName           = "redis-metrics"
+	DefaultMetricsPort       = 9121
+	DefaultMetricsPath       = "/metrics"
+)
+
 type Binder struct {
 	StderrLogger *log.Logger
+	LogFormat    string
 	Config       Config
+
+	events *eventLogger
 }
 
 func (b Binder) CreateBinding(bindingID string, deploymentTopology bosh.BoshVMs, manifest bosh.BoshManifest, requestParams serviceadapter.RequestParameters, secrets serviceadapter.ManifestSecrets, dnsAddresses serviceadapter.DNSAddresses) (serviceadapter.Binding, error) {
+	b.events = newEventLogger(b.StderrLogger, b.LogFormat, manifest.Name, "create-binding", secrets)
+	b.events.addManifestSecrets(manifest)
+	binding, err := b.createBinding(bindingID, deploymentTopology, manifest, requestParams, secrets, dnsAddresses)
+	if err != nil {
+		return serviceadapter.Binding{}, reportError(b.events, err)
+	}
+	return binding, nil
+}
+
+func (b Binder) createBinding(bindingID string, deploymentTopology bosh.BoshVMs, manifest bosh.BoshManifest, requestParams serviceadapter.RequestParameters, secrets serviceadapter.ManifestSecrets, dnsAddresses serviceadapter.DNSAddresses) (serviceadapter.Binding, error) {
 	ctx := requestParams.ArbitraryContext()
 	platform := requestParams.Platform()
-	if len(ctx) == 0 || platform == "" || platform != "cloudfoundry" {
-		b.StderrLogger.Println("Non Cloud Foundry platform (or pre OSBAPI 2.13) detected")
+	cloudFoundry := len(ctx) != 0 && platform == "cloudfoundry"
+	if !cloudFoundry {
+		b.events.Info("Non Cloud Foundry platform (or pre OSBAPI 2.13) detected")
+	}
+	role, err := bindingRole(requestParams.ArbitraryParams())
+	if err != nil {
+		return serviceadapter.Binding{}, err
+	}
+
+	redisProperties, err := b.redisProperties(manifest)
+	if err != nil {
+		b.events.Manifest(LogLevelError, "could not read the redis properties from the manifest", manifest)
+		return serviceadapter.Binding{}, operatorError("error reading the manifest: %s", err)
 	}
-	redisHost, err := getRedisHost(deploymentTopology)
+	b.warnOnOldSchemaVersion(redisProperties.SchemaVersion)
+
+	shareable := redisProperties.Shareable
+	cluster := clusterEnabled(redisProperties)
+	// Every node of a cluster serves clients, so a cluster is never limited
+	// to the single instance of an unshared plan.
+	redisHosts, err := b.masterHosts(deploymentTopology, redisProperties.BindHostname, shareable || cluster)
 	if err != nil {
-		b.StderrLogger.Println(err.Error())
-		return serviceadapter.Binding{}, errors.New("")
+		return serviceadapter.Binding{}, err
+	}
+
+	bindsReplicas := false
+	if role == BindingRoleReplica {
+		if replicaIPs := deploymentTopology[ReplicaInstanceGroupName]; len(replicaIPs) > 0 {
+			redisHosts = replicaIPs
+			bindsReplicas = true
+		} else {
+			b.events.Warn("replica binding requested but no replicas are deployed, falling back to master")
+		}
 	}
+	redisHost := redisHosts[0]
 
 	resolvedSecrets := make(map[string]string, len(secrets))
 	if secrets != nil { // service created with latest generate-manifest
 		manifestSecretPaths := []struct {
-			Name     string
-			Optional bool
+			Name        string
+			Path        string
+			Optional    bool
+			AllowInline bool
 		}{
-			{Name: GeneratedSecretKey},
-			{Name: ManagedSecretKey},
-			{Name: "ca_cert"},
-			{Name: "private_key"},
-			{Name: "certificate"},
-			{Name: "secret", Optional: true},
+			{Name: GeneratedSecretKey, Path: redisProperties.GeneratedSecret},
+			{Name: ManagedSecretKey, Path: redisProperties.ManagedSecret},
+			{Name: "ca_cert", Path: redisProperties.CACert, AllowInline: true},
+			{Name: "private_key", Path: redisProperties.PrivateKey},
+			{Name: "certificate", Path: redisProperties.Certificate},
+			{Name: "secret", Path: redisProperties.Secret, Optional: true},
 		}
 		for _, field := range manifestSecretPaths {
-			var ok bool
 			manifestSecret := field.Name
-			path, ok := redisPlanProperties(manifest)[manifestSecret].(string)
-			if !ok || path == "" {
-				err := fmt.Errorf("could not find path for " + manifestSecret)
-				b.StderrLogger.Println(err.Error())
+			path := field.Path
+			if path == "" {
 				if field.Optional {
+					b.events.Warn("could not find path for " + manifestSecret)
 					continue
 				}
-				return serviceadapter.Binding{}, err
+				return serviceadapter.Binding{}, operatorError("could not find path for %s", manifestSecret)
 			}
 
 			matchResult, err := regexp.MatchString(`\(\([^()]+\)\)`, path)
 			if err != nil {
-				b.StderrLogger.Println(err.Error())
-				return serviceadapter.Binding{}, err
+				return serviceadapter.Binding{}, operatorError("%s", err)
 			}
 
 			if !matchResult {
-				err := fmt.Errorf("expecting a credhub ref string with format ((xxx)), but got: %s", path)
-				b.StderrLogger.Println(err.Error())
-				return serviceadapter.Binding{}, err
+				if field.AllowInline && isInlinePEM(path) {
+					continue
+				}
+				return serviceadapter.Binding{}, operatorError("expecting a credhub ref string with format ((xxx)) for '%s', but got a literal value", manifestSecret)
 			}
 
-			value := secrets[path]
-			if !ok || value == "" {
-				err := errors.New("manifest wasn't correctly interpolated: missing value for `" + path + "`")
-				b.StderrLogger.Println(err.Error())
-				return serviceadapter.Binding{}, err
+			value, ok := secrets[path]
+			if !ok {
+				return serviceadapter.Binding{}, operatorError("manifest wasn't correctly interpolated: missing value for `%s`", path)
+			}
+			if value == "" {
+				return serviceadapter.Binding{}, operatorError("secret '%s' resolved to an empty value", path)
 			}
 			resolvedSecrets[path] = value
 		}
 	}
 
-	var secretKey string
-	if value, ok := redisPlanProperties(manifest)["secret"].(string); ok {
-		secretKey = value
+	// The manifest only carries a port when the operator overrode the default.
+	masterPort := redisProperties.Port
+	if masterPort == 0 {
+		masterPort = RedisServerPort
+	}
+	port := masterPort
+	if bindsReplicas {
+		if replicaPort := replicaPort(manifest); replicaPort != 0 {
+			port = replicaPort
+		}
+	}
+
+	password, err := bindingPassword(redisProperties, secrets)
+	if err != nil {
+		return serviceadapter.Binding{}, err
+	}
+
+	credentials := map[string]interface{}{
+		"host":                      redisHost,
+		"port":                      port,
+		"generated_secret":          resolvedSecrets[GeneratedSecretKey],
+		"password":                  password,
+		"secret":                    resolvedSecrets[redisProperties.Secret],
+		"odb_managed_secret":        resolvedSecrets[ManagedSecretKey],
+		"dns_addresses":             dnsAddresses,
+		"passed_in_secrets":         secrets,
+		"expected_resolved_secrets": resolvedSecrets,
+		"tls_enabled":               tlsEnabled(redisProperties),
+		"uri": (&url.URL{
+			Scheme: "redis",
+			User:   url.UserPassword("", password),
+			Host:   net.JoinHostPort(redisHost, strconv.Itoa(port)),
+		}).String(),
+	}
+
+	if tlsPort := redisProperties.TLSPort; tlsPort != 0 {
+		caCertPath := redisProperties.CACert
+		caCert := caCertPath
+		if !isInlinePEM(caCertPath) {
+			caCert = resolvedSecrets[caCertPath]
+		}
+		if caCert == "" {
+			return serviceadapter.Binding{}, operatorError("%s is set to %d but the CA certificate '%s' was not resolved", TLSPortKey, tlsPort, caCertPath)
+		}
+		credentials["tls_port"] = tlsPort
+		credentials["ca_certificate"] = caCert
+	}
+
+	if shareable {
+		credentials["hosts"] = redisHosts
+	}
+
+	if socket := redisProperties.UnixSocket; socket != "" {
+		credentials["socket"] = socket
+	}
+
+	if cluster {
+		clusterNodes, err := b.clusterNodes(deploymentTopology, masterPort)
+		if err != nil {
+			return serviceadapter.Binding{}, err
+		}
+		credentials["cluster"] = true
+		credentials["cluster_nodes"] = clusterNodes
+	}
+
+	if bindingTTL := redisProperties.BindingTTLSeconds; bindingTTL != 0 {
+		b.events.Info(fmt.Sprintf("binding %s has a TTL of %v seconds", bindingID, bindingTTL))
+		credentials["ttl_seconds"] = bindingTTL
+	}
+
+	if metrics := metricsEndpoint(manifest, deploymentTopology, redisHost); metrics != nil {
+		credentials["metrics"] = metrics
+	}
+
+	// Other platforms, such as Kubernetes Service Catalog, mount the
+	// credentials as a single opaque secret.
+	if !cloudFoundry {
+		credentialsJSON, err := json.Marshal(credentials)
+		if err != nil {
+			return serviceadapter.Binding{}, operatorError("error encoding the credentials as JSON: %s", err)
+		}
+		credentials[CredentialsJSONKey] = string(credentialsJSON)
+	}
+
+	return serviceadapter.Binding{Credentials: credentials}, nil
+}
+
+// BindingCredentialKeys returns, sorted, the credential keys CreateBinding
+// produces for the instance, without resolving any secrets. The plan stands
+// in for the manifest when the instance has not been deployed yet.
+// credentials_json is not listed, since it depends on the platform making the
+// bind request.
+func (b Binder) BindingCredentialKeys(manifest bosh.BoshManifest, plan serviceadapter.Plan) []string {
+	keys := []string{
+		"host",
+		"port",
+		"generated_secret",
+		"password",
+		"secret",
+		"odb_managed_secret",
+		"dns_addresses",
+		"passed_in_secrets",
+		"expected_resolved_secrets",
+		"tls_enabled",
+		"uri",
+	}
+
+	redisProperties, err := b.redisProperties(manifest)
+	if err != nil {
+		redisProperties = planBindingProperties(plan.Properties)
+	}
+
+	if redisProperties.TLSPort != 0 {
+		keys = append(keys, "tls_port", "ca_certificate")
+	}
+	if redisProperties.Shareable {
+		keys = append(keys, "hosts")
+	}
+	if redisProperties.BindingTTLSeconds != 0 {
+		keys = append(keys, "ttl_seconds")
+	}
+	if redisProperties.UnixSocket != "" {
+		keys = append(keys, "socket")
+	}
+	if clusterEnabled(redisProperties) {
+		keys = append(keys, "cluster", "cluster_nodes")
+	}
+	if metricsEndpoint(manifest, nil, "") != nil {
+		keys = append(keys, "metrics")
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// planBindingProperties is what the generator writes into the redis
+// properties for the plan properties that shape a binding.
+func planBindingProperties(planProperties serviceadapter.Properties) RedisProperties {
+	redisProperties := RedisProperties{}
+	redisProperties.Shareable, _ = planProperties[ShareablePropertyKey].(bool)
+	redisProperties.BindingTTLSeconds, _ = toInt(planProperties[BindingTTLSecondsPropertyKey])
+	if tlsEnabled, _ := planProperties[TLSEnabledPropertyKey].(bool); tlsEnabled {
+		redisProperties.TLSPort = RedisServerTLSPort
+	}
+	if clusterEnabled, _ := planProperties[ClusterEnabledPropertyKey].(bool); clusterEnabled {
+		redisProperties.ClusterEnabled = "yes"
+	}
+	return redisProperties
+}
+
+var secretReferenceRegexp = regexp.MustCompile(`^\(\([^()]+\)\)$`)
+
+// bindingPassword returns the password from the manifest, resolving it when
+// the manifest refers to the ODB-managed secret rather than holding a literal
+// password, as instances created before the move to managed secrets do.
+func bindingPassword(redisProperties RedisProperties, secrets serviceadapter.ManifestSecrets) (string, error) {
+	password := redisProperties.Password
+	if password == "" {
+		return "", operatorError("no password found in the manifest")
+	}
+	if !secretReferenceRegexp.MatchString(password) {
+		return password, nil
+	}
+
+	resolved, ok := secrets[password]
+	if !ok {
+		return "", operatorError("manifest wasn't correctly interpolated: missing value for `%s`", password)
+	}
+	if resolved == "" {
+		return "", operatorError("secret '%s' resolved to an empty value", password)
 	}
-	return serviceadapter.Binding{
-		Credentials: map[string]interface{}{
-			"host":                      redisHost,
-			"port":                      RedisServerPort,
-			"generated_secret":          resolvedSecrets[GeneratedSecretKey],
-			"password":                  redisPlanProperties(manifest)["password"].(string),
-			"secret":                    resolvedSecrets[secretKey],
-			"odb_managed_secret":        resolvedSecrets[ManagedSecretKey],
-			"dns_addresses":             dnsAddresses,
-			"passed_in_secrets":         secrets,
-			"expected_resolved_secrets": resolvedSecrets,
-		},
-	}, nil
+	return resolved, nil
 }
 
 func (b Binder) DeleteBinding(bindingID string, deploymentTopology bosh.BoshVMs, manifest bosh.BoshManifest, requestParams serviceadapter.RequestParameters, secrets serviceadapter.ManifestSecrets) error {
@@ -114,19 +329,176 @@ func (b Binder) DeleteBinding(bindingID string, deploymentTopology bosh.BoshVMs,
 	return nil
 }
 
+// tlsEnabled goes by the TLS port, as every generated manifest references a
+// certificate whether or not redis listens on TLS.
+func tlsEnabled(redisProperties RedisProperties) bool {
+	return redisProperties.TLSPort != 0
+}
+
+// warnOnOldSchemaVersion still lets the binding go ahead, as the credentials
+// of older manifests are read the same way, but tells the operator the
+// instance has not been deployed by this adapter yet.
+func (b Binder) warnOnOldSchemaVersion(version int) {
+	switch {
+	case version == 0:
+		b.events.Warn(fmt.Sprintf("the manifest has no redis %s, it was generated by an older adapter and the instance may need an update-deploy", PropertiesSchemaVersionKey))
+	case version < CurrentPropertiesSchemaVersion:
+		b.events.Warn(fmt.Sprintf("the manifest has redis %s %d, older than this adapter's %d, the instance may need an update-deploy", PropertiesSchemaVersionKey, version, CurrentPropertiesSchemaVersion))
+	}
+}
+
+// isInlinePEM tells a CA the operator wrote into the manifest apart from a
+// reference to one in CredHub.
+func isInlinePEM(value string) bool {
+	return strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN")
+}
+
+func clusterEnabled(redisProperties RedisProperties) bool {
+	return redisProperties.ClusterEnabled == "yes"
+}
+
+// clusterNodes lists every redis instance as host:port, sorted so that the
+// connection string does not change with the order BOSH reports the VMs in.
+func (b Binder) clusterNodes(topology bosh.BoshVMs, port int) (string, error) {
+	hosts, err := getRedisHosts(topology, b.redisInstanceGroupName(), true)
+	if err != nil {
+		return "", operatorError("%s", err)
+	}
+
+	nodes := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		nodes = append(nodes, net.JoinHostPort(host, strconv.Itoa(port)))
+	}
+	sort.Strings(nodes)
+	return strings.Join(nodes, ","), nil
+}
+
+func metricsEndpoint(manifest bosh.BoshManifest, deploymentTopology bosh.BoshVMs, redisHost string) map[string]interface{} {
+	for _, instanceGroup := range manifest.InstanceGroups {
+		for _, job := range instanceGroup.Jobs {
+			if job.Name != MetricsJobName {
+				continue
+			}
+
+			host := redisHost
+			if ips := deploymentTopology[instanceGroup.Name]; len(ips) > 0 {
+				host = ips[0]
+			}
+			port, ok := toInt(job.Properties["port"])
+			if !ok {
+				port = DefaultMetricsPort
+			}
+			path, ok := job.Properties["path"].(string)
+			if !ok || path == "" {
+				path = DefaultMetricsPath
+			}
+			return map[string]interface{}{
+				"host": host,
+				"port": port,
+				"path": path,
+			}
+		}
+	}
+	return nil
+}
+
 func simulatedLoginToRedisSucceeds(password string) bool {
 	return len(password) > 0
 }
 
-func getRedisHost(deploymentTopology bosh.BoshVMs) (string, error) {
-	if len(deploymentTopology) != 1 {
-		return "", fmt.Errorf("expected 1 instance group in the Redis deployment, got %d", len(deploymentTopology))
+// masterHosts prefers the operator's routable bind_hostname over the IP of the
+// redis instance.
+func (b Binder) masterHosts(topology bosh.BoshVMs, bindHostname string, shareable bool) ([]string, error) {
+	if bindHostname != "" {
+		return []string{bindHostname}, nil
+	}
+
+	redisHosts, err := getRedisHosts(topology, b.redisInstanceGroupName(), shareable)
+	if err != nil {
+		return nil, operatorError("%s", err)
+	}
+	return redisHosts, nil
+}
+
+func (b Binder) redisProperties(manifest bosh.BoshManifest) (RedisProperties, error) {
+	properties, err := redisPlanProperties(manifest, b.Config.RedisInstanceGroupName)
+	if err != nil {
+		return RedisProperties{}, err
 	}
+	return FromBOSHProperties(properties)
+}
 
-	redisServerIPs := deploymentTopology["redis-server"]
-	if len(redisServerIPs) != 1 {
-		return "", fmt.Errorf("expected redis-server instance group to have only 1 instance, got %d", len(redisServerIPs))
+// replicaPort is the port set in the redis properties of the redis-replica
+// instance group, or 0 when the replicas listen on the master's port.
+func replicaPort(manifest bosh.BoshManifest) int {
+	for _, instanceGroup := range manifest.InstanceGroups {
+		if instanceGroup.Name != ReplicaInstanceGroupName {
+			continue
+		}
+		rawProperties, _ := instanceGroupRedisProperties(instanceGroup)
+		properties, _ := interfaceKeyedMap(rawProperties)
+		port, _ := toInt(properties["port"])
+		return port
 	}
-	return redisServerIPs[0], nil
+	return 0
+}
 
+func (b Binder) redisInstanceGroupName() string {
+	if b.Config.RedisInstanceGroupName != "" {
+		return b.Config.RedisInstanceGroupName
+	}
+	return RedisJobName
+}
+
+func bindingRole(arbitraryParams map[string]interface{}) (string, error) {
+	role, found := arbitraryParams[BindingRoleKey]
+	if !found {
+		return BindingRoleMaster, nil
+	}
+	if role != BindingRoleMaster && role != BindingRoleReplica {
+		return "", userError("invalid value for parameter '%s': %v, must be one of %s, %s", BindingRoleKey, role, BindingRoleMaster, BindingRoleReplica)
+	}
+	return role.(string), nil
+}
+
+// getRedisHosts only allows several instances for shareable plans.
+func getRedisHosts(deploymentTopology bosh.BoshVMs, instanceGroupName string, shareable bool) ([]string, error) {
+	redisServerIPs, found := deploymentTopology[instanceGroupName]
+	if !found {
+		return nil, fmt.Errorf(
+			"no %s instance group in the Redis deployment, found: %s",
+			instanceGroupName,
+			describeTopology(deploymentTopology),
+		)
+	}
+
+	if shareable && len(redisServerIPs) == 0 {
+		return nil, fmt.Errorf(
+			"expected %s instance group to have at least 1 instance, got 0; found: %s",
+			instanceGroupName,
+			describeTopology(deploymentTopology),
+		)
+	}
+	if !shareable && len(redisServerIPs) != 1 {
+		return nil, fmt.Errorf(
+			"expected %s instance group to have only 1 instance, got %d, plans that are not shareable must have exactly one instance; found: %s",
+			instanceGroupName,
+			len(redisServerIPs),
+			describeTopology(deploymentTopology),
+		)
+	}
+	return redisServerIPs, nil
+}
+
+func describeTopology(deploymentTopology bosh.BoshVMs) string {
+	if len(deploymentTopology) == 0 {
+		return "no instance groups"
+	}
+
+	var instanceGroups []string
+	for instanceGroup, ips := range deploymentTopology {
+		instanceGroups = append(instanceGroups, fmt.Sprintf("%s (%d instances)", instanceGroup, len(ips)))
+	}
+	sort.Strings(instanceGroups)
+	return strings.Join(instanceGroups, ", ")
 }
@@ -1,9 +1,11 @@
 package adapter_test
 
 import (
+	"encoding/json"
 	"errors"
 	"io"
 	"log"
+	"sort"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
@@ -37,6 +39,7 @@ var _ = Describe("Binding", func() {
 
 		BeforeEach(func() {
 			manifest = bosh.BoshManifest{
+				Name: "some-instance-id",
 				InstanceGroups: []bosh.InstanceGroup{
 					bosh.InstanceGroup{
 						Properties: map[string]interface{}{
@@ -63,8 +66,7 @@ var _ = Describe("Binding", func() {
 				}
 				binding, err := binder.CreateBinding(bindingID, topology, manifest, params, resolvedSecrets, serviceadapter.DNSAddresses{})
 				if expectedErr != nil {
-					Expect(err).To(HaveOccurred())
-					Expect(err.Error()).To(Equal(expectedErr.Error()))
+					Expect(err).To(matchAdapterError(adapter.ContactOperatorMessage, Equal("deployment some-instance-id: "+expectedErr.Error())))
 					return
 				}
 				Expect(err).NotTo(HaveOccurred())
@@ -75,12 +77,90 @@ var _ = Describe("Binding", func() {
 			Entry("without secrets in the manifest", "", nil, "", nil),
 			Entry("with ((secret)) resolved by the broker", "((secret))", secretsMap(defaultMap(), "((secret))", "g1"), "g1", nil),
 			Entry("with ((foo)) not resolved by the broker", "((foo))", defaultMap(), "", errors.New("manifest wasn't correctly interpolated: missing value for `((foo))`")),
-			Entry("with malformed path: (())", "(())", defaultMap(), "", errors.New("expecting a credhub ref string with format ((xxx)), but got: (())")),
-			Entry("with malformed path: foo", "foo", defaultMap(), "", errors.New("expecting a credhub ref string with format ((xxx)), but got: foo")),
+			Entry("with malformed path: (())", "(())", defaultMap(), "", errors.New("expecting a credhub ref string with format ((xxx)) for 'secret', but got a literal value")),
+			Entry("with malformed path: foo", "foo", defaultMap(), "", errors.New("expecting a credhub ref string with format ((xxx)) for 'secret', but got a literal value")),
 			Entry("with secret_pass not being interpolated", "", serviceadapter.ManifestSecrets{}, "", errors.New("manifest wasn't correctly interpolated: missing value for `(("+adapter.GeneratedSecretKey+"))`")),
+			Entry("with ((secret)) resolved to an empty value", "((secret))", secretsMap(defaultMap(), "((secret))", ""), "", errors.New("secret '((secret))' resolved to an empty value")),
 			Entry("with managed_secret not being interpolated", "", serviceadapter.ManifestSecrets{path(adapter.GeneratedSecretKey): "p1"}, "", errors.New("manifest wasn't correctly interpolated: missing value for `(("+adapter.ManagedSecretKey+"))`")),
 		)
 
+		Describe("previewing the credential keys", func() {
+			redisProperties := func() map[interface{}]interface{} {
+				return manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})
+			}
+
+			DescribeTable("lists exactly the keys CreateBinding returns",
+				func(configure func()) {
+					configure()
+					binding, err := binder.CreateBinding(bindingID, topology, manifest, params, defaultMap(), nil)
+					Expect(err).NotTo(HaveOccurred())
+
+					var bindingKeys []string
+					for key := range binding.Credentials {
+						bindingKeys = append(bindingKeys, key)
+					}
+					sort.Strings(bindingKeys)
+					Expect(binder.BindingCredentialKeys(manifest, serviceadapter.Plan{})).To(Equal(bindingKeys))
+				},
+				Entry("for a default instance", func() {}),
+				Entry("with a binding TTL", func() {
+					redisProperties()[adapter.BindingTTLSecondsPropertyKey] = 3600
+				}),
+				Entry("for a shareable instance", func() {
+					redisProperties()[adapter.ShareablePropertyKey] = true
+				}),
+				Entry("with a TLS port", func() {
+					redisProperties()[adapter.TLSPortKey] = 6380
+				}),
+				Entry("in cluster mode", func() {
+					redisProperties()[adapter.ClusterEnabledKey] = "yes"
+				}),
+				Entry("with a unix socket", func() {
+					redisProperties()[adapter.UnixSocketKey] = "/var/vcap/sys/run/redis/redis.sock"
+				}),
+				Entry("with the metrics job colocated", func() {
+					manifest.InstanceGroups[0].Jobs = []bosh.Job{{Name: "redis-server"}, {Name: adapter.MetricsJobName}}
+				}),
+			)
+
+			It("falls back to the plan when the instance has not been deployed", func() {
+				plan := serviceadapter.Plan{Properties: serviceadapter.Properties{
+					adapter.ShareablePropertyKey:         true,
+					adapter.BindingTTLSecondsPropertyKey: 3600,
+				}}
+				keys := binder.BindingCredentialKeys(bosh.BoshManifest{}, plan)
+				Expect(keys).To(ContainElement("hosts"))
+				Expect(keys).To(ContainElement("ttl_seconds"))
+				Expect(keys).To(ContainElement("password"))
+			})
+		})
+
+		Describe("binding with the password stored as an ODB-managed secret", func() {
+			const passwordPath = "((/odb/redis/some-instance-id/redis-password))"
+
+			BeforeEach(func() {
+				manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["password"] = passwordPath
+			})
+
+			It("returns the resolved password", func() {
+				binding, err := binder.CreateBinding(bindingID, topology, manifest, params, secretsMap(defaultMap(), passwordPath, "resolved-password"), nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Credentials["password"]).To(Equal("resolved-password"))
+			})
+
+			It("returns an error when the broker did not resolve the password", func() {
+				_, err := binder.CreateBinding(bindingID, topology, manifest, params, defaultMap(), nil)
+				Expect(err).To(matchAdapterError(adapter.ContactOperatorMessage, Equal("deployment some-instance-id: manifest wasn't correctly interpolated: missing value for `"+passwordPath+"`")))
+			})
+
+			It("still returns a literal password from an older manifest", func() {
+				manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["password"] = "supersecret"
+				binding, err := binder.CreateBinding(bindingID, topology, manifest, params, defaultMap(), nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Credentials["password"]).To(Equal("supersecret"))
+			})
+		})
+
 		Describe("binding with DNS", func() {
 			It("produces a binding containing a DNS address", func() {
 				dnsAddresses := serviceadapter.DNSAddresses{"config-1": "this.is.a.dns.address"}
@@ -91,6 +171,134 @@ var _ = Describe("Binding", func() {
 				Expect(s).To(Equal(dnsAddresses))
 			})
 		})
+
+		Describe("binding with a TTL", func() {
+			It("includes ttl_seconds when the manifest sets a binding TTL", func() {
+				properties := manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})
+				properties[adapter.BindingTTLSecondsPropertyKey] = 3600
+
+				binding, err := binder.CreateBinding(bindingID, topology, manifest, params, defaultMap(), serviceadapter.DNSAddresses{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Credentials["ttl_seconds"]).To(Equal(3600))
+			})
+
+			It("omits ttl_seconds when the manifest does not set a binding TTL", func() {
+				binding, err := binder.CreateBinding(bindingID, topology, manifest, params, defaultMap(), serviceadapter.DNSAddresses{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Credentials).NotTo(HaveKey("ttl_seconds"))
+			})
+		})
+
+		Describe("binding with metrics", func() {
+			It("includes the metrics endpoint when the metrics job is colocated", func() {
+				manifest.InstanceGroups[0].Jobs = []bosh.Job{
+					{Name: "redis-server"},
+					{Name: adapter.MetricsJobName},
+				}
+
+				binding, err := binder.CreateBinding(bindingID, topology, manifest, params, defaultMap(), serviceadapter.DNSAddresses{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Credentials["metrics"]).To(Equal(map[string]interface{}{
+					"host": "127.0.0.1",
+					"port": adapter.DefaultMetricsPort,
+					"path": adapter.DefaultMetricsPath,
+				}))
+			})
+
+			It("uses the port and path configured on the metrics job", func() {
+				manifest.InstanceGroups[0].Jobs = []bosh.Job{
+					{Name: adapter.MetricsJobName, Properties: map[string]interface{}{"port": 9200, "path": "/prometheus"}},
+				}
+
+				binding, err := binder.CreateBinding(bindingID, topology, manifest, params, defaultMap(), serviceadapter.DNSAddresses{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Credentials["metrics"]).To(Equal(map[string]interface{}{
+					"host": "127.0.0.1",
+					"port": 9200,
+					"path": "/prometheus",
+				}))
+			})
+
+			It("omits the metrics object when no metrics job is present", func() {
+				manifest.InstanceGroups[0].Jobs = []bosh.Job{{Name: "redis-server"}}
+
+				binding, err := binder.CreateBinding(bindingID, topology, manifest, params, defaultMap(), serviceadapter.DNSAddresses{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Credentials).NotTo(HaveKey("metrics"))
+			})
+		})
+
+		Describe("binding with TLS", func() {
+			It("includes tls_port and ca_certificate when the manifest sets a tls-port", func() {
+				properties := manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})
+				properties[adapter.TLSPortKey] = 6380
+
+				binding, err := binder.CreateBinding(bindingID, topology, manifest, params, defaultMap(), serviceadapter.DNSAddresses{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Credentials["port"]).To(Equal(adapter.RedisServerPort))
+				Expect(binding.Credentials["tls_port"]).To(Equal(6380))
+				Expect(binding.Credentials["tls_enabled"]).To(Equal(true))
+				Expect(binding.Credentials["ca_certificate"]).To(Equal("ca-val"))
+				Expect(binding.Credentials).NotTo(HaveKey("ca_cert"))
+			})
+
+			It("returns a CA written inline in the manifest", func() {
+				inlineCA := "-----BEGIN CERTIFICATE-----\nMIIB...\n-----END CERTIFICATE-----\n"
+				properties := manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})
+				properties[adapter.TLSPortKey] = 6380
+				properties["ca_cert"] = inlineCA
+
+				for _, secrets := range []serviceadapter.ManifestSecrets{defaultMap(), nil} {
+					binding, err := binder.CreateBinding(bindingID, topology, manifest, params, secrets, serviceadapter.DNSAddresses{})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(binding.Credentials["ca_certificate"]).To(Equal(inlineCA))
+				}
+			})
+
+			DescribeTable("omits tls_port and ca_certificate when tls-port is not set",
+				func(tlsPort interface{}) {
+					properties := manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})
+					if tlsPort != nil {
+						properties[adapter.TLSPortKey] = tlsPort
+					}
+
+					binding, err := binder.CreateBinding(bindingID, topology, manifest, params, defaultMap(), serviceadapter.DNSAddresses{})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(binding.Credentials).NotTo(HaveKey("tls_port"))
+					Expect(binding.Credentials).NotTo(HaveKey("ca_certificate"))
+					Expect(binding.Credentials["tls_enabled"]).To(Equal(false))
+				},
+				Entry("absent", nil),
+				Entry("zero", 0),
+			)
+
+			It("returns a generic error when tls-port is set but the CA certificate was not resolved", func() {
+				properties := manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})
+				properties[adapter.TLSPortKey] = 6380
+
+				_, err := binder.CreateBinding(bindingID, topology, manifest, params, nil, serviceadapter.DNSAddresses{})
+				Expect(err).To(matchAdapterError(
+					adapter.ContactOperatorMessage,
+					Equal("deployment some-instance-id: tls-port is set to 6380 but the CA certificate '((instance_certificate.ca))' was not resolved"),
+				))
+			})
+
+			It("reports TLS as disabled for a plan without TLS, even though the manifest references a certificate", func() {
+				binding, err := binder.CreateBinding(bindingID, topology, manifest, params, defaultMap(), serviceadapter.DNSAddresses{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Credentials["tls_enabled"]).To(Equal(false))
+			})
+
+			It("reports TLS as disabled when the manifest does not configure a certificate", func() {
+				properties := manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})
+				delete(properties, "certificate")
+				delete(properties, "private_key")
+
+				binding, err := binder.CreateBinding(bindingID, topology, manifest, params, nil, serviceadapter.DNSAddresses{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Credentials["tls_enabled"]).To(Equal(false))
+			})
+		})
 	})
 
 	Describe("Delete Binding", func() {
@@ -165,9 +373,13 @@ var _ = Describe("Binding", func() {
 		BeforeEach(func() {
 			boshVMs = bosh.BoshVMs{"redis-server": []string{"an-ip"}}
 			currentManifest = bosh.BoshManifest{
+				Name: "some-instance-id",
 				InstanceGroups: []bosh.InstanceGroup{
 					{
-						Properties: map[string]interface{}{"redis": map[interface{}]interface{}{"password": expectedPassword}},
+						Properties: map[string]interface{}{"redis": map[interface{}]interface{}{
+							"password":                         expectedPassword,
+							adapter.PropertiesSchemaVersionKey: adapter.CurrentPropertiesSchemaVersion,
+						}},
 					},
 				},
 			}
@@ -190,34 +402,436 @@ var _ = Describe("Binding", func() {
 				Expect(actualBinding.Credentials["password"]).To(Equal(expectedPassword))
 			})
 
-			It("returns the host from the vms", func() {
+			It("returns the host from the vms when the manifest does not set a bind hostname", func() {
 				Expect(actualBinding.Credentials["host"]).To(Equal("an-ip"))
 			})
 		})
 
+		DescribeTable("a JSON credentials bundle",
+			func(requestParams serviceadapter.RequestParameters, expectBundle bool) {
+				binding, err := binder.CreateBinding("not-relevant", boshVMs, currentManifest, requestParams, nil, nil)
+				Expect(err).NotTo(HaveOccurred())
+				if !expectBundle {
+					Expect(binding.Credentials).NotTo(HaveKey(adapter.CredentialsJSONKey))
+					return
+				}
+
+				Expect(binding.Credentials).To(HaveKey(adapter.CredentialsJSONKey))
+				var bundle map[string]interface{}
+				Expect(json.Unmarshal([]byte(binding.Credentials[adapter.CredentialsJSONKey].(string)), &bundle)).To(Succeed())
+				Expect(bundle).NotTo(HaveKey(adapter.CredentialsJSONKey))
+				Expect(bundle).To(HaveKeyWithValue("host", "an-ip"))
+				Expect(bundle).To(HaveKeyWithValue("password", expectedPassword))
+				Expect(bundle).To(HaveLen(len(binding.Credentials) - 1))
+			},
+			Entry("is not added for cloudfoundry", serviceadapter.RequestParameters{
+				"context": map[string]interface{}{"platform": "cloudfoundry"},
+			}, false),
+			Entry("is added for kubernetes", serviceadapter.RequestParameters{
+				"context": map[string]interface{}{"platform": "kubernetes"},
+			}, true),
+			Entry("is added when the platform is not known", nil, true),
+		)
+
+		Context("the redis properties schema version", func() {
+			It("is not warned about when the manifest carries the current version", func() {
+				Expect(actualBindingErr).NotTo(HaveOccurred())
+				Expect(string(stderr.Contents())).NotTo(ContainSubstring(adapter.PropertiesSchemaVersionKey))
+			})
+
+			It("is warned about when the manifest has no version, and the binding still succeeds", func() {
+				delete(currentManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{}), adapter.PropertiesSchemaVersionKey)
+				binding, err := binder.CreateBinding("not-relevant", boshVMs, currentManifest, nil, nil, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Credentials["password"]).To(Equal(expectedPassword))
+				Expect(stderr).To(gbytes.Say("the manifest has no redis properties_schema_version, it was generated by an older adapter and the instance may need an update-deploy"))
+			})
+
+			It("is warned about when the manifest carries an older version, and the binding still succeeds", func() {
+				currentManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})[adapter.PropertiesSchemaVersionKey] = adapter.CurrentPropertiesSchemaVersion - 1
+				_, err := binder.CreateBinding("not-relevant", boshVMs, currentManifest, nil, nil, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(stderr.Contents())).To(ContainSubstring("properties_schema_version"))
+			})
+		})
+
+		Context("when the manifest sets a bind hostname", func() {
+			BeforeEach(func() {
+				currentManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})[adapter.BindHostnameKey] = "redis.example.com"
+			})
+
+			It("returns the hostname instead of the IP", func() {
+				Expect(actualBindingErr).NotTo(HaveOccurred())
+				Expect(actualBinding.Credentials["host"]).To(Equal("redis.example.com"))
+			})
+
+			It("returns an error when the hostname is empty", func() {
+				currentManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})[adapter.BindHostnameKey] = " "
+				_, err := binder.CreateBinding("not-relevant", boshVMs, currentManifest, nil, nil, nil)
+				Expect(err).To(matchAdapterError(
+					adapter.ContactOperatorMessage,
+					Equal("deployment some-instance-id: error reading the manifest: invalid value for manifest property 'bind_hostname':  , must be a non-empty string"),
+				))
+			})
+
+			It("returns an error when the hostname is not a string", func() {
+				currentManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})[adapter.BindHostnameKey] = 42
+				_, err := binder.CreateBinding("not-relevant", boshVMs, currentManifest, nil, nil, nil)
+				Expect(err).To(matchAdapterError(
+					adapter.ContactOperatorMessage,
+					Equal("deployment some-instance-id: error reading the manifest: invalid value for manifest property 'bind_hostname': 42, must be a non-empty string"),
+				))
+			})
+		})
+
+		Context("when the manifest sets the redis port", func() {
+			BeforeEach(func() {
+				currentManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["port"] = 6380
+			})
+
+			It("returns the port from the manifest", func() {
+				Expect(actualBindingErr).NotTo(HaveOccurred())
+				Expect(actualBinding.Credentials["port"]).To(Equal(6380))
+			})
+		})
+
+		It("returns the default redis port when the manifest does not set one", func() {
+			Expect(actualBinding.Credentials["port"]).To(Equal(adapter.RedisServerPort))
+		})
+
+		Context("when the json log format is configured", func() {
+			BeforeEach(func() {
+				binder.LogFormat = adapter.LogFormatJSON
+			})
+
+			It("logs events as JSON objects tagged with the deployment and operation", func() {
+				event := map[string]interface{}{}
+				Expect(json.Unmarshal(stderr.Contents(), &event)).To(Succeed())
+				Expect(event).To(And(
+					HaveKeyWithValue("level", adapter.LogLevelInfo),
+					HaveKeyWithValue("msg", "Non Cloud Foundry platform (or pre OSBAPI 2.13) detected"),
+					HaveKeyWithValue("deployment", "some-instance-id"),
+					HaveKeyWithValue("operation", "create-binding"),
+					HaveKey("timestamp"),
+				))
+			})
+		})
+
+		Context("when a replica binding is requested", func() {
+			var requestParams serviceadapter.RequestParameters
+
+			BeforeEach(func() {
+				requestParams = serviceadapter.RequestParameters{
+					"parameters": map[string]interface{}{adapter.BindingRoleKey: adapter.BindingRoleReplica},
+				}
+				boshVMs[adapter.ReplicaInstanceGroupName] = []string{"replica-ip"}
+			})
+
+			It("returns the host of a replica", func() {
+				binding, err := binder.CreateBinding("not-relevant", boshVMs, currentManifest, requestParams, nil, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Credentials["host"]).To(Equal("replica-ip"))
+			})
+
+			It("returns the master port for replicas that do not set their own", func() {
+				binding, err := binder.CreateBinding("not-relevant", boshVMs, currentManifest, requestParams, nil, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Credentials["port"]).To(Equal(adapter.RedisServerPort))
+				Expect(binding.Credentials["uri"]).To(Equal("redis://:" + expectedPassword + "@replica-ip:6379"))
+			})
+
+			Context("when the replicas listen on a port of their own", func() {
+				BeforeEach(func() {
+					currentManifest.InstanceGroups[0].Name = "redis-server"
+					currentManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["port"] = 6400
+					currentManifest.InstanceGroups = append(currentManifest.InstanceGroups, bosh.InstanceGroup{
+						Name:       adapter.ReplicaInstanceGroupName,
+						Properties: map[string]interface{}{"redis": map[interface{}]interface{}{"port": 6401}},
+					})
+				})
+
+				It("returns the replica port in port and uri", func() {
+					binding, err := binder.CreateBinding("not-relevant", boshVMs, currentManifest, requestParams, nil, nil)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(binding.Credentials["port"]).To(Equal(6401))
+					Expect(binding.Credentials["uri"]).To(Equal("redis://:" + expectedPassword + "@replica-ip:6401"))
+				})
+
+				It("keeps the master port for a master binding", func() {
+					requestParams["parameters"] = map[string]interface{}{adapter.BindingRoleKey: adapter.BindingRoleMaster}
+					binding, err := binder.CreateBinding("not-relevant", boshVMs, currentManifest, requestParams, nil, nil)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(binding.Credentials["port"]).To(Equal(6400))
+					Expect(binding.Credentials["uri"]).To(Equal("redis://:" + expectedPassword + "@an-ip:6400"))
+				})
+
+				It("keeps the master port when falling back to the master", func() {
+					delete(boshVMs, adapter.ReplicaInstanceGroupName)
+					binding, err := binder.CreateBinding("not-relevant", boshVMs, currentManifest, requestParams, nil, nil)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(binding.Credentials["port"]).To(Equal(6400))
+				})
+			})
+
+			It("returns the host of the master when the master role is requested", func() {
+				requestParams["parameters"] = map[string]interface{}{adapter.BindingRoleKey: adapter.BindingRoleMaster}
+				binding, err := binder.CreateBinding("not-relevant", boshVMs, currentManifest, requestParams, nil, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Credentials["host"]).To(Equal("an-ip"))
+			})
+
+			It("falls back to the master with a warning when no replicas are deployed", func() {
+				delete(boshVMs, adapter.ReplicaInstanceGroupName)
+				binding, err := binder.CreateBinding("not-relevant", boshVMs, currentManifest, requestParams, nil, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Credentials["host"]).To(Equal("an-ip"))
+				Expect(stderr).To(gbytes.Say("replica binding requested but no replicas are deployed, falling back to master"))
+			})
+
+			It("returns an error for an unknown role", func() {
+				requestParams["parameters"] = map[string]interface{}{adapter.BindingRoleKey: "sentinel"}
+				_, err := binder.CreateBinding("not-relevant", boshVMs, currentManifest, requestParams, nil, nil)
+				Expect(err).To(matchAdapterError(
+					"invalid value for parameter 'role': sentinel, must be one of master, replica",
+					Equal("deployment some-instance-id: invalid value for parameter 'role': sentinel, must be one of master, replica"),
+				))
+			})
+		})
+
+		Context("when the manifest was decoded from JSON", func() {
+			BeforeEach(func() {
+				currentManifest = bosh.BoshManifest{
+					InstanceGroups: []bosh.InstanceGroup{
+						{Name: "redis-server", Properties: map[string]interface{}{"redis": map[string]interface{}{"password": expectedPassword}}},
+					},
+				}
+			})
+
+			It("returns the password from the manifest", func() {
+				Expect(actualBindingErr).NotTo(HaveOccurred())
+				Expect(actualBinding.Credentials["password"]).To(Equal(expectedPassword))
+			})
+		})
+
+		Context("when the redis properties are scoped to the job", func() {
+			BeforeEach(func() {
+				currentManifest = bosh.BoshManifest{
+					InstanceGroups: []bosh.InstanceGroup{{
+						Name: "redis-server",
+						Jobs: []bosh.Job{{
+							Name:       "redis-server",
+							Properties: map[string]interface{}{"redis": map[interface{}]interface{}{"password": expectedPassword}},
+						}},
+					}},
+				}
+			})
+
+			It("returns the password from the job", func() {
+				Expect(actualBindingErr).NotTo(HaveOccurred())
+				Expect(actualBinding.Credentials["password"]).To(Equal(expectedPassword))
+			})
+		})
+
+		Context("when the manifest has no redis properties", func() {
+			BeforeEach(func() {
+				currentManifest = bosh.BoshManifest{Name: "some-instance-id"}
+			})
+
+			It("logs an error for the operator", func() {
+				Expect(actualBindingErr).To(MatchError(adapter.ContactOperatorMessage))
+				Expect(stderr).To(gbytes.Say("deployment some-instance-id: error reading the manifest: no instance group with redis properties found in manifest some-instance-id"))
+			})
+
+			It("logs the manifest without leaking secrets", func() {
+				currentManifest.InstanceGroups = []bosh.InstanceGroup{{
+					Name: "redis-server",
+					Properties: map[string]interface{}{
+						"syslog": map[interface{}]interface{}{"address": "logs.example.com", "password": "syslog-passw0rd"},
+						"backup": map[interface{}]interface{}{"destination": "s3://bucket?key=resolved-credhub-value"},
+					},
+				}}
+				secrets := serviceadapter.ManifestSecrets{"((/backup/key))": "resolved-credhub-value"}
+
+				_, err := binder.CreateBinding("not-relevant", boshVMs, currentManifest, nil, secrets, nil)
+
+				Expect(err).To(MatchError(adapter.ContactOperatorMessage))
+				Expect(stderr).To(gbytes.Say("could not read the redis properties from the manifest"))
+				Expect(stderr).To(gbytes.Say("logs.example.com"))
+				Expect(string(stderr.Contents())).NotTo(ContainSubstring("syslog-passw0rd"))
+				Expect(string(stderr.Contents())).NotTo(ContainSubstring("resolved-credhub-value"))
+				Expect(string(stderr.Contents())).To(ContainSubstring("password: '***'"))
+				Expect(string(stderr.Contents())).To(ContainSubstring("s3://bucket?key=***"))
+			})
+		})
+
+		Context("when a secret field holds a literal value instead of a credhub ref", func() {
+			BeforeEach(func() {
+				currentManifest.InstanceGroups[0].Properties["redis"] = map[interface{}]interface{}{
+					"password":                 expectedPassword,
+					adapter.GeneratedSecretKey: expectedPassword,
+				}
+			})
+
+			It("logs the error without the value", func() {
+				_, err := binder.CreateBinding("not-relevant", boshVMs, currentManifest, nil, serviceadapter.ManifestSecrets{}, nil)
+
+				Expect(err).To(MatchError(adapter.ContactOperatorMessage))
+				Expect(stderr).To(gbytes.Say("expecting a credhub ref string with format \\(\\(xxx\\)\\) for '" + adapter.GeneratedSecretKey + "', but got a literal value"))
+				Expect(string(stderr.Contents())).NotTo(ContainSubstring(expectedPassword))
+			})
+
+			It("masks the manifest password outside of the password field", func() {
+				currentManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["maxclients"] = "lots"
+				currentManifest.InstanceGroups[0].Properties["syslog"] = map[interface{}]interface{}{"address": expectedPassword + "@logs.example.com"}
+
+				_, err := binder.CreateBinding("not-relevant", boshVMs, currentManifest, nil, serviceadapter.ManifestSecrets{}, nil)
+
+				Expect(err).To(MatchError(adapter.ContactOperatorMessage))
+				Expect(stderr).To(gbytes.Say("could not read the redis properties from the manifest"))
+				Expect(stderr).To(gbytes.Say(`address: '\*\*\*@logs.example.com'`))
+				Expect(string(stderr.Contents())).NotTo(ContainSubstring(expectedPassword))
+			})
+		})
+
 		Context("when the bosh vms don't have redis-server", func() {
 			BeforeEach(func() {
 				boshVMs = bosh.BoshVMs{"redis-server1": []string{"an-ip"}}
 			})
 			It("returns an error for the cli user", func() {
 				Expect(actualBindingErr).To(HaveOccurred())
-				Expect(actualBindingErr).To(MatchError(""))
+				Expect(actualBindingErr).To(MatchError(adapter.ContactOperatorMessage))
 			})
 			It("logs an error for the operator", func() {
-				Expect(stderr).To(gbytes.Say("expected redis-server instance group to have only 1 instance, got 0"))
+				Expect(stderr).To(gbytes.Say(`deployment some-instance-id: no redis-server instance group in the Redis deployment, found: redis-server1 \(1 instances\)`))
 			})
 		})
 
-		Context("when the bosh vms has a redis-server key, but it has no instances", func() {
+		Context("when the bosh vms contain errand groups alongside redis-server", func() {
 			BeforeEach(func() {
+				boshVMs = bosh.BoshVMs{
+					"redis-server": []string{"an-ip"},
+					"health-check": []string{"errand-ip"},
+					"cleanup-data": []string{},
+				}
+			})
+			It("returns the host of the redis-server instance", func() {
+				Expect(actualBindingErr).NotTo(HaveOccurred())
+				Expect(actualBinding.Credentials["host"]).To(Equal("an-ip"))
+			})
+		})
+
+		Context("when the redis instance group name is configured", func() {
+			BeforeEach(func() {
+				binder.Config.RedisInstanceGroupName = "redis"
+				boshVMs = bosh.BoshVMs{"redis": []string{"configured-ip"}}
+			})
+			It("returns the host of the configured instance group", func() {
+				Expect(actualBindingErr).NotTo(HaveOccurred())
+				Expect(actualBinding.Credentials["host"]).To(Equal("configured-ip"))
+			})
+		})
+
+		Context("when the plan is shareable", func() {
+			BeforeEach(func() {
+				currentManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})[adapter.ShareablePropertyKey] = true
+				boshVMs = bosh.BoshVMs{"redis-server": []string{"an-ip", "another-ip"}}
+			})
+
+			It("returns every redis instance as hosts", func() {
+				Expect(actualBindingErr).NotTo(HaveOccurred())
+				Expect(actualBinding.Credentials["host"]).To(Equal("an-ip"))
+				Expect(actualBinding.Credentials["hosts"]).To(Equal([]string{"an-ip", "another-ip"}))
+			})
+
+			It("returns an error when there are no redis instances", func() {
 				boshVMs = bosh.BoshVMs{"redis-server": []string{}}
+				_, err := binder.CreateBinding("not-relevant", boshVMs, currentManifest, nil, nil, nil)
+				Expect(err).To(matchAdapterError(
+					adapter.ContactOperatorMessage,
+					Equal("deployment some-instance-id: expected redis-server instance group to have at least 1 instance, got 0; found: redis-server (0 instances)"),
+				))
+			})
+		})
+
+		Context("when the instance runs in cluster mode", func() {
+			BeforeEach(func() {
+				currentManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})[adapter.ClusterEnabledKey] = "yes"
+				boshVMs = bosh.BoshVMs{"redis-server": []string{"10.0.0.3", "10.0.0.1", "10.0.0.2"}}
+			})
+
+			It("returns the nodes as a connection string", func() {
+				Expect(actualBindingErr).NotTo(HaveOccurred())
+				Expect(actualBinding.Credentials["cluster"]).To(BeTrue())
+				Expect(actualBinding.Credentials["cluster_nodes"]).To(Equal("10.0.0.1:6379,10.0.0.2:6379,10.0.0.3:6379"))
+			})
+
+			It("lists the nodes in the same order whatever order the VMs are reported in", func() {
+				reordered := bosh.BoshVMs{"redis-server": []string{"10.0.0.2", "10.0.0.3", "10.0.0.1"}}
+				binding, err := binder.CreateBinding("not-relevant", reordered, currentManifest, nil, nil, nil)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Credentials["cluster_nodes"]).To(Equal(actualBinding.Credentials["cluster_nodes"]))
+			})
+
+			It("uses the configured redis port", func() {
+				currentManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["port"] = 6400
+				binding, err := binder.CreateBinding("not-relevant", boshVMs, currentManifest, nil, nil, nil)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Credentials["cluster_nodes"]).To(Equal("10.0.0.1:6400,10.0.0.2:6400,10.0.0.3:6400"))
+			})
+		})
+
+		Context("when the instance does not run in cluster mode", func() {
+			It("omits the cluster credentials", func() {
+				Expect(actualBindingErr).NotTo(HaveOccurred())
+				Expect(actualBinding.Credentials).NotTo(HaveKey("cluster"))
+				Expect(actualBinding.Credentials).NotTo(HaveKey("cluster_nodes"))
+			})
+		})
+
+		Context("when the instance listens on a unix socket", func() {
+			BeforeEach(func() {
+				currentManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})[adapter.UnixSocketKey] = "/var/vcap/sys/run/redis/redis.sock"
+			})
+
+			It("returns the socket path", func() {
+				Expect(actualBindingErr).NotTo(HaveOccurred())
+				Expect(actualBinding.Credentials).To(HaveKeyWithValue("socket", "/var/vcap/sys/run/redis/redis.sock"))
+			})
+		})
+
+		Context("when the instance has no unix socket", func() {
+			It("omits the socket credential", func() {
+				Expect(actualBindingErr).NotTo(HaveOccurred())
+				Expect(actualBinding.Credentials).NotTo(HaveKey("socket"))
+			})
+		})
+
+		Context("when the plan is not shareable and there are several redis instances", func() {
+			BeforeEach(func() {
+				boshVMs = bosh.BoshVMs{"redis-server": []string{"an-ip", "another-ip"}}
+			})
+
+			It("explains that the plan must have exactly one instance", func() {
+				Expect(actualBindingErr).To(matchAdapterError(
+					adapter.ContactOperatorMessage,
+					Equal("deployment some-instance-id: expected redis-server instance group to have only 1 instance, got 2, plans that are not shareable must have exactly one instance; found: redis-server (2 instances)"),
+				))
+				Expect(actualBinding.Credentials).NotTo(HaveKey("hosts"))
+			})
+		})
+
+		Context("when the bosh vms has a redis-server key, but it has no instances", func() {
+			BeforeEach(func() {
+				boshVMs = bosh.BoshVMs{"redis-server": []string{}, "health-check": []string{"errand-ip"}}
 			})
 			It("returns an error for the cli user", func() {
 				Expect(actualBindingErr).To(HaveOccurred())
-				Expect(actualBindingErr).To(MatchError(""))
+				Expect(actualBindingErr).To(MatchError(adapter.ContactOperatorMessage))
 			})
 			It("logs an error for the operator", func() {
-				Expect(stderr).To(gbytes.Say("expected redis-server instance group to have only 1 instance, got 0"))
+				Expect(stderr).To(gbytes.Say(`deployment some-instance-id: expected redis-server instance group to have only 1 instance, got 0, plans that are not shareable must have exactly one instance; found: health-check \(1 instances\), redis-server \(0 instances\)`))
 			})
 		})
 
@@ -227,10 +841,10 @@ var _ = Describe("Binding", func() {
 			})
 			It("returns an error for the cli user", func() {
 				Expect(actualBindingErr).To(HaveOccurred())
-				Expect(actualBindingErr).To(MatchError(""))
+				Expect(actualBindingErr).To(MatchError(adapter.ContactOperatorMessage))
 			})
 			It("logs an error for the operator", func() {
-				Expect(stderr).To(gbytes.Say("expected 1 instance group in the Redis deployment, got 0"))
+				Expect(stderr).To(gbytes.Say("deployment some-instance-id: no redis-server instance group in the Redis deployment, found: no instance groups"))
 			})
 		})
 
@@ -2,11 +2,16 @@ package adapter
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
-	"errors"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"log"
+	"math"
+	"net"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -17,28 +22,243 @@ import (
 
 const (
 	RedisServerPersistencePropertyKey = "persistence"
+	PersistentDiskSizesPropertyKey    = "persistent_disk_sizes"
+	AcceptDataLossKey                 = "accept_data_loss"
+	PlanNamePropertyKey               = "plan_name"
+	MigratableFromPropertyKey         = "migratable_from"
+	ForcePlanChangeKey                = "force_plan_change"
+	DrainTimeoutPropertyKey           = "drain_timeout"
+	AgentDrainTimeoutPropertyKey      = "drain_timeout_seconds"
+	MaxInstancesPropertyKey           = "max_instances"
+	MinimumPreviousReleaseVersionKey  = "minimum_previous_release_version"
+	RedisReleaseNamePropertyKey       = "redis_release_name"
+	RedisJobNamePropertyKey           = "redis_job_name"
+	PropertyScopePropertyKey          = "property_scope"
+	PropertyScopeJob                  = "job"
+	PropertyScopeInstanceGroup        = "instance_group"
+	SystemdOverridesPropertyKey       = "systemd_overrides"
+	JobEnvVarsPropertyKey             = "job_env_vars"
+	RedisConfSnippetPropertyKey       = "redis_conf_snippet"
+	ReleaseStemcellOverridesKey       = "release_stemcell_overrides"
+	ReservedEnvVarPrefix              = "REDIS_"
+	BindingTTLSecondsPropertyKey      = "binding_ttl_seconds"
+	UpgradeCheckModePropertyKey       = "upgrade_check_mode"
+	UpgradeCheckModeEnforce           = "enforce"
+	UpgradeCheckModeWarn              = "warn"
+	UpgradeStrategyPropertyKey        = "upgrade_strategy"
+	UpgradeStrategyRolling            = "rolling"
+	UpgradeStrategyCanary             = "canary"
+	UpgradeStrategyOneAtATime         = "one-at-a-time"
+	EncodingLimitsKey                 = "encoding_limits"
+	ExportedAsPropertyKey             = "exported_as"
+	MaxMemoryKey                      = "maxmemory"
+	MaxMemoryLimitPropertyKey         = "maxmemory_limit"
+	EvictionTenacityKey               = "maxmemory-eviction-tenacity"
+	MaxEvictionTenacity               = 100
+	MaxClientsMinPropertyKey          = "maxclients_min"
+	MaxClientsMaxPropertyKey          = "maxclients_max"
+	HzKey                             = "hz"
+	DynamicHzKey                      = "dynamic-hz"
+	ActiveRehashingKey                = "activerehashing"
+	ReplBacklogSizeKey                = "repl-backlog-size"
+	ReplTimeoutKey                    = "repl-timeout"
+	RedisLogLevelKey                  = "loglevel"
+	DefaultLogLevelPropertyKey        = "default_loglevel"
+	UnixSocketKey                     = "unixsocket"
+	UnixSocketPermKey                 = "unixsocketperm"
+	MaintenanceModeKey                = "maintenance_mode"
+	RequirePassKey                    = "requirepass"
+	MaintenanceBindAddress            = "127.0.0.1"
+	MinHz                             = 1
+	MaxHz                             = 500
+	CoLocateJobsPropertyKey           = "co_locate_jobs"
+	ConsumesRedisLinkKey              = "consumes_redis"
+	StaticIPsPropertyKey              = "static_ips"
+	DefaultNetworkPropertyKey         = "default_network"
+	IPv6EnabledPropertyKey            = "ipv6_enabled"
+	ProtectedModePropertyKey          = "protected_mode"
+	ProtectedModeKey                  = "protected-mode"
+	AuthRequiredPropertyKey           = "auth_required"
+	IKnowWhatIAmDoingPropertyKey      = "i_know_what_i_am_doing"
+	TLSEnabledPropertyKey             = "tls_enabled"
+	TLSClientCertificateKey           = "client_certificate"
+	TLSClientPrivateKeyKey            = "client_private_key"
+	PreStartScriptPropertyKey         = "pre_start_script"
+	StrictPropertiesKey               = "strict_properties"
+	DiscardUnmanagedPropertiesKey     = "discard_unmanaged_properties"
+	NTPServersPropertyKey             = "ntp_servers"
+	DashboardDomainPropertyKey        = "dashboard_domain"
+	ShareablePropertyKey              = "shareable"
+	ClusterEnabledPropertyKey         = "cluster_enabled"
+	ClusterEnabledKey                 = "cluster-enabled"
+	DeploymentOrderPropertyKey        = "deployment_order"
+	AutoScalingPropertyKey            = "auto_scaling"
+	DashboardRouteTagKey              = "dashboard_route"
+	ProductTagKey                     = "product"
+	TagsPropertyKey                   = "tags"
+	AdapterVersionTagKey              = "adapter_version"
+	RedisReleaseVersionTagKey         = "redis_release_version"
+	DeploymentNamePrefix              = "service-instance_"
+	MaxDrainTimeoutSeconds            = 3600
+	DefaultAgentDrainTimeoutSeconds   = 300
 	RedisServerPort                   = 6379
+	RedisServerTLSPort                = 6380
 	RedisJobName                      = "redis-server"
 	HealthCheckErrandName             = "health-check"
 	CleanupDataErrandName             = "cleanup-data"
 	TrainingInsertErrandName          = "training-insert"
+	ConsulAgentJobName                = "consul-agent"
+	ConsulServiceNamePropertyKey      = "consul_service_name"
+	HealthCheckEnabledPropertyKey     = "healthcheck_enabled"
+	HealthCheckIntervalPropertyKey    = "healthcheck_interval"
+	RedisCheckJobName                 = "redis-check"
+	ColocatedSmokeTestsPropertyKey    = "colocated_smoke_tests"
+	SmokeTestsJobName                 = "smoke-tests"
+	DefaultHealthCheckIntervalSeconds = 30
 	LifecycleErrandType               = "errand"
+	LifecycleServiceType              = "service"
 )
 
 var CurrentPasswordGenerator = randomPasswordGenerator
 
+// Version is stamped into generated manifests. Release builds set it with
+// -ldflags "-X github.com/pivotal-cf-experimental/redis-example-service-adapter/adapter.Version=<version>".
+var Version = "dev"
+
+var knownPlanProperties = map[string]bool{
+	RedisServerPersistencePropertyKey: true,
+	PersistentDiskSizesPropertyKey:    true,
+	PlanNamePropertyKey:               true,
+	MigratableFromPropertyKey:         true,
+	DrainTimeoutPropertyKey:           true,
+	AgentDrainTimeoutPropertyKey:      true,
+	MaxInstancesPropertyKey:           true,
+	MinimumPreviousReleaseVersionKey:  true,
+	RedisReleaseNamePropertyKey:       true,
+	RedisJobNamePropertyKey:           true,
+	PropertyScopePropertyKey:          true,
+	SystemdOverridesPropertyKey:       true,
+	JobEnvVarsPropertyKey:             true,
+	RedisConfSnippetPropertyKey:       true,
+	ReleaseStemcellOverridesKey:       true,
+	TagsPropertyKey:                   true,
+	BindingTTLSecondsPropertyKey:      true,
+	UpgradeCheckModePropertyKey:       true,
+	UpgradeStrategyPropertyKey:        true,
+	ExportedAsPropertyKey:             true,
+	MaxMemoryLimitPropertyKey:         true,
+	MaxClientsMinPropertyKey:          true,
+	MaxClientsMaxPropertyKey:          true,
+	DefaultLogLevelPropertyKey:        true,
+	CoLocateJobsPropertyKey:           true,
+	StaticIPsPropertyKey:              true,
+	DefaultNetworkPropertyKey:         true,
+	IPv6EnabledPropertyKey:            true,
+	ProtectedModePropertyKey:          true,
+	AuthRequiredPropertyKey:           true,
+	IKnowWhatIAmDoingPropertyKey:      true,
+	TLSEnabledPropertyKey:             true,
+	PreStartScriptPropertyKey:         true,
+	StrictPropertiesKey:               true,
+	DiscardUnmanagedPropertiesKey:     true,
+	AllowedArbitraryParamsPropertyKey: true,
+	NTPServersPropertyKey:             true,
+	DashboardDomainPropertyKey:        true,
+	ShareablePropertyKey:              true,
+	ClusterEnabledPropertyKey:         true,
+	DeploymentOrderPropertyKey:        true,
+	AutoScalingPropertyKey:            true,
+	ConsulServiceNamePropertyKey:      true,
+	HealthCheckEnabledPropertyKey:     true,
+	HealthCheckIntervalPropertyKey:    true,
+	ColocatedSmokeTestsPropertyKey:    true,
+	"plan_secret":                     true,
+	"colocated_errand":                true,
+	"use_short_dns_addresses":         true,
+}
+
+var lazyFreeParams = []string{
+	"lazyfree-lazy-eviction",
+	"lazyfree-lazy-expire",
+	"lazyfree-lazy-server-del",
+	"replica-lazy-flush",
+}
+
+var redisLogLevels = []string{"debug", "verbose", "notice", "warning"}
+
+// protectedConfDirectives are the redis.conf settings the adapter and the job
+// own, for authentication, TLS, networking and the data directory. A plan's
+// redis_conf_snippet may not override them.
+var protectedConfDirectives = map[string]bool{
+	"aclfile":                  true,
+	"bind":                     true,
+	"dbfilename":               true,
+	"dir":                      true,
+	"enable-debug-command":     true,
+	"enable-module-command":    true,
+	"enable-protected-configs": true,
+	"include":                  true,
+	"loadmodule":               true,
+	"masterauth":               true,
+	"masteruser":               true,
+	"port":                     true,
+	"protected-mode":           true,
+	"rename-command":           true,
+	"requirepass":              true,
+	"tls-ca-cert-file":         true,
+	"tls-cert-file":            true,
+	"tls-key-file":             true,
+	"tls-port":                 true,
+	"unixsocket":               true,
+	"unixsocketperm":           true,
+	"user":                     true,
+}
+
+var knownEncodingLimits = []string{
+	"hash-max-listpack-entries",
+	"hash-max-listpack-value",
+	"list-max-listpack-size",
+	"list-compress-depth",
+	"set-max-intset-entries",
+	"set-max-listpack-entries",
+	"set-max-listpack-value",
+	"zset-max-listpack-entries",
+	"zset-max-listpack-value",
+}
+
 const (
 	ManagedSecretValue          = "HardcodedAdapterValue"
 	ManagedSecretKey            = "odb_managed_secret"
 	IgnoreSecretKey             = "ignore_secret"
 	GeneratedSecretKey          = "generated_secret"
 	GeneratedSecretVariableName = "secret_pass"
+	PasswordSecretName          = "redis-password"
 	CertificateVariableName     = "instance_certificate"
+	TLSCAVariableName           = "redis_tls_ca"
+	TLSCertificateVariableName  = "redis_tls_cert"
+	// TLSKeyVariableName is the client key pair redis presents on its own TLS
+	// connections. The server's private key comes with TLSCertificateVariableName.
+	TLSKeyVariableName = "redis_tls_key"
+)
+
+// CurrentPropertiesSchemaVersion is written into the redis properties and is
+// raised whenever their layout changes in a way bindings depend on.
+const (
+	PropertiesSchemaVersionKey     = "properties_schema_version"
+	CurrentPropertiesSchemaVersion = 1
 )
 
 type ManifestGenerator struct {
-	StderrLogger *log.Logger
-	Config       Config
+	StderrLogger        *log.Logger
+	LogFormat           string
+	Config              Config
+	AdapterConfig       AdapterConfig
+	AllowedVMExtensions []string
+	DefaultNetworkName  string
+	Resolver            Resolver
+
+	events *eventLogger
+	strict bool
 }
 
 func (m ManifestGenerator) GenerateManifest(
@@ -49,22 +269,72 @@ func (m ManifestGenerator) GenerateManifest(
 	previousPlan *serviceadapter.Plan,
 	previousSecrets serviceadapter.ManifestSecrets,
 ) (serviceadapter.GenerateManifestOutput, error) {
+	m.events = newEventLogger(m.StderrLogger, m.LogFormat, serviceDeployment.DeploymentName, "generate-manifest", previousSecrets)
+	if previousManifest != nil {
+		m.events.addManifestSecrets(previousManifest)
+	}
+	output, err := m.generateManifest(serviceDeployment, plan, requestParams, previousManifest, previousPlan, previousSecrets)
+	if err == nil && m.strict {
+		err = warningProblems(m.events.warnings)
+	}
+	if err != nil {
+		return serviceadapter.GenerateManifestOutput{}, reportError(m.events, err)
+	}
+	return output, nil
+}
+
+// GenerateManifestStrict is for an operator iterating on a plan. Unlike
+// GenerateManifest, it reports an incomplete service deployment together
+// with the problems in the plan and parameters, and it refuses a manifest
+// that GenerateManifest would return with warnings, reporting each warning as
+// a problem. It generates the same manifest as GenerateManifest when neither
+// finds anything to report.
+func (m ManifestGenerator) GenerateManifestStrict(
+	serviceDeployment serviceadapter.ServiceDeployment,
+	plan serviceadapter.Plan,
+	requestParams serviceadapter.RequestParameters,
+	previousManifest *bosh.BoshManifest,
+	previousPlan *serviceadapter.Plan,
+	previousSecrets serviceadapter.ManifestSecrets,
+) (serviceadapter.GenerateManifestOutput, error) {
+	m.strict = true
+	return m.GenerateManifest(serviceDeployment, plan, requestParams, previousManifest, previousPlan, previousSecrets)
+}
+
+// warningProblems is nil when generation logged no warnings.
+func warningProblems(warnings []string) error {
+	var problems []error
+	for _, warning := range warnings {
+		problems = append(problems, operatorError("%s", warning))
+	}
+	return combineErrors(problems)
+}
+
+func (m ManifestGenerator) generateManifest(
+	serviceDeployment serviceadapter.ServiceDeployment,
+	plan serviceadapter.Plan,
+	requestParams serviceadapter.RequestParameters,
+	previousManifest *bosh.BoshManifest,
+	previousPlan *serviceadapter.Plan,
+	previousSecrets serviceadapter.ManifestSecrets,
+) (serviceadapter.GenerateManifestOutput, error) {
 
 	ctx := requestParams.ArbitraryContext()
 	platform := requestParams.Platform()
 	if len(ctx) == 0 || platform != "cloudfoundry" {
-		m.StderrLogger.Println("Non Cloud Foundry platform (or pre OSBAPI 2.13) detected")
+		m.events.Info("Non Cloud Foundry platform (or pre OSBAPI 2.13) detected")
 	}
-	arbitraryParameters := requestParams.ArbitraryParams()
-	illegalArbParams := findIllegalArbitraryParams(arbitraryParameters)
-	if len(illegalArbParams) != 0 {
-		return serviceadapter.GenerateManifestOutput{}, fmt.Errorf("unsupported parameter(s) for this service plan: %s", strings.Join(illegalArbParams, ", "))
+	problems := serviceDeploymentProblems(serviceDeployment)
+	if len(problems) > 0 && !m.strict {
+		return serviceadapter.GenerateManifestOutput{}, combineErrors(problems)
 	}
+	operation := classifyOperation(plan, requestParams, previousManifest, previousPlan)
+	m.events.Info(fmt.Sprintf("generating manifest, operation type: %s", operation))
 
-	if previousManifest != nil {
-		if err := m.validUpgradePath(*previousManifest, serviceDeployment.Releases); err != nil {
-			return serviceadapter.GenerateManifestOutput{}, err
-		}
+	arbitraryParameters := requestParams.ArbitraryParams()
+	problems = append(problems, m.generationProblems(serviceDeployment, plan, arbitraryParameters, previousManifest, previousPlan, operation)...)
+	if err := combineErrors(problems); err != nil {
+		return serviceadapter.GenerateManifestOutput{}, err
 	}
 
 	stemcellAlias := "only-stemcell"
@@ -77,14 +347,65 @@ func (m ManifestGenerator) GenerateManifest(
 	}
 
 	redisServerInstanceGroup := m.findRedisServerInstanceGroup(plan)
-	if redisServerInstanceGroup == nil {
-		m.StderrLogger.Println(fmt.Sprintf("no %s instance group definition found", m.Config.RedisInstanceGroupName))
-		return serviceadapter.GenerateManifestOutput{}, errors.New("Contact your operator, service configuration issue occurred")
+
+	if findInstanceGroup(plan, ReplicaInstanceGroupName) == nil {
+		for _, param := range []string{ReplBacklogSizeKey, ReplTimeoutKey} {
+			if _, found := arbitraryParameters[param]; found {
+				m.events.Warn(fmt.Sprintf("parameter '%s' is set but the plan deploys no %s instance group, it has no effect without replicas", param, ReplicaInstanceGroupName))
+			}
+		}
+	}
+
+	ipv6Enabled, err := ipv6EnabledForRedisServer(plan.Properties)
+	if err != nil {
+		return serviceadapter.GenerateManifestOutput{}, err
+	}
+
+	preStartScript, err := preStartScriptForRedisServer(plan.Properties)
+	if err != nil {
+		return serviceadapter.GenerateManifestOutput{}, err
+	}
+
+	ntpServers, err := ntpServersForRedisServer(plan.Properties)
+	if err != nil {
+		return serviceadapter.GenerateManifestOutput{}, err
+	}
+
+	agentDrainTimeout, err := agentDrainTimeoutForRedisServer(plan.Properties)
+	if err != nil {
+		return serviceadapter.GenerateManifestOutput{}, err
+	}
+
+	scope, err := propertyScope(plan.Properties)
+	if err != nil {
+		return serviceadapter.GenerateManifestOutput{}, err
+	}
+
+	jobEnvVars, err := jobEnvVarsForRedisServer(plan.Properties)
+	if err != nil {
+		return serviceadapter.GenerateManifestOutput{}, err
+	}
+	confSnippet, err := confSnippetForRedisServer(plan.Properties)
+	if err != nil {
+		return serviceadapter.GenerateManifestOutput{}, err
 	}
 
 	newSecrets := serviceadapter.ODBManagedSecrets{}
 
-	redisServerNetworks := mapNetworksToBoshNetworks(redisServerInstanceGroup.Networks)
+	redisServerNetworks, err := m.redisServerNetworks(*redisServerInstanceGroup)
+	if err != nil {
+		return serviceadapter.GenerateManifestOutput{}, err
+	}
+
+	redisServerNetworks, err = withStaticIPs(redisServerNetworks, *redisServerInstanceGroup, plan.Properties)
+	if err != nil {
+		return serviceadapter.GenerateManifestOutput{}, err
+	}
+
+	redisServerNetworks, err = withDefaultNetwork(redisServerNetworks, *redisServerInstanceGroup, plan.Properties)
+	if err != nil {
+		return serviceadapter.GenerateManifestOutput{}, err
+	}
 
 	redisProperties, err := m.redisServerProperties(
 		serviceDeployment.DeploymentName,
@@ -93,6 +414,7 @@ func (m ManifestGenerator) GenerateManifest(
 		previousManifest,
 		newSecrets,
 		previousSecrets,
+		operation,
 	)
 	if err != nil {
 		return serviceadapter.GenerateManifestOutput{}, err
@@ -106,13 +428,36 @@ func (m ManifestGenerator) GenerateManifest(
 		})
 	}
 
-	redisServerJob, err := m.gatherRedisServerJob(serviceDeployment.Releases)
+	exportedAs, _ := plan.Properties[ExportedAsPropertyKey].(string)
+	redisServerJob, err := m.gatherRedisServerJob(serviceDeployment.Releases, redisJobName(plan.Properties), redisReleaseName(plan.Properties), exportedAs)
 	if err != nil {
 		return serviceadapter.GenerateManifestOutput{}, err
 	}
+	if scope == PropertyScopeJob {
+		redisServerJob.Properties = map[string]interface{}{"redis": redisProperties["redis"]}
+		delete(redisProperties, "redis")
+	}
+	if len(jobEnvVars) > 0 {
+		if redisServerJob.Properties == nil {
+			redisServerJob.Properties = map[string]interface{}{}
+		}
+		redisServerJob.Properties["run"] = map[string]interface{}{"env": jobEnvVars}
+	}
+	if confSnippet != "" {
+		if redisServerJob.Properties == nil {
+			redisServerJob.Properties = map[string]interface{}{}
+		}
+		redisServerJob.Properties[RedisConfSnippetPropertyKey] = confSnippet
+	}
 
 	redisServerInstanceJobs := []bosh.Job{redisServerJob}
 
+	coLocatedJobs, err := gatherCoLocatedJobs(serviceDeployment.Releases, plan.Properties)
+	if err != nil {
+		return serviceadapter.GenerateManifestOutput{}, err
+	}
+	redisServerInstanceJobs = append(redisServerInstanceJobs, coLocatedJobs...)
+
 	if value, ok := plan.Properties["colocated_errand"].(bool); ok && value {
 		var errands []serviceadapter.Errand
 		errands = append(plan.LifecycleErrands.PreDelete, plan.LifecycleErrands.PostDeploy...)
@@ -130,6 +475,46 @@ func (m ManifestGenerator) GenerateManifest(
 		}
 	}
 
+	if consulServiceName, ok := plan.Properties[ConsulServiceNamePropertyKey].(string); ok && consulServiceName != "" {
+		consulAgentJob, err := gatherJob(serviceDeployment.Releases, ConsulAgentJobName)
+		if err != nil {
+			return serviceadapter.GenerateManifestOutput{}, operatorError("plan property '%s' is set but %s", ConsulServiceNamePropertyKey, err)
+		}
+		redisServerInstanceJobs = append(redisServerInstanceJobs, consulAgentJob)
+		redisProperties["consul"] = consulProperties(consulServiceName, m.AdapterConfig.withDefaults().Port)
+	}
+
+	redisCheckJob, err := redisCheckJob(serviceDeployment.Releases, plan.Properties, exportedAs)
+	if err != nil {
+		return serviceadapter.GenerateManifestOutput{}, err
+	}
+	if redisCheckJob != nil {
+		redisServerInstanceJobs = append(redisServerInstanceJobs, *redisCheckJob)
+	}
+
+	smokeTestsJob, err := colocatedSmokeTestsJob(serviceDeployment.Releases, plan.Properties, exportedAs)
+	if err != nil {
+		return serviceadapter.GenerateManifestOutput{}, err
+	}
+	if smokeTestsJob != nil {
+		redisServerInstanceJobs = append(redisServerInstanceJobs, *smokeTestsJob)
+	}
+
+	agentSettings := map[string]interface{}{"drain_timeout": agentDrainTimeout}
+	if preStartScript != "" {
+		agentSettings["pre_start"] = preStartScript
+	}
+	boshEnv := map[string]interface{}{
+		"agent": map[string]interface{}{"settings": agentSettings},
+	}
+	if ipv6Enabled {
+		boshEnv["ipv6"] = map[string]interface{}{"enable": true}
+	}
+	if len(ntpServers) > 0 {
+		boshEnv["ntp"] = ntpServers
+	}
+	redisServerEnv := map[string]interface{}{"bosh": boshEnv}
+
 	var migrations []bosh.Migration
 	for _, m := range redisServerInstanceGroup.MigratedFrom {
 		migrations = append(migrations, bosh.Migration{
@@ -142,13 +527,14 @@ func (m ManifestGenerator) GenerateManifest(
 		Instances:          redisServerInstanceGroup.Instances,
 		Jobs:               redisServerInstanceJobs,
 		VMType:             redisServerInstanceGroup.VMType,
-		VMExtensions:       redisServerInstanceGroup.VMExtensions,
+		VMExtensions:       m.uniqueVMExtensions(redisServerInstanceGroup.Name, redisServerInstanceGroup.VMExtensions),
 		PersistentDiskType: redisServerInstanceGroup.PersistentDiskType,
 		Stemcell:           stemcellAlias,
 		Networks:           redisServerNetworks,
 		AZs:                redisServerInstanceGroup.AZs,
 		Properties:         redisProperties,
 		MigratedFrom:       migrations,
+		Env:                redisServerEnv,
 	}
 
 	instanceGroups := []bosh.InstanceGroup{newRedisInstanceGroup}
@@ -165,14 +551,17 @@ func (m ManifestGenerator) GenerateManifest(
 		}
 
 		healthCheckJobs := []bosh.Job{healthCheckJob}
-		healthCheckNetworks := mapNetworksToBoshNetworks(healthCheckInstanceGroup.Networks)
+		healthCheckNetworks, err := withStaticIPs(mapNetworksToBoshNetworks(healthCheckInstanceGroup.Networks), *healthCheckInstanceGroup, plan.Properties)
+		if err != nil {
+			return serviceadapter.GenerateManifestOutput{}, err
+		}
 
 		instanceGroups = append(instanceGroups, bosh.InstanceGroup{
 			Name:               HealthCheckErrandName,
 			Instances:          healthCheckInstanceGroup.Instances,
 			Jobs:               healthCheckJobs,
 			VMType:             healthCheckInstanceGroup.VMType,
-			VMExtensions:       healthCheckInstanceGroup.VMExtensions,
+			VMExtensions:       m.uniqueVMExtensions(healthCheckInstanceGroup.Name, healthCheckInstanceGroup.VMExtensions),
 			PersistentDiskType: healthCheckInstanceGroup.PersistentDiskType,
 			Stemcell:           stemcellAlias,
 			Networks:           healthCheckNetworks,
@@ -194,14 +583,17 @@ func (m ManifestGenerator) GenerateManifest(
                 }
 
                 trainingInsertJobs := []bosh.Job{trainingInsertJob}
-                trainingInsertNetworks := mapNetworksToBoshNetworks(trainingInsertInstanceGroup.Networks)
+                trainingInsertNetworks, err := withStaticIPs(mapNetworksToBoshNetworks(trainingInsertInstanceGroup.Networks), *trainingInsertInstanceGroup, plan.Properties)
+                if err != nil {
+                        return serviceadapter.GenerateManifestOutput{}, err
+                }
 
                 instanceGroups = append(instanceGroups, bosh.InstanceGroup{
                         Name:               trainingInsertErrandName,
                         Instances:          trainingInsertInstanceGroup.Instances,
                         Jobs:               trainingInsertJobs,
                         VMType:             trainingInsertInstanceGroup.VMType,
-                        VMExtensions:       trainingInsertInstanceGroup.VMExtensions,
+                        VMExtensions:       m.uniqueVMExtensions(trainingInsertInstanceGroup.Name, trainingInsertInstanceGroup.VMExtensions),
                         PersistentDiskType: trainingInsertInstanceGroup.PersistentDiskType,
                         Stemcell:           stemcellAlias,
                         Networks:           trainingInsertNetworks,
@@ -224,14 +616,17 @@ func (m ManifestGenerator) GenerateManifest(
 
 		cleanupDataJobs := []bosh.Job{cleanupDataJob}
 
-		cleanupDataNetworks := mapNetworksToBoshNetworks(cleanupDataInstanceGroup.Networks)
+		cleanupDataNetworks, err := withStaticIPs(mapNetworksToBoshNetworks(cleanupDataInstanceGroup.Networks), *cleanupDataInstanceGroup, plan.Properties)
+		if err != nil {
+			return serviceadapter.GenerateManifestOutput{}, err
+		}
 
 		instanceGroups = append(instanceGroups, bosh.InstanceGroup{
 			Name:               CleanupDataErrandName,
 			Instances:          cleanupDataInstanceGroup.Instances,
 			Jobs:               cleanupDataJobs,
 			VMType:             cleanupDataInstanceGroup.VMType,
-			VMExtensions:       cleanupDataInstanceGroup.VMExtensions,
+			VMExtensions:       m.uniqueVMExtensions(cleanupDataInstanceGroup.Name, cleanupDataInstanceGroup.VMExtensions),
 			PersistentDiskType: cleanupDataInstanceGroup.PersistentDiskType,
 			Stemcell:           stemcellAlias,
 			Networks:           cleanupDataNetworks,
@@ -241,22 +636,88 @@ func (m ManifestGenerator) GenerateManifest(
 		})
 	}
 
-	newManifest := bosh.BoshManifest{
-		Name:     serviceDeployment.DeploymentName,
-		Releases: releases,
-		Stemcells: []bosh.Stemcell{
-			{
-				Alias:   stemcellAlias,
-				OS:      serviceDeployment.Stemcell.OS,
-				Version: serviceDeployment.Stemcell.Version,
-			},
+	deploymentOrder, err := deploymentOrderForInstanceGroups(plan)
+	if err != nil {
+		return serviceadapter.GenerateManifestOutput{}, err
+	}
+	sort.SliceStable(instanceGroups, func(i, j int) bool {
+		return deploymentOrder[instanceGroups[i].Name] < deploymentOrder[instanceGroups[j].Name]
+	})
+
+	stemcells := []bosh.Stemcell{
+		{
+			Alias:   stemcellAlias,
+			OS:      serviceDeployment.Stemcell.OS,
+			Version: serviceDeployment.Stemcell.Version,
 		},
+	}
+	pinnedStemcells, releaseStemcellAliases, err := releaseStemcellOverrides(serviceDeployment.Releases, plan.Properties)
+	if err != nil {
+		return serviceadapter.GenerateManifestOutput{}, err
+	}
+	stemcells = append(stemcells, pinnedStemcells...)
+	// BOSH runs one stemcell per VM, so an instance group follows the
+	// release of the job it is there to run.
+	for i, instanceGroup := range instanceGroups {
+		if len(instanceGroup.Jobs) == 0 {
+			continue
+		}
+		if alias, pinned := releaseStemcellAliases[instanceGroup.Jobs[0].Release]; pinned {
+			instanceGroups[i].Stemcell = alias
+		}
+	}
+
+	updateBlock, err := generateUpdateBlock(plan.Update, previousManifest, plan.Properties, m.AdapterConfig.withDefaults().Update)
+	if err != nil {
+		return serviceadapter.GenerateManifestOutput{}, err
+	}
+
+	tags := map[string]interface{}{}
+	if operation == OperationUpgrade {
+		for key, value := range previousManifest.Tags {
+			if key != DashboardRouteTagKey {
+				tags[key] = value
+			}
+		}
+	}
+	operatorTags, err := planTags(plan.Properties)
+	if err != nil {
+		return serviceadapter.GenerateManifestOutput{}, err
+	}
+	for key, value := range operatorTags {
+		tags[key] = value
+	}
+	tags[ProductTagKey] = "redis"
+	// The versions say which build generated the manifest, so even an upgrade
+	// that keeps the other previous tags verbatim refreshes them. The manifest
+	// comparator ignores them, so they never force a deploy on their own.
+	tags[AdapterVersionTagKey] = Version
+	tags[RedisReleaseVersionTagKey] = releaseVersion(serviceDeployment.Releases, redisServerJob.Release)
+	route, err := dashboardRoute(serviceDeployment.DeploymentName, plan.Properties)
+	if err != nil {
+		return serviceadapter.GenerateManifestOutput{}, err
+	}
+	if route != "" {
+		tags[DashboardRouteTagKey] = route
+	}
+
+	manifestProperties := map[string]interface{}{}
+	autoScaling, err := autoScalingProperties(plan.Properties)
+	if err != nil {
+		return serviceadapter.GenerateManifestOutput{}, err
+	}
+	if autoScaling != nil {
+		manifestProperties[AutoScalingPropertyKey] = autoScaling
+	}
+
+	newManifest := bosh.BoshManifest{
+		Name:           serviceDeployment.DeploymentName,
+		Releases:       releases,
+		Stemcells:      stemcells,
 		InstanceGroups: instanceGroups,
-		Update:         generateUpdateBlock(plan.Update, previousManifest),
-		Properties:     map[string]interface{}{},
-		Tags: map[string]interface{}{
-			"product": "redis",
-		},
+		Update:         updateBlock,
+		Properties:     manifestProperties,
+		Tags:           tags,
 		Variables: []bosh.Variable{
 			{Name: GeneratedSecretVariableName, Type: "password"},
 			{
@@ -275,6 +736,9 @@ func (m ManifestGenerator) GenerateManifest(
 			},
 		},
 	}
+	if tlsEnabled, _ := plan.Properties[TLSEnabledPropertyKey].(bool); tlsEnabled {
+		newManifest.Variables = append(newManifest.Variables, tlsVariables()...)
+	}
 	if useShortDNSAddress, set := plan.Properties["use_short_dns_addresses"]; set {
 		newManifest.Features.UseShortDNSAddresses = bosh.BoolPointer(useShortDNSAddress == true)
 	}
@@ -285,292 +749,2248 @@ func (m ManifestGenerator) GenerateManifest(
 	}
 	newSecrets[ManagedSecretKey] = managedSecretValue
 
+	if previousManifest != nil && (ManifestComparator{}).Equal(*previousManifest, newManifest) {
+		m.events.Info("the generated manifest does not differ from the previous one")
+	}
+
 	return serviceadapter.GenerateManifestOutput{
 		Manifest:          newManifest,
 		ODBManagedSecrets: newSecrets,
 	}, nil
 }
 
-func findIllegalArbitraryParams(arbitraryParams map[string]interface{}) []string {
+// findIllegalArbitraryParams accepts the parameters the plan schema
+// advertises, so the two cannot drift apart.
+func findIllegalArbitraryParams(arbitraryParams map[string]interface{}, allowedParams map[string]bool) []string {
+	supportedParams := arbitraryParamSchemas(nil)
 	var illegalParams []string
-	for k, _ := range arbitraryParams {
-		if k == "maxclients" || k == "credhub_secret_path" || k == ManagedSecretKey {
-			continue
+	for k := range arbitraryParams {
+		if _, supported := supportedParams[k]; !supported || (allowedParams != nil && !allowedParams[k]) {
+			illegalParams = append(illegalParams, k)
 		}
-		illegalParams = append(illegalParams, k)
 	}
+	sort.Strings(illegalParams)
 	return illegalParams
 }
 
-func mapNetworksToBoshNetworks(networks []string) []bosh.Network {
-	boshNetworks := []bosh.Network{}
-	for _, network := range networks {
-		boshNetworks = append(boshNetworks, bosh.Network{Name: network})
-	}
-	return boshNetworks
-}
+// serviceDeploymentProblems catches an incomplete deployment from the broker
+// before it turns into a manifest the director rejects.
+func serviceDeploymentProblems(serviceDeployment serviceadapter.ServiceDeployment) []error {
+	var errs []error
 
-func randomPasswordGenerator() (string, error) {
-	length := 20
-	randomBytes := make([]byte, length)
-	_, err := rand.Read(randomBytes)
-	if err != nil {
-		log.Printf("Error generating random bytes, %v", err)
-		return "", err
+	if len(serviceDeployment.Releases) == 0 {
+		errs = append(errs, operatorError("service deployment is missing 'releases'"))
 	}
-	randomStringBytes := make([]byte, base64.StdEncoding.EncodedLen(len(randomBytes)))
-	base64.StdEncoding.Encode(randomStringBytes, randomBytes)
-	return string(randomStringBytes), nil
-}
-
-func findInstanceGroup(plan serviceadapter.Plan, instanceGroupName string) *serviceadapter.InstanceGroup {
-	for _, instanceGroup := range plan.InstanceGroups {
-		if instanceGroup.Name == instanceGroupName {
-			return &instanceGroup
+	for i, release := range serviceDeployment.Releases {
+		if release.Name == "" {
+			errs = append(errs, operatorError("service deployment release at index %d is missing 'name'", i))
+		}
+		if release.Version == "" {
+			if release.Name == "" {
+				errs = append(errs, operatorError("service deployment release at index %d is missing 'version'", i))
+			} else {
+				errs = append(errs, operatorError("service deployment release '%s' is missing 'version'", release.Name))
+			}
 		}
 	}
 
-	return nil
-}
+	if serviceDeployment.Stemcell.OS == "" {
+		errs = append(errs, operatorError("service deployment stemcell is missing 'stemcell_os'"))
+	}
+	if serviceDeployment.Stemcell.Version == "" {
+		errs = append(errs, operatorError("service deployment stemcell is missing 'stemcell_version'"))
+	}
 
-func (m *ManifestGenerator) findRedisServerInstanceGroup(plan serviceadapter.Plan) *serviceadapter.InstanceGroup {
-	return findInstanceGroup(plan, m.Config.RedisInstanceGroupName)
+	return errs
 }
 
-func findHealthCheckInstanceGroup(plan serviceadapter.Plan) *serviceadapter.InstanceGroup {
-	return findInstanceGroup(plan, HealthCheckErrandName)
-}
+// validStrictPlanProperties rejects plan properties the adapter does not know
+// about, but only for plans that opt in with strict_properties.
+func validStrictPlanProperties(planProperties serviceadapter.Properties, persistencePropertyKey string) error {
+	configuredStrict, found := planProperties[StrictPropertiesKey]
+	if !found {
+		return nil
+	}
 
-func findTrainingInsertInstanceGroup(plan serviceadapter.Plan) *serviceadapter.InstanceGroup {
-        return findInstanceGroup(plan, TrainingInsertErrandName)
-}
+	strict, ok := configuredStrict.(bool)
+	if !ok {
+		return operatorError("invalid value for plan property '%s': %v, must be a boolean", StrictPropertiesKey, configuredStrict)
+	}
+	if !strict {
+		return nil
+	}
 
-func findCleanupDataInstanceGroup(plan serviceadapter.Plan) *serviceadapter.InstanceGroup {
-	return findInstanceGroup(plan, CleanupDataErrandName)
+	var unknownProperties []string
+	for key := range planProperties {
+		if !knownPlanProperties[key] && key != persistencePropertyKey {
+			unknownProperties = append(unknownProperties, key)
+		}
+	}
+	if len(unknownProperties) == 0 {
+		return nil
+	}
+
+	sort.Strings(unknownProperties)
+	return operatorError("unknown plan property(s) with '%s' enabled: %s", StrictPropertiesKey, strings.Join(unknownProperties, ", "))
 }
 
-var versionRegexp = regexp.MustCompile(`^(\d+)(?:\.(\d+))?(?:\+dev\.(\d+))?`)
+func (m ManifestGenerator) generationProblems(
+	serviceDeployment serviceadapter.ServiceDeployment,
+	plan serviceadapter.Plan,
+	arbitraryParameters map[string]interface{},
+	previousManifest *bosh.BoshManifest,
+	previousPlan *serviceadapter.Plan,
+	operation Operation,
+) []error {
+	var errs []error
 
-func parseReleaseVersion(versionString string) (int, int, int, error) {
-	submatches := versionRegexp.FindStringSubmatch(versionString)
+	allowedParams, err := allowedArbitraryParams(plan.Properties)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	// Upgrades carry no user input, so the parameter checks are skipped.
+	if operation != OperationUpgrade {
+		if illegalArbParams := findIllegalArbitraryParams(arbitraryParameters, allowedParams); len(illegalArbParams) != 0 {
+			errs = append(errs, userError("unsupported parameter(s) for this service plan: %s", strings.Join(illegalArbParams, ", ")))
+		}
+		errs = append(errs, validArbitraryParams(arbitraryParameters, plan.Properties)...)
+		if _, err := maintenanceModeForRedisServer(arbitraryParameters, RedisProperties{}, operation); err != nil {
+			errs = append(errs, err)
+		}
+	}
 
-	if len(submatches) == 0 {
-		return 0, 0, 0, fmt.Errorf("%s is not a valid BOSH release version", versionString)
+	_, persistenceErr := m.persistenceEnabled(plan.Properties)
+	if persistenceErr != nil {
+		errs = append(errs, persistenceErr)
+	}
+	if _, err := drainTimeoutForRedisServer(plan.Properties); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := discardUnmanagedPropertiesForRedisServer(plan.Properties); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := ipv6EnabledForRedisServer(plan.Properties); err != nil {
+		errs = append(errs, err)
 	}
+	if _, err := protectedModeForRedisServer(plan.Properties); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := preStartScriptForRedisServer(plan.Properties); err != nil {
+		errs = append(errs, err)
+	}
+	if ntpServers, err := ntpServersForRedisServer(plan.Properties); err != nil {
+		errs = append(errs, err)
+	} else if err := m.resolvableNTPServers(ntpServers); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validStrictPlanProperties(plan.Properties, m.Config.persistencePropertyKey()); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := dashboardRoute(serviceDeployment.DeploymentName, plan.Properties); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := deploymentOrderForInstanceGroups(plan); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := autoScalingProperties(plan.Properties); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := propertyScope(plan.Properties); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := systemdOverridesForRedisServer(plan.Properties); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := jobEnvVarsForRedisServer(plan.Properties); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := confSnippetForRedisServer(plan.Properties); err != nil {
+		errs = append(errs, err)
+	}
+	if _, _, err := releaseStemcellOverrides(serviceDeployment.Releases, plan.Properties); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := planTags(plan.Properties); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := migratableFromForPlan(plan.Properties); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, validInstanceCounts(plan)...)
+	errs = append(errs, m.validInstanceGroupLifecycles(plan)...)
 
-	major, err := strconv.Atoi(submatches[1])
-	if err != nil {
-		return 0, 0, 0, err
+	exportedAs, _ := plan.Properties[ExportedAsPropertyKey].(string)
+	_, redisServerJobErr := m.gatherRedisServerJob(serviceDeployment.Releases, redisJobName(plan.Properties), redisReleaseName(plan.Properties), exportedAs)
+	if redisServerJobErr != nil {
+		errs = append(errs, redisServerJobErr)
+	}
+	if _, err := gatherCoLocatedJobs(serviceDeployment.Releases, plan.Properties); err != nil {
+		errs = append(errs, err)
 	}
 
-	minor := 0
-	if submatches[2] != "" {
-		minor, err = strconv.Atoi(submatches[2])
-		if err != nil {
-			return 0, 0, 0, err
+	// The upgrade path checks resolve the redis-server release themselves, so
+	// only run them once that resolution is known to succeed.
+	if previousManifest != nil && redisServerJobErr == nil {
+		if mode, err := upgradeCheckMode(plan.Properties); err != nil {
+			errs = append(errs, err)
+		} else if err := m.validUpgradePath(*previousManifest, serviceDeployment.Releases, redisJobName(plan.Properties), redisReleaseName(plan.Properties), mode); err != nil {
+			errs = append(errs, err)
+		}
+		if err := m.validMinimumPreviousReleaseVersion(*previousManifest, serviceDeployment.Releases, plan.Properties); err != nil {
+			errs = append(errs, err)
 		}
 	}
 
-	patch := 0
-	if submatches[3] != "" {
-		patch, err = strconv.Atoi(submatches[3])
-		if err != nil {
-			return 0, 0, 0, err
+	redisServerInstanceGroups := findInstanceGroups(plan, m.Config.RedisInstanceGroupName)
+	switch len(redisServerInstanceGroups) {
+	case 0:
+		if len(plan.InstanceGroups) == 0 {
+			errs = append(errs, operatorError("plan defines no instance groups"))
+		} else {
+			errs = append(errs, operatorError("no %s instance group definition found", m.Config.RedisInstanceGroupName))
 		}
+	case 1:
+		errs = append(errs, m.validRedisServerInstanceGroup(
+			*redisServerInstanceGroups[0],
+			plan,
+			arbitraryParameters,
+			previousManifest,
+			previousPlan,
+			persistenceErr == nil,
+		)...)
+	default:
+		errs = append(errs, operatorError("plan defines %d instance groups named %s", len(redisServerInstanceGroups), m.Config.RedisInstanceGroupName))
 	}
 
-	return major, minor, patch, nil
+	return errs
 }
 
-func generateUpdateBlock(update *serviceadapter.Update, previousManifest *bosh.BoshManifest) *bosh.Update {
-	if update != nil {
-		return &bosh.Update{
-			Canaries:        update.Canaries,
-			MaxInFlight:     update.MaxInFlight,
-			CanaryWatchTime: update.CanaryWatchTime,
-			UpdateWatchTime: update.UpdateWatchTime,
-			Serial:          update.Serial,
-		}
-	} else {
-		updateBlock := &bosh.Update{
-			Canaries:        4,
-			CanaryWatchTime: "30000-240000",
-			UpdateWatchTime: "30000-240000",
-			MaxInFlight:     4,
-			VmStrategy:      "delete-create",
-		}
-
+func (m ManifestGenerator) validRedisServerInstanceGroup(
+	redisServerInstanceGroup serviceadapter.InstanceGroup,
+	plan serviceadapter.Plan,
+	arbitraryParameters map[string]interface{},
+	previousManifest *bosh.BoshManifest,
+	previousPlan *serviceadapter.Plan,
+	persistenceValid bool,
+) []error {
+	var errs []error
+
+	if redisServerInstanceGroup.AZs == nil {
+		errs = append(errs, operatorError(
+			"the %s instance group does not specify azs, use an empty list to spread instances across all availability zones",
+			redisServerInstanceGroup.Name,
+		))
+	}
+
+	if err := m.validVMExtensions(redisServerInstanceGroup.VMExtensions); err != nil {
+		errs = append(errs, err)
+	}
+
+	if persistenceValid {
+		if err := m.validPersistentDiskType(redisServerInstanceGroup, plan.Properties); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if networks, err := m.redisServerNetworks(redisServerInstanceGroup); err != nil {
+		errs = append(errs, err)
+	} else if _, err := withStaticIPs(networks, redisServerInstanceGroup, plan.Properties); err != nil {
+		errs = append(errs, err)
+	}
+
+	if previousPlan != nil {
+		if err := m.validPlanTransition(*previousPlan, plan, redisServerInstanceGroup, arbitraryParameters); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if previousManifest != nil {
+		if err := m.validPersistentDiskChange(*previousManifest, redisServerInstanceGroup, plan.Properties, arbitraryParameters); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// validInstanceCounts guards the IaaS quota against a plan that asks for far
+// more VMs than intended. Plans without max_instances are unbounded.
+func validInstanceCounts(plan serviceadapter.Plan) []error {
+	configuredMax, found := plan.Properties[MaxInstancesPropertyKey]
+	if !found {
+		return nil
+	}
+
+	maxInstances, ok := toInt(configuredMax)
+	if !ok || maxInstances <= 0 {
+		return []error{operatorError("invalid value for plan property '%s': %v, must be a positive integer", MaxInstancesPropertyKey, configuredMax)}
+	}
+
+	var errs []error
+	for _, instanceGroup := range plan.InstanceGroups {
+		if instanceGroup.Instances > maxInstances {
+			errs = append(errs, operatorError(
+				"instance group %s requests %d instances, more than the %d allowed by plan property '%s'",
+				instanceGroup.Name,
+				instanceGroup.Instances,
+				maxInstances,
+				MaxInstancesPropertyKey,
+			))
+		}
+	}
+	return errs
+}
+
+func instanceGroupLifecycle(instanceGroup serviceadapter.InstanceGroup) string {
+	if instanceGroup.Lifecycle == "" {
+		return LifecycleServiceType
+	}
+	return instanceGroup.Lifecycle
+}
+
+// validInstanceGroupLifecycles requires the redis server to be the plan's one
+// long-running instance group, apart from its replicas; everything else must
+// be an errand. Duplicate names are reported elsewhere.
+func (m ManifestGenerator) validInstanceGroupLifecycles(plan serviceadapter.Plan) []error {
+	var errs []error
+	var serviceInstanceGroups []string
+	seen := map[string]bool{}
+	for _, instanceGroup := range plan.InstanceGroups {
+		switch lifecycle := instanceGroupLifecycle(instanceGroup); lifecycle {
+		case LifecycleServiceType:
+			if instanceGroup.Name != ReplicaInstanceGroupName && !seen[instanceGroup.Name] {
+				serviceInstanceGroups = append(serviceInstanceGroups, instanceGroup.Name)
+			}
+			seen[instanceGroup.Name] = true
+		case LifecycleErrandType:
+			if instanceGroup.Name == m.Config.RedisInstanceGroupName {
+				errs = append(errs, operatorError("the %s instance group must have the %s lifecycle", instanceGroup.Name, LifecycleServiceType))
+			}
+		default:
+			errs = append(errs, operatorError(
+				"invalid lifecycle '%s' for instance group %s, must be %s or %s",
+				lifecycle,
+				instanceGroup.Name,
+				LifecycleServiceType,
+				LifecycleErrandType,
+			))
+		}
+	}
+
+	if len(serviceInstanceGroups) > 1 {
+		errs = append(errs, operatorError(
+			"plan defines %d instance groups with the %s lifecycle, only one is allowed: %s",
+			len(serviceInstanceGroups),
+			LifecycleServiceType,
+			strings.Join(serviceInstanceGroups, ", "),
+		))
+	}
+	return errs
+}
+
+func validArbitraryParams(arbitraryParameters map[string]interface{}, planProperties serviceadapter.Properties) []error {
+	var errs []error
+
+	if _, found := arbitraryParameters["maxclients"]; found {
+		if _, err := maxClientsForRedisServer(arbitraryParameters, planProperties, nil, 0); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if _, err := maxMemoryForRedisServer(arbitraryParameters, planProperties, RedisProperties{}); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := lazyFreeForRedisServer(arbitraryParameters, RedisProperties{}); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := evictionTenacityForRedisServer(arbitraryParameters, RedisProperties{}); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := hzForRedisServer(arbitraryParameters, RedisProperties{}); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := logLevelForRedisServer(arbitraryParameters, planProperties, RedisProperties{}); err != nil {
+		errs = append(errs, err)
+	}
+	if _, _, err := unixSocketForRedisServer(arbitraryParameters, RedisProperties{}); err != nil {
+		errs = append(errs, err)
+	}
+	for _, param := range []string{DynamicHzKey, ActiveRehashingKey} {
+		if _, err := yesNoParamForRedisServer(param, arbitraryParameters, ""); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if _, err := encodingLimitsForRedisServer(arbitraryParameters, RedisProperties{}); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := replBacklogSizeForRedisServer(arbitraryParameters, RedisProperties{}); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := replTimeoutForRedisServer(arbitraryParameters, RedisProperties{}); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+func mapNetworksToBoshNetworks(networks []string) []bosh.Network {
+	boshNetworks := []bosh.Network{}
+	for _, network := range networks {
+		boshNetworks = append(boshNetworks, bosh.Network{Name: network})
+	}
+	return boshNetworks
+}
+
+func (m *ManifestGenerator) redisServerNetworks(redisServerInstanceGroup serviceadapter.InstanceGroup) ([]bosh.Network, error) {
+	if len(redisServerInstanceGroup.Networks) > 0 {
+		return mapNetworksToBoshNetworks(redisServerInstanceGroup.Networks), nil
+	}
+
+	if m.DefaultNetworkName != "" {
+		return mapNetworksToBoshNetworks([]string{m.DefaultNetworkName}), nil
+	}
+
+	return nil, operatorError(
+		"no network specified for the %s instance group and no default network is configured",
+		redisServerInstanceGroup.Name,
+	)
+}
+
+// withDefaultNetwork marks the network that supplies DNS and the default
+// gateway, which BOSH needs when an instance group has several networks.
+func withDefaultNetwork(networks []bosh.Network, instanceGroup serviceadapter.InstanceGroup, planProperties serviceadapter.Properties) ([]bosh.Network, error) {
+	configuredNetwork, found := planProperties[DefaultNetworkPropertyKey]
+	if !found {
+		return networks, nil
+	}
+
+	networkName, ok := configuredNetwork.(string)
+	if !ok || networkName == "" {
+		return nil, operatorError("invalid value for plan property '%s': %v, must be a network name", DefaultNetworkPropertyKey, configuredNetwork)
+	}
+
+	var networkNames []string
+	for i, network := range networks {
+		if network.Name == networkName {
+			networks[i].Default = []string{"dns", "gateway"}
+			return networks, nil
+		}
+		networkNames = append(networkNames, network.Name)
+	}
+	return nil, operatorError(
+		"invalid value for plan property '%s': instance group '%s' has no network %s, its networks are: %s",
+		DefaultNetworkPropertyKey,
+		instanceGroup.Name,
+		networkName,
+		strings.Join(networkNames, ", "),
+	)
+}
+
+func withStaticIPs(networks []bosh.Network, instanceGroup serviceadapter.InstanceGroup, planProperties serviceadapter.Properties) ([]bosh.Network, error) {
+	staticIPsByInstanceGroup, _ := planProperties[StaticIPsPropertyKey].(map[string]interface{})
+	configuredIPs, found := staticIPsByInstanceGroup[instanceGroup.Name]
+	if !found {
+		return networks, nil
+	}
+
+	ipList, ok := configuredIPs.([]interface{})
+	if !ok {
+		return nil, operatorError(
+			"invalid value for plan property '%s': %v for instance group '%s', must be a list of IP addresses",
+			StaticIPsPropertyKey,
+			configuredIPs,
+			instanceGroup.Name,
+		)
+	}
+
+	var staticIPs []string
+	for _, ip := range ipList {
+		ipString, ok := ip.(string)
+		if !ok || net.ParseIP(ipString) == nil {
+			return nil, operatorError(
+				"invalid value for plan property '%s': %v for instance group '%s' is not an IP address",
+				StaticIPsPropertyKey,
+				ip,
+				instanceGroup.Name,
+			)
+		}
+		staticIPs = append(staticIPs, ipString)
+	}
+
+	if len(staticIPs) != instanceGroup.Instances {
+		return nil, operatorError(
+			"invalid value for plan property '%s': instance group '%s' has %d instances but %d static IPs, the counts must match",
+			StaticIPsPropertyKey,
+			instanceGroup.Name,
+			instanceGroup.Instances,
+			len(staticIPs),
+		)
+	}
+
+	if len(networks) == 0 {
+		return nil, operatorError(
+			"plan property '%s' is set for instance group '%s' but it has no network",
+			StaticIPsPropertyKey,
+			instanceGroup.Name,
+		)
+	}
+
+	networksWithStaticIPs := append([]bosh.Network{}, networks...)
+	networksWithStaticIPs[0].StaticIPs = staticIPs
+	return networksWithStaticIPs, nil
+}
+
+// deploymentOrderForInstanceGroups maps instance group names to the priority
+// set in the deployment_order plan property. Groups without one default to
+// zero, and the stable sort keeps equal priorities in their generated order.
+func deploymentOrderForInstanceGroups(plan serviceadapter.Plan) (map[string]int, error) {
+	configuredOrder, found := plan.Properties[DeploymentOrderPropertyKey]
+	if !found {
+		return nil, nil
+	}
+
+	orderByName, ok := configuredOrder.(map[string]interface{})
+	if !ok {
+		return nil, operatorError("invalid value for plan property '%s': %v, must be a map of instance group names to integers", DeploymentOrderPropertyKey, configuredOrder)
+	}
+
+	order := map[string]int{}
+	var unknownGroups []string
+	for name, configuredPriority := range orderByName {
+		if findInstanceGroup(plan, name) == nil {
+			unknownGroups = append(unknownGroups, name)
+			continue
+		}
+		priority, ok := toInt(configuredPriority)
+		if !ok {
+			return nil, operatorError("invalid value for plan property '%s': %v for instance group '%s', must be an integer", DeploymentOrderPropertyKey, configuredPriority, name)
+		}
+		order[name] = priority
+	}
+	if len(unknownGroups) > 0 {
+		sort.Strings(unknownGroups)
+		return nil, operatorError("plan property '%s' names unknown instance group(s): %s", DeploymentOrderPropertyKey, strings.Join(unknownGroups, ", "))
+	}
+	return order, nil
+}
+
+func randomPasswordGenerator(length int) (string, error) {
+	randomBytes := make([]byte, length)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		log.Printf("Error generating random bytes, %v", err)
+		return "", err
+	}
+	randomStringBytes := make([]byte, base64.StdEncoding.EncodedLen(len(randomBytes)))
+	base64.StdEncoding.Encode(randomStringBytes, randomBytes)
+	return string(randomStringBytes), nil
+}
+
+func findInstanceGroups(plan serviceadapter.Plan, instanceGroupName string) []*serviceadapter.InstanceGroup {
+	var instanceGroups []*serviceadapter.InstanceGroup
+	for i := range plan.InstanceGroups {
+		if plan.InstanceGroups[i].Name == instanceGroupName {
+			instanceGroups = append(instanceGroups, &plan.InstanceGroups[i])
+		}
+	}
+	return instanceGroups
+}
+
+func findInstanceGroup(plan serviceadapter.Plan, instanceGroupName string) *serviceadapter.InstanceGroup {
+	instanceGroups := findInstanceGroups(plan, instanceGroupName)
+	if len(instanceGroups) == 0 {
+		return nil
+	}
+	return instanceGroups[0]
+}
+
+func (m *ManifestGenerator) findRedisServerInstanceGroup(plan serviceadapter.Plan) *serviceadapter.InstanceGroup {
+	return findInstanceGroup(plan, m.Config.RedisInstanceGroupName)
+}
+
+func findHealthCheckInstanceGroup(plan serviceadapter.Plan) *serviceadapter.InstanceGroup {
+	return findInstanceGroup(plan, HealthCheckErrandName)
+}
+
+func findTrainingInsertInstanceGroup(plan serviceadapter.Plan) *serviceadapter.InstanceGroup {
+        return findInstanceGroup(plan, TrainingInsertErrandName)
+}
+
+func findCleanupDataInstanceGroup(plan serviceadapter.Plan) *serviceadapter.InstanceGroup {
+	return findInstanceGroup(plan, CleanupDataErrandName)
+}
+
+var versionRegexp = regexp.MustCompile(`^(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:\+dev\.(\d+))?`)
+
+// boshReleaseVersion orders BOSH release versions. A dev build N+dev.M is cut
+// after the final release N and before the next one, so its dev number is
+// compared only once the released components are equal.
+type boshReleaseVersion struct {
+	major, minor, patch, dev int
+}
+
+func parseReleaseVersion(versionString string) (boshReleaseVersion, error) {
+	submatches := versionRegexp.FindStringSubmatch(versionString)
+
+	if len(submatches) == 0 {
+		return boshReleaseVersion{}, fmt.Errorf("%s is not a valid BOSH release version", versionString)
+	}
+
+	components := make([]int, 4)
+	for i, submatch := range submatches[1:] {
+		if submatch == "" {
+			continue
+		}
+		component, err := strconv.Atoi(submatch)
+		if err != nil {
+			return boshReleaseVersion{}, err
+		}
+		components[i] = component
+	}
+
+	return boshReleaseVersion{major: components[0], minor: components[1], patch: components[2], dev: components[3]}, nil
+}
+
+func generateUpdateBlock(update *serviceadapter.Update, previousManifest *bosh.BoshManifest, planProperties serviceadapter.Properties, defaults UpdateDefaultConfig) (*bosh.Update, error) {
+	if update != nil {
+		if err := validWatchTime("canary_watch_time", update.CanaryWatchTime); err != nil {
+			return nil, err
+		}
+		if err := validWatchTime("update_watch_time", update.UpdateWatchTime); err != nil {
+			return nil, err
+		}
+	}
+
+	updateBlock := defaultUpdateBlock(update, previousManifest, defaults)
+
+	strategy, found := planProperties[UpgradeStrategyPropertyKey]
+	if !found {
+		return updateBlock, nil
+	}
+
+	switch strategy {
+	case UpgradeStrategyRolling:
+		updateBlock.Canaries = 0
+		updateBlock.MaxInFlight = "100%"
+	case UpgradeStrategyCanary:
+	case UpgradeStrategyOneAtATime:
+		updateBlock.Canaries = 1
+		updateBlock.MaxInFlight = 1
+		updateBlock.Serial = bosh.BoolPointer(true)
+	default:
+		return nil, operatorError(
+			"invalid value for plan property '%s': %v, must be one of %s, %s, %s",
+			UpgradeStrategyPropertyKey,
+			strategy,
+			UpgradeStrategyRolling,
+			UpgradeStrategyCanary,
+			UpgradeStrategyOneAtATime,
+		)
+	}
+	return updateBlock, nil
+}
+
+var watchTimeRegexp = regexp.MustCompile(`^\d+-\d+$`)
+
+func validWatchTime(field, watchTime string) error {
+	if !watchTimeRegexp.MatchString(watchTime) {
+		return operatorError("invalid value for plan update '%s': %q, must be a min-max range in milliseconds such as 30000-240000", field, watchTime)
+	}
+	return nil
+}
+
+func defaultUpdateBlock(update *serviceadapter.Update, previousManifest *bosh.BoshManifest, defaults UpdateDefaultConfig) *bosh.Update {
+	if update != nil {
+		return &bosh.Update{
+			Canaries:        update.Canaries,
+			MaxInFlight:     update.MaxInFlight,
+			CanaryWatchTime: update.CanaryWatchTime,
+			UpdateWatchTime: update.UpdateWatchTime,
+			Serial:          update.Serial,
+		}
+	} else {
+		updateBlock := &bosh.Update{
+			Canaries:        *defaults.Canaries,
+			CanaryWatchTime: defaults.CanaryWatchTime,
+			UpdateWatchTime: defaults.UpdateWatchTime,
+			MaxInFlight:     defaults.MaxInFlight,
+			VmStrategy:      "delete-create",
+		}
+
 		if previousManifest == nil {
 			return updateBlock
 		}
 
-		updateBlock.Canaries = 1
-		updateBlock.MaxInFlight = 1
-		return updateBlock
+		updateBlock.Canaries = 1
+		updateBlock.MaxInFlight = 1
+		return updateBlock
+	}
+}
+
+func gatherJob(releases serviceadapter.ServiceReleases, jobName string) (bosh.Job, error) {
+	return gatherPinnedJob(releases, jobName, "")
+}
+
+func gatherPinnedJob(releases serviceadapter.ServiceReleases, jobName, pinnedReleaseName string) (bosh.Job, error) {
+	release, err := findReleaseForJob(jobName, releases, pinnedReleaseName)
+	if err != nil {
+		return bosh.Job{}, err
+	}
+	return bosh.Job{Name: jobName, Release: release.Name}, nil
+}
+
+func redisReleaseName(planProperties serviceadapter.Properties) string {
+	releaseName, _ := planProperties[RedisReleaseNamePropertyKey].(string)
+	return releaseName
+}
+
+// redisJobName is the job to look for in the releases. Some community
+// releases call it redis rather than redis-server; the instance group name is
+// configured separately.
+func redisJobName(planProperties serviceadapter.Properties) string {
+	if jobName, _ := planProperties[RedisJobNamePropertyKey].(string); jobName != "" {
+		return jobName
+	}
+	return RedisJobName
+}
+
+func (m *ManifestGenerator) gatherRedisServerJob(releases serviceadapter.ServiceReleases, jobName, pinnedReleaseName, exportedAs string) (bosh.Job, error) {
+	redisServerJob, err := gatherPinnedJob(releases, jobName, pinnedReleaseName)
+	if err != nil {
+		return bosh.Job{}, operatorError("error gathering redis server job: %s", err)
+	}
+	redisServerJob = redisServerJob.AddCustomProviderDefinition("redis-server-link", "address", nil)
+	redisServerJob = redisServerJob.AddSharedProvidesLink("redis")
+	if exportedAs != "" {
+		redisServerJob.Provides["redis"] = bosh.ProvidesLink{As: exportedAs, Shared: true}
+	}
+	return redisServerJob, nil
+}
+
+func gatherCoLocatedJobs(releases serviceadapter.ServiceReleases, planProperties serviceadapter.Properties) ([]bosh.Job, error) {
+	configuredJobs, found := planProperties[CoLocateJobsPropertyKey]
+	if !found {
+		return nil, nil
+	}
+
+	jobList, ok := configuredJobs.([]interface{})
+	if !ok {
+		return nil, operatorError("invalid value for plan property '%s': must be a list of jobs with a name and release", CoLocateJobsPropertyKey)
+	}
+
+	var jobs []bosh.Job
+	for _, configuredJob := range jobList {
+		jobDefinition, _ := configuredJob.(map[string]interface{})
+		name, _ := jobDefinition["name"].(string)
+		releaseName, _ := jobDefinition["release"].(string)
+		if name == "" || releaseName == "" {
+			return nil, operatorError("invalid value for plan property '%s': must be a list of jobs with a name and release", CoLocateJobsPropertyKey)
+		}
+
+		if name == redisJobName(planProperties) {
+			return nil, operatorError("co-located job %s duplicates the primary job", name)
+		}
+
+		if !releaseExists(releases, releaseName) {
+			return nil, operatorError("release %s for co-located job %s is not part of the service deployment", releaseName, name)
+		}
+
+		job := bosh.Job{Name: name, Release: releaseName}
+		// Only jobs whose spec declares the link may consume it, so the
+		// operator opts each one in.
+		if configuredConsumes, found := jobDefinition[ConsumesRedisLinkKey]; found {
+			consumesRedis, ok := configuredConsumes.(bool)
+			if !ok {
+				return nil, operatorError("invalid value for '%s' of co-located job %s: %v, must be a boolean", ConsumesRedisLinkKey, name, configuredConsumes)
+			}
+			if consumesRedis {
+				exportedAs, _ := planProperties[ExportedAsPropertyKey].(string)
+				job = job.AddConsumesLink("redis", redisLinkName(exportedAs))
+			}
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func releaseVersion(releases serviceadapter.ServiceReleases, releaseName string) string {
+	for _, release := range releases {
+		if release.Name == releaseName {
+			return release.Version
+		}
+	}
+	return ""
+}
+
+func releaseExists(releases serviceadapter.ServiceReleases, releaseName string) bool {
+	for _, release := range releases {
+		if release.Name == releaseName {
+			return true
+		}
+	}
+	return false
+}
+
+func gatherHealthCheckJob(releases serviceadapter.ServiceReleases) (bosh.Job, error) {
+	return gatherJob(releases, HealthCheckErrandName)
+}
+
+func gatherTrainingInsertJob(releases serviceadapter.ServiceReleases) (bosh.Job, error) {
+        return gatherJob(releases, TrainingInsertErrandName)
+}
+
+func gatherCleanupDataJob(releases serviceadapter.ServiceReleases) (bosh.Job, error) {
+	return gatherJob(releases, CleanupDataErrandName)
+}
+
+func findReleaseForJob(requiredJob string, releases serviceadapter.ServiceReleases, pinnedReleaseName string) (serviceadapter.ServiceRelease, error) {
+	releasesThatProvideRequiredJob := serviceadapter.ServiceReleases{}
+
+	for _, release := range releases {
+		for _, providedJob := range release.Jobs {
+			if providedJob == requiredJob {
+				releasesThatProvideRequiredJob = append(releasesThatProvideRequiredJob, release)
+			}
+		}
+	}
+
+	if len(releasesThatProvideRequiredJob) == 0 {
+		if len(releases) == 0 {
+			return serviceadapter.ServiceRelease{}, fmt.Errorf("no release provided for job %s", requiredJob)
+		}
+		var providedJobs []string
+		for _, release := range releases {
+			providedJobs = append(providedJobs, fmt.Sprintf("%s (%s)", release.Name, strings.Join(release.Jobs, ", ")))
+		}
+		return serviceadapter.ServiceRelease{}, fmt.Errorf("no release provided for job %s, releases provide: %s", requiredJob, strings.Join(providedJobs, "; "))
+	}
+
+	if pinnedReleaseName != "" {
+		for _, release := range releasesThatProvideRequiredJob {
+			if release.Name == pinnedReleaseName {
+				return release, nil
+			}
+		}
+		return serviceadapter.ServiceRelease{}, fmt.Errorf("pinned release %s does not provide job %s", pinnedReleaseName, requiredJob)
+	}
+
+	if len(releasesThatProvideRequiredJob) > 1 {
+		releaseNames := []string{}
+		for _, release := range releasesThatProvideRequiredJob {
+			releaseNames = append(releaseNames, release.Name)
+		}
+
+		return serviceadapter.ServiceRelease{}, fmt.Errorf("job %s defined in multiple releases: %s", requiredJob, strings.Join(releaseNames, ", "))
+	}
+
+	return releasesThatProvideRequiredJob[0], nil
+}
+
+// propertyScope is where the redis properties are written: on the instance
+// group, as the adapter always has, or on the redis-server job itself.
+func propertyScope(planProperties serviceadapter.Properties) (string, error) {
+	configuredScope, found := planProperties[PropertyScopePropertyKey]
+	if !found {
+		return PropertyScopeInstanceGroup, nil
+	}
+
+	switch configuredScope {
+	case PropertyScopeInstanceGroup, PropertyScopeJob:
+		return configuredScope.(string), nil
+	}
+	return "", operatorError(
+		"invalid value for plan property '%s': %v, must be %s or %s",
+		PropertyScopePropertyKey,
+		configuredScope,
+		PropertyScopeJob,
+		PropertyScopeInstanceGroup,
+	)
+}
+
+// instanceGroupRedisProperties finds the redis properties of an instance
+// group, whether they were written at the instance group or the job level.
+func instanceGroupRedisProperties(instanceGroup bosh.InstanceGroup) (interface{}, bool) {
+	if properties, found := instanceGroup.Properties["redis"]; found {
+		return properties, true
+	}
+	for _, job := range instanceGroup.Jobs {
+		if properties, found := job.Properties["redis"]; found {
+			return properties, true
+		}
+	}
+	return nil, false
+}
+
+func redisPlanProperties(manifest bosh.BoshManifest, instanceGroupName string) (map[interface{}]interface{}, error) {
+	var redisInstanceGroup *bosh.InstanceGroup
+	for i, instanceGroup := range manifest.InstanceGroups {
+		if instanceGroup.Name == instanceGroupName {
+			redisInstanceGroup = &manifest.InstanceGroups[i]
+			break
+		}
+	}
+	if redisInstanceGroup == nil {
+		for i, instanceGroup := range manifest.InstanceGroups {
+			if _, found := instanceGroupRedisProperties(instanceGroup); found {
+				redisInstanceGroup = &manifest.InstanceGroups[i]
+				break
+			}
+		}
+	}
+	if redisInstanceGroup == nil {
+		return nil, fmt.Errorf("no instance group with redis properties found in manifest %s", manifest.Name)
+	}
+
+	rawProperties, _ := instanceGroupRedisProperties(*redisInstanceGroup)
+	properties, ok := interfaceKeyedMap(rawProperties)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %T for redis properties of instance group %s", rawProperties, redisInstanceGroup.Name)
+	}
+	return properties, nil
+}
+
+func (m ManifestGenerator) redisServerProperties(
+	deploymentName string,
+	planProperties serviceadapter.Properties,
+	arbitraryParams map[string]interface{},
+	previousManifest *bosh.BoshManifest,
+	newSecrets serviceadapter.ODBManagedSecrets,
+	previousSecrets serviceadapter.ManifestSecrets,
+	operation Operation) (map[string]interface{}, error) {
+	var previousRedisProperties map[interface{}]interface{}
+	var previous *RedisProperties
+	if previousManifest != nil {
+		var err error
+		previousRedisProperties, err = redisPlanProperties(*previousManifest, m.Config.RedisInstanceGroupName)
+		if err != nil {
+			m.events.Manifest(LogLevelError, "could not read the redis properties from the previous manifest", previousManifest)
+			return nil, operatorError("error reading the previous manifest: %s", err)
+		}
+		parsed, err := FromBOSHProperties(previousRedisProperties)
+		if err != nil {
+			m.events.Manifest(LogLevelError, "could not read the redis properties from the previous manifest", previousManifest)
+			return nil, operatorError("error reading the previous manifest: %s", err)
+		}
+		previous = &parsed
+	}
+
+	persistence, err := m.persistenceForRedisServer(planProperties)
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := m.passwordForRedisServer(previous, newSecrets)
+	if err != nil {
+		return nil, err
+	}
+
+	maxClients, err := maxClientsForRedisServer(arbitraryParams, planProperties, previous, m.AdapterConfig.withDefaults().MaxClients)
+	if err != nil {
+		return nil, err
+	}
+	maxClients = m.clampMaxClients(maxClients, planProperties)
+
+	drainTimeout, err := drainTimeoutForRedisServer(planProperties)
+	if err != nil {
+		return nil, err
+	}
+
+	if previous == nil {
+		previous = &RedisProperties{}
+	}
+
+	properties := RedisProperties{
+		Persistence:     persistence,
+		Password:        password,
+		MaxClients:      maxClients,
+		DrainTimeout:    drainTimeout,
+		GeneratedSecret: "((" + GeneratedSecretVariableName + "))",
+		ManagedSecret:   managedSecretKeyForRedisServer(*previous, m.Config.IgnoreODBManagedSecretOnUpdate),
+		CACert:          "((" + CertificateVariableName + ".ca))",
+		Certificate:     "((" + CertificateVariableName + ".certificate))",
+		PrivateKey:      "((" + CertificateVariableName + ".private_key))",
+		SchemaVersion:   CurrentPropertiesSchemaVersion,
+	}
+
+	if port := m.AdapterConfig.withDefaults().Port; port != RedisServerPort {
+		properties.Port = port
+	}
+
+	if secretFromPlan, exists := planProperties["plan_secret"]; exists && m.Config.SecureManifestsEnabled {
+		secretKey := "plan_secret_key" + uuid.New()[:6]
+		newSecrets[secretKey] = secretFromPlan
+		planSecret := fmt.Sprintf("((%s:%s))", serviceadapter.ODBSecretPrefix, secretKey)
+		if previousSecrets != nil {
+			existingCredhubPath := previous.PlanSecret
+			if existingCredhubPath != "" && previousSecrets[existingCredhubPath] == secretFromPlan {
+				planSecret = existingCredhubPath
+				delete(newSecrets, secretKey)
+			}
+		}
+		properties.PlanSecret = planSecret
+	}
+
+	if secretPath, ok := arbitraryParams["credhub_secret_path"]; ok {
+		properties.Secret = "((" + secretPath.(string) + "))"
+	} else {
+		properties.Secret = previous.Secret
+	}
+
+	maxMemory, err := maxMemoryForRedisServer(arbitraryParams, planProperties, *previous)
+	if err != nil {
+		return nil, err
+	}
+	properties.MaxMemory = maxMemory
+
+	lazyFree, err := lazyFreeForRedisServer(arbitraryParams, *previous)
+	if err != nil {
+		return nil, err
+	}
+	properties.LazyFree = lazyFree
+
+	evictionTenacity, err := evictionTenacityForRedisServer(arbitraryParams, *previous)
+	if err != nil {
+		return nil, err
+	}
+	properties.EvictionTenacity = evictionTenacity
+
+	hz, err := hzForRedisServer(arbitraryParams, *previous)
+	if err != nil {
+		return nil, err
+	}
+	properties.Hz = hz
+
+	dynamicHz, err := yesNoParamForRedisServer(DynamicHzKey, arbitraryParams, previous.DynamicHz)
+	if err != nil {
+		return nil, err
+	}
+	properties.DynamicHz = dynamicHz
+	activeRehashing, err := yesNoParamForRedisServer(ActiveRehashingKey, arbitraryParams, previous.ActiveRehashing)
+	if err != nil {
+		return nil, err
+	}
+	properties.ActiveRehashing = activeRehashing
+
+	encodingLimits, err := encodingLimitsForRedisServer(arbitraryParams, *previous)
+	if err != nil {
+		return nil, err
+	}
+	properties.EncodingLimits = encodingLimits
+
+	replBacklogSize, err := replBacklogSizeForRedisServer(arbitraryParams, *previous)
+	if err != nil {
+		return nil, err
+	}
+	properties.ReplBacklogSize = replBacklogSize
+
+	replTimeout, err := replTimeoutForRedisServer(arbitraryParams, *previous)
+	if err != nil {
+		return nil, err
+	}
+	properties.ReplTimeout = replTimeout
+
+	logLevel, err := logLevelForRedisServer(arbitraryParams, planProperties, *previous)
+	if err != nil {
+		return nil, err
+	}
+	properties.LogLevel = logLevel
+
+	unixSocket, unixSocketPerm, err := unixSocketForRedisServer(arbitraryParams, *previous)
+	if err != nil {
+		return nil, err
+	}
+	properties.UnixSocket = unixSocket
+	properties.UnixSocketPerm = unixSocketPerm
+
+	if configuredTTL, found := planProperties[BindingTTLSecondsPropertyKey]; found {
+		bindingTTL, ok := toInt(configuredTTL)
+		if !ok || bindingTTL <= 0 {
+			return nil, operatorError("invalid value for plan property '%s': %v, must be a positive integer number of seconds", BindingTTLSecondsPropertyKey, configuredTTL)
+		}
+		properties.BindingTTLSeconds = bindingTTL
+	}
+
+	if configuredShareable, found := planProperties[ShareablePropertyKey]; found {
+		shareable, ok := configuredShareable.(bool)
+		if !ok {
+			return nil, operatorError("invalid value for plan property '%s': %v, must be a boolean", ShareablePropertyKey, configuredShareable)
+		}
+		properties.Shareable = shareable
+	}
+
+	if configuredCluster, found := planProperties[ClusterEnabledPropertyKey]; found {
+		clusterEnabled, ok := configuredCluster.(bool)
+		if !ok {
+			return nil, operatorError("invalid value for plan property '%s': %v, must be a boolean", ClusterEnabledPropertyKey, configuredCluster)
+		}
+		if clusterEnabled {
+			properties.ClusterEnabled = "yes"
+		}
+	}
+
+	systemdOverrides, err := systemdOverridesForRedisServer(planProperties)
+	if err != nil {
+		return nil, err
+	}
+	properties.SystemdOverrides = systemdOverrides
+
+	tlsCertificate := "((" + TLSCertificateVariableName + ".certificate))"
+	tlsEnabled, _ := planProperties[TLSEnabledPropertyKey].(bool)
+	if tlsEnabled {
+		properties.CACert = "((" + TLSCertificateVariableName + ".ca))"
+		properties.Certificate = tlsCertificate
+		properties.PrivateKey = "((" + TLSCertificateVariableName + ".private_key))"
+		properties.TLSClientCertificate = "((" + TLSKeyVariableName + ".certificate))"
+		properties.TLSClientPrivateKey = "((" + TLSKeyVariableName + ".private_key))"
+		properties.TLSPort = RedisServerTLSPort
+	}
+
+	if ipv6Enabled, _ := planProperties[IPv6EnabledPropertyKey].(bool); ipv6Enabled {
+		properties.Bind = "::"
+	}
+
+	protectedMode, err := protectedModeForRedisServer(planProperties)
+	if err != nil {
+		return nil, err
+	}
+	properties.ProtectedMode = protectedMode
+
+	maintenanceMode, err := maintenanceModeForRedisServer(arbitraryParams, *previous, operation)
+	if err != nil {
+		return nil, err
+	}
+	if maintenanceMode {
+		m.events.Warn(fmt.Sprintf("%s is enabled: redis only listens on %s and does not require a password", MaintenanceModeKey, MaintenanceBindAddress))
+		properties.MaintenanceMode = true
+		properties.Bind = MaintenanceBindAddress
+	}
+
+	// The TLS settings written for a plan that has since disabled TLS go along
+	// with its certificate instead of being carried forward.
+	tlsDisabled := !tlsEnabled && previous.Certificate == tlsCertificate
+
+	// Whatever the adapter does not manage, such as a property an operator
+	// hot-patched into the deployment, survives regeneration unless the plan
+	// asks for it to be discarded.
+	discardUnmanaged, err := discardUnmanagedPropertiesForRedisServer(planProperties)
+	if err != nil {
+		return nil, err
+	}
+	if !discardUnmanaged {
+		if properties.TLSPort == 0 && !tlsDisabled {
+			properties.TLSPort = previous.TLSPort
+		}
+		properties.BindHostname = previous.BindHostname
+		properties.Extra = previous.Extra
+	}
+
+	redisProperties := properties.ToBOSHProperties()
+	if operation == OperationUpgrade && !discardUnmanaged {
+		for key, value := range previousRedisProperties {
+			if tlsDisabled && (key == TLSPortKey || key == TLSClientCertificateKey || key == TLSClientPrivateKeyKey) {
+				continue
+			}
+			if _, found := redisProperties[key]; !found {
+				redisProperties[key] = value
+			}
+		}
+	}
+
+	return map[string]interface{}{
+		"redis": redisProperties,
+	}, nil
+}
+
+// redisCheckJob returns nil unless the plan enables active health checking.
+// The job finds the host and port through the redis link rather than through
+// properties of its own.
+func redisCheckJob(releases serviceadapter.ServiceReleases, planProperties serviceadapter.Properties, exportedAs string) (*bosh.Job, error) {
+	configuredEnabled, found := planProperties[HealthCheckEnabledPropertyKey]
+	if !found {
+		return nil, nil
+	}
+	enabled, ok := configuredEnabled.(bool)
+	if !ok {
+		return nil, operatorError("invalid value for plan property '%s': %v, must be a boolean", HealthCheckEnabledPropertyKey, configuredEnabled)
+	}
+	if !enabled {
+		return nil, nil
+	}
+
+	interval := DefaultHealthCheckIntervalSeconds
+	if configuredInterval, found := planProperties[HealthCheckIntervalPropertyKey]; found {
+		var ok bool
+		interval, ok = toInt(configuredInterval)
+		if !ok || interval <= 0 {
+			return nil, operatorError("invalid value for plan property '%s': %v, must be a positive integer number of seconds", HealthCheckIntervalPropertyKey, configuredInterval)
+		}
+	}
+
+	release, err := findReleaseForJob(RedisCheckJobName, releases, "")
+	if err != nil {
+		return nil, operatorError("plan property '%s' is set but %s", HealthCheckEnabledPropertyKey, err)
+	}
+
+	job := bosh.Job{
+		Name:       RedisCheckJobName,
+		Release:    release.Name,
+		Properties: map[string]interface{}{"check_interval_seconds": interval},
+	}.AddConsumesLink("redis", redisLinkName(exportedAs))
+	return &job, nil
+}
+
+// colocatedSmokeTestsJob returns nil unless the plan runs the smoke tests on
+// the redis server VMs instead of on an errand VM of their own. BOSH runs a
+// job with a run script as an errand wherever it is placed, and the job reads
+// the address and password from the redis link.
+func colocatedSmokeTestsJob(releases serviceadapter.ServiceReleases, planProperties serviceadapter.Properties, exportedAs string) (*bosh.Job, error) {
+	configuredEnabled, found := planProperties[ColocatedSmokeTestsPropertyKey]
+	if !found {
+		return nil, nil
+	}
+	enabled, ok := configuredEnabled.(bool)
+	if !ok {
+		return nil, operatorError("invalid value for plan property '%s': %v, must be a boolean", ColocatedSmokeTestsPropertyKey, configuredEnabled)
+	}
+	if !enabled {
+		return nil, nil
+	}
+
+	release, err := findReleaseForJob(SmokeTestsJobName, releases, "")
+	if err != nil {
+		return nil, operatorError("plan property '%s' is set but %s", ColocatedSmokeTestsPropertyKey, err)
+	}
+
+	job := bosh.Job{Name: SmokeTestsJobName, Release: release.Name}.AddConsumesLink("redis", redisLinkName(exportedAs))
+	return &job, nil
+}
+
+// redisLinkName is what consumers name as the source of the redis link that
+// the redis-server job provides.
+func redisLinkName(exportedAs string) string {
+	if exportedAs != "" {
+		return exportedAs
+	}
+	return "redis"
+}
+
+func consulProperties(serviceName string, port int) map[interface{}]interface{} {
+	return map[interface{}]interface{}{
+		"services": map[interface{}]interface{}{
+			serviceName: map[interface{}]interface{}{
+				"name": serviceName,
+				"check": map[interface{}]interface{}{
+					"tcp":      fmt.Sprintf("127.0.0.1:%d", port),
+					"interval": "10s",
+				},
+			},
+		},
+	}
+}
+
+func managedSecretKeyForRedisServer(previous RedisProperties, ignoreODBSecret bool) string {
+	if previous.ManagedSecret != "" && !ignoreODBSecret {
+		return previous.ManagedSecret
+	}
+
+	return "((" + serviceadapter.ODBSecretPrefix + ":" + ManagedSecretKey + "))"
+}
+
+// passwordForRedisServer keeps whatever the previous manifest holds, which is
+// either a literal password or a reference to the ODB-managed secret. New
+// passwords are handed to the broker as an ODB-managed secret when secure
+// manifests are enabled.
+func (m *ManifestGenerator) passwordForRedisServer(previous *RedisProperties, newSecrets serviceadapter.ODBManagedSecrets) (string, error) {
+	if previous != nil {
+		if previous.Password != "" {
+			return previous.Password, nil
+		}
+		m.events.Info("no password found in the previous manifest, generating a new one")
+	}
+
+	password, err := CurrentPasswordGenerator(m.AdapterConfig.withDefaults().PasswordLength)
+	if err != nil || !m.Config.SecureManifestsEnabled {
+		return password, err
+	}
+	newSecrets[PasswordSecretName] = password
+	return "((" + serviceadapter.ODBSecretPrefix + ":" + PasswordSecretName + "))", nil
+}
+
+func maxClientsForRedisServer(arbitraryParams map[string]interface{}, planProperties serviceadapter.Properties, previous *RedisProperties, defaultMaxClients int) (int, error) {
+	lowerBound, upperBound, err := maxClientsBounds(planProperties)
+	if err != nil {
+		return 0, err
+	}
+
+	if configuredMax, ok := arbitraryParams["maxclients"]; ok {
+		maxClients, ok := toInt(configuredMax)
+		if !ok {
+			return 0, userError("invalid value for parameter 'maxclients': %v, must be an integer", configuredMax)
+		}
+		if !withinMaxClientsBounds(maxClients, lowerBound, upperBound) {
+			return 0, userError("invalid value for parameter 'maxclients': %v, this plan allows %s", configuredMax, describeMaxClientsBounds(lowerBound, upperBound))
+		}
+		return maxClients, nil
+	} else if previous != nil && previous.MaxClients != 0 {
+		return previous.MaxClients, nil
+	}
+
+	// A plan whose range excludes the adapter default is misconfigured rather
+	// than something to paper over by clamping.
+	if !withinMaxClientsBounds(defaultMaxClients, lowerBound, upperBound) {
+		return 0, operatorError(
+			"the default maxclients %d is outside the range this plan allows (%s), adjust plan properties '%s' and '%s' or the adapter's maxclients",
+			defaultMaxClients,
+			describeMaxClientsBounds(lowerBound, upperBound),
+			MaxClientsMinPropertyKey,
+			MaxClientsMaxPropertyKey,
+		)
+	}
+	return defaultMaxClients, nil
+}
+
+func withinMaxClientsBounds(maxClients, lowerBound, upperBound int) bool {
+	return (lowerBound == 0 || maxClients >= lowerBound) && (upperBound == 0 || maxClients <= upperBound)
+}
+
+// maxClientsBounds returns the plan's range for maxclients, where 0 means the
+// plan sets no bound on that side.
+func maxClientsBounds(planProperties serviceadapter.Properties) (int, int, error) {
+	bound := func(key string) (int, error) {
+		configured, found := planProperties[key]
+		if !found {
+			return 0, nil
+		}
+		value, ok := toInt(configured)
+		if !ok || value <= 0 {
+			return 0, operatorError("invalid value for plan property '%s': %v, must be a positive integer", key, configured)
+		}
+		return value, nil
+	}
+
+	lowerBound, err := bound(MaxClientsMinPropertyKey)
+	if err != nil {
+		return 0, 0, err
+	}
+	upperBound, err := bound(MaxClientsMaxPropertyKey)
+	if err != nil {
+		return 0, 0, err
+	}
+	if upperBound != 0 && lowerBound > upperBound {
+		return 0, 0, operatorError(
+			"invalid maxclients bounds: plan property '%s' (%d) is greater than '%s' (%d)",
+			MaxClientsMinPropertyKey,
+			lowerBound,
+			MaxClientsMaxPropertyKey,
+			upperBound,
+		)
+	}
+	return lowerBound, upperBound, nil
+}
+
+func describeMaxClientsBounds(lowerBound, upperBound int) string {
+	switch {
+	case upperBound == 0:
+		return fmt.Sprintf("at least %d", lowerBound)
+	case lowerBound == 0:
+		return fmt.Sprintf("at most %d", upperBound)
+	}
+	return fmt.Sprintf("between %d and %d", lowerBound, upperBound)
+}
+
+// clampMaxClients brings a maxclients carried over from the previous manifest
+// into the plan's range, so that moving to a stricter plan does not fail the
+// update.
+func (m ManifestGenerator) clampMaxClients(maxClients int, planProperties serviceadapter.Properties) int {
+	lowerBound, upperBound, err := maxClientsBounds(planProperties)
+	if err != nil {
+		return maxClients
+	}
+
+	clamped := maxClients
+	if lowerBound != 0 && clamped < lowerBound {
+		clamped = lowerBound
+	}
+	if upperBound != 0 && clamped > upperBound {
+		clamped = upperBound
+	}
+	if clamped != maxClients {
+		m.events.Warn(fmt.Sprintf("maxclients %d is outside the range this plan allows (%s), using %d", maxClients, describeMaxClientsBounds(lowerBound, upperBound), clamped))
+	}
+	return clamped
+}
+
+var memorySizeRegexp = regexp.MustCompile(`^(\d+)(kb|mb|gb)?$`)
+
+func parseMemorySize(value interface{}) (int64, error) {
+	var size string
+	switch v := value.(type) {
+	case string:
+		size = strings.ToLower(strings.TrimSpace(v))
+	default:
+		bytes, ok := toInt(v)
+		if !ok {
+			return 0, fmt.Errorf("%v is not a valid memory size", value)
+		}
+		size = strconv.Itoa(bytes)
+	}
+
+	submatches := memorySizeRegexp.FindStringSubmatch(size)
+	if submatches == nil {
+		return 0, fmt.Errorf("%v is not a valid memory size", value)
+	}
+
+	bytes, err := strconv.ParseInt(submatches[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%v is not a valid memory size", value)
+	}
+
+	switch submatches[2] {
+	case "kb":
+		bytes *= 1024
+	case "mb":
+		bytes *= 1024 * 1024
+	case "gb":
+		bytes *= 1024 * 1024 * 1024
+	}
+	return bytes, nil
+}
+
+func maxMemoryForRedisServer(arbitraryParams map[string]interface{}, planProperties serviceadapter.Properties, previous RedisProperties) (string, error) {
+	configuredMaxMemory, found := arbitraryParams[MaxMemoryKey]
+	if !found {
+		return previous.MaxMemory, nil
+	}
+
+	maxMemory, err := parseMemorySize(configuredMaxMemory)
+	if err != nil {
+		return "", userError("invalid value for parameter '%s': %s", MaxMemoryKey, err)
+	}
+
+	if configuredLimit, found := planProperties[MaxMemoryLimitPropertyKey]; found {
+		limit, err := parseMemorySize(configuredLimit)
+		if err != nil {
+			return "", operatorError("invalid value for plan property '%s': %s", MaxMemoryLimitPropertyKey, err)
+		}
+		if maxMemory > limit {
+			return "", userError(
+				"requested %s %v exceeds the plan limit of %v",
+				MaxMemoryKey,
+				configuredMaxMemory,
+				configuredLimit,
+			)
+		}
+	}
+
+	return strconv.FormatInt(maxMemory, 10), nil
+}
+
+func replBacklogSizeForRedisServer(arbitraryParams map[string]interface{}, previous RedisProperties) (string, error) {
+	configuredSize, found := arbitraryParams[ReplBacklogSizeKey]
+	if !found {
+		return previous.ReplBacklogSize, nil
+	}
+
+	size, err := parseMemorySize(configuredSize)
+	if err != nil {
+		return "", userError("invalid value for parameter '%s': %s", ReplBacklogSizeKey, err)
+	}
+	if size == 0 {
+		return "", userError("invalid value for parameter '%s': %v, must be greater than zero", ReplBacklogSizeKey, configuredSize)
+	}
+	return strconv.FormatInt(size, 10), nil
+}
+
+func replTimeoutForRedisServer(arbitraryParams map[string]interface{}, previous RedisProperties) (int, error) {
+	configuredTimeout, found := arbitraryParams[ReplTimeoutKey]
+	if !found {
+		return previous.ReplTimeout, nil
+	}
+
+	timeout, ok := toInt(configuredTimeout)
+	if !ok || timeout <= 0 {
+		return 0, userError("invalid value for parameter '%s': %v, must be a positive integer number of seconds", ReplTimeoutKey, configuredTimeout)
+	}
+	return timeout, nil
+}
+
+// logLevelForRedisServer keeps the level of the previous manifest unless the
+// parameter is given. An explicit null goes back to the plan's
+// default_loglevel, and without one the property is left for redis to default.
+func logLevelForRedisServer(arbitraryParams map[string]interface{}, planProperties serviceadapter.Properties, previous RedisProperties) (string, error) {
+	planDefault := ""
+	if configured, found := planProperties[DefaultLogLevelPropertyKey]; found {
+		level, ok := configured.(string)
+		if !ok || !isRedisLogLevel(level) {
+			return "", operatorError("invalid value for plan property '%s': %v, must be one of %s", DefaultLogLevelPropertyKey, configured, strings.Join(redisLogLevels, ", "))
+		}
+		planDefault = level
+	}
+
+	configured, found := arbitraryParams[RedisLogLevelKey]
+	switch {
+	case !found && previous.LogLevel != "":
+		return previous.LogLevel, nil
+	case !found || configured == nil:
+		return planDefault, nil
+	}
+
+	level, ok := configured.(string)
+	if !ok || !isRedisLogLevel(level) {
+		return "", userError("invalid value for parameter '%s': %v, must be one of %s", RedisLogLevelKey, configured, strings.Join(redisLogLevels, ", "))
+	}
+	return level, nil
+}
+
+// unixSocketForRedisServer returns empty values, leaving redis listening on TCP
+// only, until an instance asks for a socket. Both settings carry forward from
+// the previous manifest.
+func unixSocketForRedisServer(arbitraryParams map[string]interface{}, previous RedisProperties) (string, string, error) {
+	socket := previous.UnixSocket
+	if configured, found := arbitraryParams[UnixSocketKey]; found {
+		path, ok := configured.(string)
+		if !ok || strings.TrimSpace(path) == "" {
+			return "", "", userError("invalid value for parameter '%s': %v, must be a non-empty path", UnixSocketKey, configured)
+		}
+		socket = path
+	}
+
+	perm := previous.UnixSocketPerm
+	if configured, found := arbitraryParams[UnixSocketPermKey]; found {
+		octal, ok := octalPermission(configured)
+		if !ok {
+			return "", "", userError("invalid value for parameter '%s': %v, must be an octal permission such as 700", UnixSocketPermKey, configured)
+		}
+		perm = octal
+	}
+
+	if perm != "" && socket == "" {
+		return "", "", userError("parameter '%s' requires '%s' to be set", UnixSocketPermKey, UnixSocketKey)
+	}
+	return socket, perm, nil
+}
+
+// maintenanceModeForRedisServer stays on across updates that do not mention it
+// until the parameter turns it off. It cannot be requested when provisioning,
+// as there is nothing to maintain yet.
+func maintenanceModeForRedisServer(arbitraryParams map[string]interface{}, previous RedisProperties, operation Operation) (bool, error) {
+	configured, found := arbitraryParams[MaintenanceModeKey]
+	if !found {
+		return previous.MaintenanceMode, nil
+	}
+
+	if operation == OperationCreate {
+		return false, userError("parameter '%s' is only allowed when updating an instance", MaintenanceModeKey)
+	}
+	enabled, ok := configured.(bool)
+	if !ok {
+		return false, userError("invalid value for parameter '%s': %v, must be a boolean", MaintenanceModeKey, configured)
+	}
+	return enabled, nil
+}
+
+// octalPermission accepts the digits of a file mode either as a string or as
+// the number a JSON request decodes them to, so 700 and "0700" are the same.
+func octalPermission(value interface{}) (string, bool) {
+	var digits string
+	if str, ok := value.(string); ok {
+		digits = strings.TrimSpace(str)
+	} else {
+		number, ok := toInt(value)
+		if !ok || number < 0 {
+			return "", false
+		}
+		digits = strconv.Itoa(number)
+	}
+
+	perm, err := strconv.ParseUint(digits, 8, 32)
+	if err != nil || perm > 0777 {
+		return "", false
+	}
+	return strconv.FormatUint(perm, 8), true
+}
+
+func isRedisLogLevel(level string) bool {
+	for _, known := range redisLogLevels {
+		if level == known {
+			return true
+		}
+	}
+	return false
+}
+
+func isLazyFreeParam(param string) bool {
+	for _, lazyFreeParam := range lazyFreeParams {
+		if param == lazyFreeParam {
+			return true
+		}
+	}
+	return false
+}
+
+func lazyFreeForRedisServer(arbitraryParams map[string]interface{}, previous RedisProperties) (map[string]string, error) {
+	lazyFree := map[string]string{}
+	var invalidParams []string
+	for _, param := range lazyFreeParams {
+		configured, found := arbitraryParams[param]
+		if !found {
+			if previousValue, ok := previous.LazyFree[param]; ok {
+				lazyFree[param] = previousValue
+			}
+			continue
+		}
+
+		enabled, ok := configured.(bool)
+		if !ok {
+			invalidParams = append(invalidParams, param)
+			continue
+		}
+		lazyFree[param] = "no"
+		if enabled {
+			lazyFree[param] = "yes"
+		}
+	}
+
+	if len(invalidParams) > 0 {
+		return nil, userError("invalid value for parameter(s) %s: must be a boolean", strings.Join(invalidParams, ", "))
+	}
+	return lazyFree, nil
+}
+
+// evictionTenacityForRedisServer returns nil when the parameter has never been
+// set, leaving redis on its own default of 10.
+func evictionTenacityForRedisServer(arbitraryParams map[string]interface{}, previous RedisProperties) (*int, error) {
+	configuredTenacity, found := arbitraryParams[EvictionTenacityKey]
+	if !found {
+		return previous.EvictionTenacity, nil
+	}
+
+	tenacity, ok := toInt(configuredTenacity)
+	if !ok || tenacity < 0 || tenacity > MaxEvictionTenacity {
+		return nil, userError("invalid value for parameter '%s': %v, must be an integer between 0 and %d", EvictionTenacityKey, configuredTenacity, MaxEvictionTenacity)
+	}
+	return &tenacity, nil
+}
+
+func hzForRedisServer(arbitraryParams map[string]interface{}, previous RedisProperties) (int, error) {
+	configuredHz, found := arbitraryParams[HzKey]
+	if !found {
+		return previous.Hz, nil
+	}
+
+	hz, ok := toInt(configuredHz)
+	if !ok || hz < MinHz || hz > MaxHz {
+		return 0, userError("invalid value for parameter '%s': %v, must be an integer between %d and %d", HzKey, configuredHz, MinHz, MaxHz)
+	}
+	return hz, nil
+}
+
+func yesNoParamForRedisServer(param string, arbitraryParams map[string]interface{}, previous string) (string, error) {
+	configured, found := arbitraryParams[param]
+	if !found {
+		return previous, nil
+	}
+
+	enabled, ok := configured.(bool)
+	if !ok {
+		return "", userError("invalid value for parameter '%s': %v, must be a boolean", param, configured)
+	}
+	if enabled {
+		return "yes", nil
+	}
+	return "no", nil
+}
+
+func encodingLimitsForRedisServer(arbitraryParams map[string]interface{}, previous RedisProperties) (map[interface{}]interface{}, error) {
+	configuredLimits, found := arbitraryParams[EncodingLimitsKey]
+	if !found {
+		return previous.EncodingLimits, nil
+	}
+
+	limits, ok := configuredLimits.(map[string]interface{})
+	if !ok {
+		return nil, userError("invalid value for parameter '%s': must be a map of encoding limits to integers", EncodingLimitsKey)
+	}
+
+	encodingLimits := map[interface{}]interface{}{}
+	var unknownKeys []string
+	for key, value := range limits {
+		if !isKnownEncodingLimit(key) {
+			unknownKeys = append(unknownKeys, key)
+			continue
+		}
+		limit, ok := toInt(value)
+		if !ok {
+			return nil, userError("invalid value for encoding limit '%s': %v, must be an integer", key, value)
+		}
+		encodingLimits[key] = limit
+	}
+
+	if len(unknownKeys) > 0 {
+		sort.Strings(unknownKeys)
+		return nil, userError("unsupported encoding limit(s): %s", strings.Join(unknownKeys, ", "))
+	}
+	return encodingLimits, nil
+}
+
+func isKnownEncodingLimit(key string) bool {
+	for _, knownKey := range knownEncodingLimits {
+		if key == knownKey {
+			return true
+		}
+	}
+	return false
+}
+
+func drainTimeoutForRedisServer(planProperties serviceadapter.Properties) (int, error) {
+	configuredTimeout, found := planProperties[DrainTimeoutPropertyKey]
+	if !found {
+		return 0, nil
+	}
+
+	drainTimeout, ok := toInt(configuredTimeout)
+	if !ok || drainTimeout < 0 || drainTimeout > MaxDrainTimeoutSeconds {
+		return 0, operatorError(
+			"invalid value for plan property '%s': %v, must be an integer number of seconds between 0 and %d",
+			DrainTimeoutPropertyKey,
+			configuredTimeout,
+			MaxDrainTimeoutSeconds,
+		)
+	}
+	return drainTimeout, nil
+}
+
+// agentDrainTimeoutForRedisServer bounds how long the BOSH agent waits for the
+// drain scripts, which is separate from the redis job's own drain_timeout.
+func agentDrainTimeoutForRedisServer(planProperties serviceadapter.Properties) (int, error) {
+	configuredTimeout, found := planProperties[AgentDrainTimeoutPropertyKey]
+	if !found {
+		return DefaultAgentDrainTimeoutSeconds, nil
+	}
+
+	drainTimeout, ok := toInt(configuredTimeout)
+	if !ok || drainTimeout <= 0 || drainTimeout > MaxDrainTimeoutSeconds {
+		return 0, operatorError(
+			"invalid value for plan property '%s': %v, must be an integer number of seconds between 1 and %d",
+			AgentDrainTimeoutPropertyKey,
+			configuredTimeout,
+			MaxDrainTimeoutSeconds,
+		)
+	}
+	return drainTimeout, nil
+}
+
+func (m *ManifestGenerator) persistenceForRedisServer(planProperties serviceadapter.Properties) (string, error) {
+	persistenceEnabled, err := m.persistenceEnabled(planProperties)
+	if err != nil {
+		return "", err
+	}
+	persistence := "no"
+	if persistenceEnabled {
+		persistence = "yes"
+	}
+	return persistence, nil
+}
+
+func (m *ManifestGenerator) persistenceEnabled(planProperties serviceadapter.Properties) (bool, error) {
+	persistenceKey := m.Config.persistencePropertyKey()
+	persistenceConfig, found := planProperties[persistenceKey]
+	if !found {
+		return false, operatorError("the plan property '%s' is missing", persistenceKey)
+	}
+
+	switch value := persistenceConfig.(type) {
+	case bool:
+		return value, nil
+	case string:
+		switch strings.ToLower(value) {
+		case "true", "yes":
+			return true, nil
+		case "false", "no":
+			return false, nil
+		}
+	}
+
+	return false, operatorError(
+		"invalid value for plan property '%s': %v (%T), must be a boolean or one of \"true\", \"false\", \"yes\", \"no\"",
+		persistenceKey,
+		persistenceConfig,
+		persistenceConfig,
+	)
+}
+
+var preStartShebangRegexp = regexp.MustCompile(`^#![ \t]*(/usr)?/bin/(env[ \t]+)?(sh|bash|dash|ash|ksh)([ \t][^\n]*)?(\n|$)`)
+
+func preStartScriptForRedisServer(planProperties serviceadapter.Properties) (string, error) {
+	configuredScript, found := planProperties[PreStartScriptPropertyKey]
+	if !found {
+		return "", nil
+	}
+
+	script, ok := configuredScript.(string)
+	if !ok || !preStartShebangRegexp.MatchString(script) {
+		return "", operatorError(
+			"invalid value for plan property '%s': must be a POSIX shell script starting with a shebang such as #!/bin/sh",
+			PreStartScriptPropertyKey,
+		)
+	}
+	return script, nil
+}
+
+var hostnameRegexp = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+// dashboardRoute is recorded in the manifest so DashboardUrl serves the same
+// hostname that was registered when the manifest was generated.
+func dashboardRoute(deploymentName string, planProperties serviceadapter.Properties) (string, error) {
+	configuredDomain, found := planProperties[DashboardDomainPropertyKey]
+	if !found {
+		return "", nil
+	}
+
+	domain, ok := configuredDomain.(string)
+	if !ok || !hostnameRegexp.MatchString(domain) {
+		return "", operatorError("invalid value for plan property '%s': %v, must be a domain name", DashboardDomainPropertyKey, configuredDomain)
+	}
+	return fmt.Sprintf("redis-%s.%s", strings.TrimPrefix(deploymentName, DeploymentNamePrefix), domain), nil
+}
+
+// tlsVariables has BOSH generate a CA, a server certificate signed by it and a
+// client key pair redis presents on its own TLS connections, such as
+// replication. A BOSH certificate variable carries its private key, so redis
+// reads each key from the same variable as the certificate it belongs to.
+func tlsVariables() []bosh.Variable {
+	return []bosh.Variable{
+		{
+			Name:    TLSCAVariableName,
+			Type:    "certificate",
+			Options: map[string]interface{}{"is_ca": true, "common_name": "redis-tls-ca"},
+		},
+		{
+			Name:    TLSCertificateVariableName,
+			Type:    "certificate",
+			Options: map[string]interface{}{"ca": TLSCAVariableName, "common_name": "redis"},
+			Consumes: &bosh.VariableConsumes{
+				AlternativeName: bosh.VariableConsumesLink{
+					From:       "redis-server-link",
+					Properties: map[string]interface{}{"wildcard": true},
+				},
+				CommonName: bosh.VariableConsumesLink{
+					From: "redis-server-link",
+				},
+			},
+		},
+		{
+			Name: TLSKeyVariableName,
+			Type: "certificate",
+			Options: map[string]interface{}{
+				"ca":                 TLSCAVariableName,
+				"common_name":        "redis-client",
+				"extended_key_usage": []string{"client_auth"},
+			},
+		},
+	}
+}
+
+func ntpServersForRedisServer(planProperties serviceadapter.Properties) ([]string, error) {
+	configuredServers, found := planProperties[NTPServersPropertyKey]
+	if !found {
+		return nil, nil
+	}
+
+	servers, ok := configuredServers.([]interface{})
+	if !ok {
+		return nil, operatorError("invalid value for plan property '%s': must be a list of hostnames or IP addresses", NTPServersPropertyKey)
+	}
+
+	var ntpServers []string
+	for _, configuredServer := range servers {
+		server, ok := configuredServer.(string)
+		if !ok || (net.ParseIP(server) == nil && !hostnameRegexp.MatchString(server)) {
+			return nil, operatorError("invalid value for plan property '%s': %v is not a valid hostname or IP address", NTPServersPropertyKey, configuredServer)
+		}
+		ntpServers = append(ntpServers, server)
+	}
+	return ntpServers, nil
+}
+
+// systemdOverridesForRedisServer reads the unit directives the redis job
+// templates into a systemd drop-in, such as OOMScoreAdjust.
+func systemdOverridesForRedisServer(planProperties serviceadapter.Properties) (map[string]string, error) {
+	configured, found := planProperties[SystemdOverridesPropertyKey]
+	if !found {
+		return nil, nil
+	}
+
+	directives, ok := interfaceKeyedMap(configured)
+	if !ok {
+		return nil, operatorError("invalid value for plan property '%s': must be a map of systemd directives to values", SystemdOverridesPropertyKey)
+	}
+
+	overrides := map[string]string{}
+	for configuredDirective, configuredValue := range directives {
+		directive, ok := configuredDirective.(string)
+		if !ok || directive == "" {
+			return nil, operatorError("invalid value for plan property '%s': directive %v must be a non-empty string", SystemdOverridesPropertyKey, configuredDirective)
+		}
+		value, ok := configuredValue.(string)
+		if !ok {
+			return nil, operatorError("invalid value for plan property '%s': %v for directive %s, must be a string", SystemdOverridesPropertyKey, configuredValue, directive)
+		}
+		overrides[directive] = value
+	}
+	return overrides, nil
+}
+
+// confSnippetForRedisServer returns the plan's extra redis.conf lines for the
+// redis-server job to append to its config file, for settings such as
+// latency-monitor-threshold that have no job property.
+func confSnippetForRedisServer(planProperties serviceadapter.Properties) (string, error) {
+	configured, found := planProperties[RedisConfSnippetPropertyKey]
+	if !found {
+		return "", nil
+	}
+	snippet, ok := configured.(string)
+	if !ok {
+		return "", operatorError("invalid value for plan property '%s': %v, must be a string", RedisConfSnippetPropertyKey, configured)
+	}
+
+	var problems []string
+	for i, line := range strings.Split(snippet, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if directive := strings.ToLower(fields[0]); protectedConfDirectives[directive] {
+			problems = append(problems, fmt.Sprintf("line %d: %s", i+1, directive))
+		}
+	}
+	if len(problems) > 0 {
+		return "", operatorError(
+			"invalid value for plan property '%s': it overrides settings the adapter manages (%s)",
+			RedisConfSnippetPropertyKey,
+			strings.Join(problems, ", "),
+		)
+	}
+	return snippet, nil
+}
+
+// jobEnvVarsForRedisServer reads the environment the redis job passes to the
+// redis process. Names beginning REDIS_ are set by the job itself.
+func jobEnvVarsForRedisServer(planProperties serviceadapter.Properties) (map[string]string, error) {
+	configured, found := planProperties[JobEnvVarsPropertyKey]
+	if !found {
+		return nil, nil
+	}
+
+	vars, ok := interfaceKeyedMap(configured)
+	if !ok {
+		return nil, operatorError("invalid value for plan property '%s': must be a map of environment variable names to values", JobEnvVarsPropertyKey)
+	}
+
+	env := map[string]string{}
+	for configuredName, configuredValue := range vars {
+		name, ok := configuredName.(string)
+		if !ok || name == "" {
+			return nil, operatorError("invalid value for plan property '%s': environment variable name %v must be a non-empty string", JobEnvVarsPropertyKey, configuredName)
+		}
+		if strings.HasPrefix(name, ReservedEnvVarPrefix) {
+			return nil, operatorError("invalid value for plan property '%s': environment variable %s is reserved, names beginning %s are set by the redis job", JobEnvVarsPropertyKey, name, ReservedEnvVarPrefix)
+		}
+		value, ok := configuredValue.(string)
+		if !ok {
+			return nil, operatorError("invalid value for plan property '%s': %v for environment variable %s, must be a string", JobEnvVarsPropertyKey, configuredValue, name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, operatorError("invalid value for plan property '%s': the value of environment variable %s must not contain newlines", JobEnvVarsPropertyKey, name)
+		}
+		env[name] = value
+	}
+	return env, nil
+}
+
+// releaseStemcellOverrides returns the stemcells the plan pins releases to,
+// in release order, and the alias each pinned release's jobs should use.
+func releaseStemcellOverrides(releases serviceadapter.ServiceReleases, planProperties serviceadapter.Properties) ([]bosh.Stemcell, map[string]string, error) {
+	configured, found := planProperties[ReleaseStemcellOverridesKey]
+	if !found {
+		return nil, nil, nil
+	}
+
+	overrides, ok := interfaceKeyedMap(configured)
+	if !ok {
+		return nil, nil, operatorError("invalid value for plan property '%s': must be a map of release names to a stemcell os and version", ReleaseStemcellOverridesKey)
+	}
+
+	for releaseName := range overrides {
+		if name, ok := releaseName.(string); !ok || !releaseExists(releases, name) {
+			return nil, nil, operatorError("invalid value for plan property '%s': release %v is not part of the service deployment", ReleaseStemcellOverridesKey, releaseName)
+		}
+	}
+
+	var stemcells []bosh.Stemcell
+	aliases := map[string]string{}
+	for _, release := range releases {
+		configuredStemcell, found := overrides[release.Name]
+		if !found {
+			continue
+		}
+		stemcell, _ := interfaceKeyedMap(configuredStemcell)
+		os, _ := stemcell["os"].(string)
+		version, _ := stemcell["version"].(string)
+		if os == "" || version == "" {
+			return nil, nil, operatorError("invalid value for plan property '%s': the stemcell for release %s must have an os and a version", ReleaseStemcellOverridesKey, release.Name)
+		}
+
+		alias := "stemcell-" + release.Name
+		stemcells = append(stemcells, bosh.Stemcell{Alias: alias, OS: os, Version: version})
+		aliases[release.Name] = alias
 	}
+	return stemcells, aliases, nil
 }
 
-func gatherJob(releases serviceadapter.ServiceReleases, jobName string) (bosh.Job, error) {
-	release, err := findReleaseForJob(jobName, releases)
-	if err != nil {
-		return bosh.Job{}, err
+// planTags are the operator's own deployment tags, such as a cost centre,
+// which BOSH passes on to the IaaS as VM tags. The tags the adapter sets
+// itself cannot be overridden.
+func planTags(planProperties serviceadapter.Properties) (map[string]string, error) {
+	configured, found := planProperties[TagsPropertyKey]
+	if !found {
+		return nil, nil
 	}
-	return bosh.Job{Name: jobName, Release: release.Name}, nil
-}
 
-func (m *ManifestGenerator) gatherRedisServerJob(releases serviceadapter.ServiceReleases) (bosh.Job, error) {
-	redisServerJob, err := gatherJob(releases, RedisJobName)
-	if err != nil {
-		return bosh.Job{}, errors.New(fmt.Sprintf("error gathering redis server job: %s", err))
+	configuredTags, ok := interfaceKeyedMap(configured)
+	if !ok {
+		return nil, operatorError("invalid value for plan property '%s': must be a map of tag names to values", TagsPropertyKey)
 	}
-	redisServerJob = redisServerJob.AddCustomProviderDefinition("redis-server-link", "address", nil)
-	return redisServerJob.AddSharedProvidesLink("redis"), nil
-}
-
-func gatherHealthCheckJob(releases serviceadapter.ServiceReleases) (bosh.Job, error) {
-	return gatherJob(releases, HealthCheckErrandName)
-}
 
-func gatherTrainingInsertJob(releases serviceadapter.ServiceReleases) (bosh.Job, error) {
-        return gatherJob(releases, TrainingInsertErrandName)
+	tags := map[string]string{}
+	for configuredKey, configuredValue := range configuredTags {
+		key, ok := configuredKey.(string)
+		if !ok || key == "" {
+			return nil, operatorError("invalid value for plan property '%s': tag name %v must be a non-empty string", TagsPropertyKey, configuredKey)
+		}
+		switch key {
+		case ProductTagKey, AdapterVersionTagKey, RedisReleaseVersionTagKey, DashboardRouteTagKey:
+			return nil, operatorError("invalid value for plan property '%s': tag %s is set by the adapter", TagsPropertyKey, key)
+		}
+		value, ok := configuredValue.(string)
+		if !ok {
+			return nil, operatorError("invalid value for plan property '%s': %v for tag %s, must be a string", TagsPropertyKey, configuredValue, key)
+		}
+		tags[key] = value
+	}
+	return tags, nil
 }
 
-func gatherCleanupDataJob(releases serviceadapter.ServiceReleases) (bosh.Job, error) {
-	return gatherJob(releases, CleanupDataErrandName)
-}
+// autoScalingProperties validates the auto_scaling hints that an auto-scaling
+// BOSH extension reads from the top-level manifest properties.
+func autoScalingProperties(planProperties serviceadapter.Properties) (map[string]interface{}, error) {
+	configured, found := planProperties[AutoScalingPropertyKey]
+	if !found {
+		return nil, nil
+	}
 
-func findReleaseForJob(requiredJob string, releases serviceadapter.ServiceReleases) (serviceadapter.ServiceRelease, error) {
-	releasesThatProvideRequiredJob := serviceadapter.ServiceReleases{}
+	hints, ok := configured.(map[string]interface{})
+	if !ok {
+		return nil, operatorError("invalid value for plan property '%s': %v, must be a map with min_instances, max_instances and metric", AutoScalingPropertyKey, configured)
+	}
 
-	for _, release := range releases {
-		for _, providedJob := range release.Jobs {
-			if providedJob == requiredJob {
-				releasesThatProvideRequiredJob = append(releasesThatProvideRequiredJob, release)
-			}
-		}
+	minInstances, ok := toInt(hints["min_instances"])
+	if !ok {
+		return nil, operatorError("invalid value for plan property '%s': min_instances %v, must be an integer", AutoScalingPropertyKey, hints["min_instances"])
+	}
+	maxInstances, ok := toInt(hints["max_instances"])
+	if !ok {
+		return nil, operatorError("invalid value for plan property '%s': max_instances %v, must be an integer", AutoScalingPropertyKey, hints["max_instances"])
+	}
+	metric, ok := hints["metric"].(string)
+	if !ok || metric == "" {
+		return nil, operatorError("invalid value for plan property '%s': metric must be a non-empty string", AutoScalingPropertyKey)
 	}
 
-	if len(releasesThatProvideRequiredJob) == 0 {
-		return serviceadapter.ServiceRelease{}, fmt.Errorf("no release provided for job %s", requiredJob)
+	if minInstances < 1 {
+		return nil, operatorError("invalid value for plan property '%s': min_instances is %d, must be at least 1", AutoScalingPropertyKey, minInstances)
+	}
+	if minInstances > maxInstances {
+		return nil, operatorError(
+			"invalid value for plan property '%s': min_instances (%d) must not be greater than max_instances (%d)",
+			AutoScalingPropertyKey,
+			minInstances,
+			maxInstances,
+		)
 	}
 
-	if len(releasesThatProvideRequiredJob) > 1 {
-		releaseNames := []string{}
-		for _, release := range releasesThatProvideRequiredJob {
-			releaseNames = append(releaseNames, release.Name)
-		}
+	return map[string]interface{}{
+		"min_instances": minInstances,
+		"max_instances": maxInstances,
+		"metric":        metric,
+	}, nil
+}
 
-		return serviceadapter.ServiceRelease{}, fmt.Errorf("job %s defined in multiple releases: %s", requiredJob, strings.Join(releaseNames, ", "))
+func (m ManifestGenerator) resolvableNTPServers(ntpServers []string) error {
+	resolver := m.Resolver
+	if resolver == nil {
+		resolver = NetResolver{}
 	}
 
-	return releasesThatProvideRequiredJob[0], nil
+	for _, server := range ntpServers {
+		if net.ParseIP(server) != nil {
+			continue
+		}
+		if _, err := resolver.LookupHost(server); err != nil {
+			return operatorError("invalid value for plan property '%s': could not resolve %s: %s", NTPServersPropertyKey, server, err)
+		}
+	}
+	return nil
 }
 
-func redisPlanProperties(manifest bosh.BoshManifest) map[interface{}]interface{} {
-	return manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})
+// discardUnmanagedPropertiesForRedisServer reports whether the plan sets
+// discard_unmanaged_properties, which regenerates the redis block from the
+// plan and request alone. Properties an operator hot-patched into the
+// deployment, such as a tls-port, bind_hostname or tcp-keepalive, are then
+// dropped on the next update. It is independent of strict_properties, which
+// only rejects unknown plan properties.
+func discardUnmanagedPropertiesForRedisServer(planProperties serviceadapter.Properties) (bool, error) {
+	configuredDiscard, found := planProperties[DiscardUnmanagedPropertiesKey]
+	if !found {
+		return false, nil
+	}
+
+	discard, ok := configuredDiscard.(bool)
+	if !ok {
+		return false, operatorError("invalid value for plan property '%s': %v, must be a boolean", DiscardUnmanagedPropertiesKey, configuredDiscard)
+	}
+	return discard, nil
 }
 
-func (m ManifestGenerator) redisServerProperties(
-	deploymentName string,
-	planProperties serviceadapter.Properties,
-	arbitraryParams map[string]interface{},
-	previousManifest *bosh.BoshManifest,
-	newSecrets serviceadapter.ODBManagedSecrets,
-	previousSecrets serviceadapter.ManifestSecrets) (map[string]interface{}, error) {
-	var previousRedisProperties map[interface{}]interface{}
-	if previousManifest != nil {
-		previousRedisProperties = redisPlanProperties(*previousManifest)
+func ipv6EnabledForRedisServer(planProperties serviceadapter.Properties) (bool, error) {
+	configuredIPv6, found := planProperties[IPv6EnabledPropertyKey]
+	if !found {
+		return false, nil
 	}
 
-	persistence, err := m.persistenceForRedisServer(planProperties)
-	if err != nil {
-		return nil, err
+	ipv6Enabled, ok := configuredIPv6.(bool)
+	if !ok {
+		return false, operatorError("invalid value for plan property '%s': %v, must be a boolean", IPv6EnabledPropertyKey, configuredIPv6)
+	}
+	if !ipv6Enabled {
+		return false, nil
 	}
 
-	password, err := passwordForRedisServer(previousRedisProperties)
-	if err != nil {
-		return nil, err
+	if tlsEnabled, _ := planProperties[TLSEnabledPropertyKey].(bool); !tlsEnabled {
+		return false, operatorError(
+			"plan property '%s' requires '%s' to be true, redis must not be exposed on IPv6 without TLS",
+			IPv6EnabledPropertyKey,
+			TLSEnabledPropertyKey,
+		)
 	}
+	return true, nil
+}
 
-	managedSecretKey := managedSecretKeyForRedisServer(previousRedisProperties, m.Config.IgnoreODBManagedSecretOnUpdate)
+// protectedModeForRedisServer returns "" unless the plan sets protected_mode,
+// leaving redis on its default of yes. Turning it off on a plan that also
+// declares auth_required: false would let any client on the network in, so
+// that combination has to be acknowledged with i_know_what_i_am_doing.
+func protectedModeForRedisServer(planProperties serviceadapter.Properties) (string, error) {
+	configuredProtectedMode, found := planProperties[ProtectedModePropertyKey]
+	if !found {
+		return "", nil
+	}
+	protectedMode, ok := configuredProtectedMode.(bool)
+	if !ok {
+		return "", operatorError("invalid value for plan property '%s': %v, must be a boolean", ProtectedModePropertyKey, configuredProtectedMode)
+	}
+	if protectedMode {
+		return "yes", nil
+	}
 
-	maxClients := maxClientsForRedisServer(arbitraryParams, previousRedisProperties)
+	authRequired := true
+	if configuredAuthRequired, found := planProperties[AuthRequiredPropertyKey]; found {
+		if authRequired, ok = configuredAuthRequired.(bool); !ok {
+			return "", operatorError("invalid value for plan property '%s': %v, must be a boolean", AuthRequiredPropertyKey, configuredAuthRequired)
+		}
+	}
+	if acknowledged, _ := planProperties[IKnowWhatIAmDoingPropertyKey].(bool); !authRequired && !acknowledged {
+		return "", operatorError(
+			"plan properties '%s: false' and '%s: false' together let any client that can reach redis connect without a password; set '%s: true' only if the plan's network is fully isolated",
+			AuthRequiredPropertyKey,
+			ProtectedModePropertyKey,
+			IKnowWhatIAmDoingPropertyKey,
+		)
+	}
+	return "no", nil
+}
 
-	properties := map[interface{}]interface{}{
-		"persistence":      persistence,
-		"password":         password,
-		"maxclients":       maxClients,
-		GeneratedSecretKey: "((" + GeneratedSecretVariableName + "))",
-		ManagedSecretKey:   managedSecretKey,
-		"ca_cert":          "((" + CertificateVariableName + ".ca))",
-		"certificate":      "((" + CertificateVariableName + ".certificate))",
-		"private_key":      "((" + CertificateVariableName + ".private_key))",
+func (m *ManifestGenerator) validVMExtensions(vmExtensions []string) error {
+	if m.AllowedVMExtensions == nil {
+		return nil
 	}
 
-	if secretFromPlan, exists := planProperties["plan_secret"]; exists && m.Config.SecureManifestsEnabled {
-		secretKey := "plan_secret_key" + uuid.New()[:6]
-		newSecrets[secretKey] = secretFromPlan
-		planSecret := fmt.Sprintf("((%s:%s))", serviceadapter.ODBSecretPrefix, secretKey)
-		if previousSecrets != nil {
-			existingCredhubPath, ok := previousManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["plan_secret"]
-			if ok && previousSecrets[existingCredhubPath.(string)] == secretFromPlan {
-				planSecret = existingCredhubPath.(string)
-				delete(newSecrets, secretKey)
+	var disallowed []string
+	for _, extension := range vmExtensions {
+		allowed := false
+		for _, allowedExtension := range m.AllowedVMExtensions {
+			if extension == allowedExtension {
+				allowed = true
+				break
 			}
 		}
-		properties["plan_secret"] = planSecret
+		if !allowed {
+			disallowed = append(disallowed, extension)
+		}
 	}
 
-	if secretPath, ok := arbitraryParams["credhub_secret_path"]; ok {
-		properties["secret"] = "((" + secretPath.(string) + "))"
-	} else if secret, ok := previousRedisProperties["secret"]; ok {
-		properties["secret"] = secret
+	if len(disallowed) > 0 {
+		return operatorError("vm extension(s) not allowed for this service: %s", strings.Join(disallowed, ", "))
 	}
-
-	return map[string]interface{}{
-		"redis": properties,
-	}, nil
+	return nil
 }
 
-func managedSecretKeyForRedisServer(previousManifestProperties map[interface{}]interface{}, ignoreODBSecret bool) string {
-	if previousManifestProperties != nil {
-		managedSecretKey, managedSecretFound := previousManifestProperties[ManagedSecretKey].(string)
-		if managedSecretFound && !ignoreODBSecret {
-			return managedSecretKey
-		}
+// uniqueVMExtensions drops repeated extensions, which BOSH rejects, keeping
+// the first occurrence of each.
+func (m *ManifestGenerator) uniqueVMExtensions(instanceGroupName string, vmExtensions []string) []string {
+	if vmExtensions == nil {
+		return nil
 	}
 
-	return "((" + serviceadapter.ODBSecretPrefix + ":" + ManagedSecretKey + "))"
-}
-
-func passwordForRedisServer(previousManifestProperties map[interface{}]interface{}) (string, error) {
-	if previousManifestProperties != nil {
-		return previousManifestProperties["password"].(string), nil
+	seen := map[string]bool{}
+	unique := []string{}
+	var duplicates []string
+	for _, extension := range vmExtensions {
+		if seen[extension] {
+			duplicates = append(duplicates, extension)
+			continue
+		}
+		seen[extension] = true
+		unique = append(unique, extension)
 	}
 
-	return CurrentPasswordGenerator()
+	if len(duplicates) > 0 {
+		m.events.Warn(fmt.Sprintf("removed duplicate vm extension(s) from instance group %s: %s", instanceGroupName, strings.Join(duplicates, ", ")))
+	}
+	return unique
 }
 
-func maxClientsForRedisServer(arbitraryParams map[string]interface{}, previousManifestProperties map[interface{}]interface{}) int {
-	if configuredMax, ok := arbitraryParams["maxclients"]; ok {
-		return int(configuredMax.(float64))
-	} else if previousManifestProperties != nil {
-		return previousManifestProperties["maxclients"].(int)
+func (m *ManifestGenerator) validPersistentDiskType(redisServerInstanceGroup serviceadapter.InstanceGroup, planProperties serviceadapter.Properties) error {
+	persistence, err := m.persistenceEnabled(planProperties)
+	if err != nil {
+		return err
 	}
-	return 10000
-}
 
-func (m *ManifestGenerator) persistenceForRedisServer(planProperties serviceadapter.Properties) (string, error) {
-	persistenceConfig, found := planProperties[RedisServerPersistencePropertyKey]
-	if !found {
-		m.StderrLogger.Println(fmt.Sprintf("the plan property '%s' is missing", RedisServerPersistencePropertyKey))
-		return "", errors.New("")
+	if persistence && redisServerInstanceGroup.PersistentDiskType == "" {
+		return operatorError(
+			"a persistent disk type must be specified for the %s instance group when persistence is enabled",
+			redisServerInstanceGroup.Name,
+		)
 	}
-	persistence := "no"
-	if persistenceConfig.(bool) {
-		persistence = "yes"
+
+	if !persistence && redisServerInstanceGroup.PersistentDiskType != "" {
+		m.events.Warn(fmt.Sprintf(
+			"persistent disk type %s is set for the %s instance group but persistence is disabled",
+			redisServerInstanceGroup.PersistentDiskType,
+			redisServerInstanceGroup.Name,
+		))
 	}
-	return persistence, nil
+
+	return nil
 }
 
 func (m *ManifestGenerator) healthCheckProperties(
@@ -614,14 +3034,17 @@ func errandProperties(
 	return nil
 }
 
-func oldGreaterThanNew(oldMajorVersion, oldMinorVersion, oldPatchVersion, newMajorVersion, newMinorVersion, newPatchVersion int) bool {
-	if oldMajorVersion != newMajorVersion {
-		return oldMajorVersion > newMajorVersion
+func oldGreaterThanNew(oldVersion, newVersion boshReleaseVersion) bool {
+	if oldVersion.major != newVersion.major {
+		return oldVersion.major > newVersion.major
+	}
+	if oldVersion.minor != newVersion.minor {
+		return oldVersion.minor > newVersion.minor
 	}
-	if oldMinorVersion != newMinorVersion {
-		return oldMinorVersion > newMinorVersion
+	if oldVersion.patch != newVersion.patch {
+		return oldVersion.patch > newVersion.patch
 	}
-	return oldPatchVersion > newPatchVersion
+	return oldVersion.dev > newVersion.dev
 }
 
 func findOldManifestRedisRelease(redisReleaseName string, previousManifestReleases []bosh.Release) (bosh.Release, error) {
@@ -634,8 +3057,90 @@ func findOldManifestRedisRelease(redisReleaseName string, previousManifestReleas
 	return bosh.Release{}, fmt.Errorf("no release with name %s found in previous manifest", redisReleaseName)
 }
 
-func (m *ManifestGenerator) validUpgradePath(previousManifest bosh.BoshManifest, serviceReleases serviceadapter.ServiceReleases) error {
-	newRedisRelease, err := findReleaseForJob(RedisJobName, serviceReleases)
+func upgradeCheckMode(planProperties serviceadapter.Properties) (string, error) {
+	mode, found := planProperties[UpgradeCheckModePropertyKey]
+	if !found {
+		return UpgradeCheckModeEnforce, nil
+	}
+	if mode != UpgradeCheckModeEnforce && mode != UpgradeCheckModeWarn {
+		return "", operatorError(
+			"invalid value for plan property '%s': %v, must be one of %s, %s",
+			UpgradeCheckModePropertyKey,
+			mode,
+			UpgradeCheckModeEnforce,
+			UpgradeCheckModeWarn,
+		)
+	}
+	return mode.(string), nil
+}
+
+func (m *ManifestGenerator) validUpgradePath(previousManifest bosh.BoshManifest, serviceReleases serviceadapter.ServiceReleases, jobName, pinnedRedisReleaseName, mode string) error {
+	warnOnly := mode == UpgradeCheckModeWarn
+
+	newRedisRelease, err := findReleaseForJob(jobName, serviceReleases, pinnedRedisReleaseName)
+	if err != nil {
+		if !warnOnly {
+			return err
+		}
+		m.events.Warn(fmt.Sprintf("upgrade check warning: %s", err))
+	} else if _, err := findOldManifestRedisRelease(newRedisRelease.Name, previousManifest.Releases); err != nil {
+		if !warnOnly {
+			return err
+		}
+		m.events.Warn(fmt.Sprintf("upgrade check warning: %s", err))
+	}
+
+	var downgrades []string
+	for _, newRelease := range serviceReleases {
+		oldRelease, err := findOldManifestRedisRelease(newRelease.Name, previousManifest.Releases)
+		if err != nil {
+			continue
+		}
+
+		downgrade, err := isDowngrade(oldRelease.Version, newRelease.Version)
+		if err != nil {
+			if !warnOnly {
+				return err
+			}
+			m.events.Warn(fmt.Sprintf("upgrade check warning: release=%s existing_version=%s new_version=%s error=%q", newRelease.Name, oldRelease.Version, newRelease.Version, err))
+			continue
+		}
+		if !downgrade {
+			continue
+		}
+		if warnOnly {
+			m.events.Warn(fmt.Sprintf("upgrade check warning: release=%s existing_version=%s new_version=%s error=%q", newRelease.Name, oldRelease.Version, newRelease.Version, "new release version is lower than existing release version"))
+			continue
+		}
+		downgrades = append(downgrades, fmt.Sprintf(
+			"%s (existing %s, new %s)",
+			newRelease.Name,
+			oldRelease.Version,
+			newRelease.Version,
+		))
+	}
+
+	if len(downgrades) > 0 {
+		return operatorError(
+			"error generating manifest: new release versions are lower than existing release versions: %s",
+			strings.Join(downgrades, ", "),
+		)
+	}
+
+	return nil
+}
+
+func (m *ManifestGenerator) validMinimumPreviousReleaseVersion(
+	previousManifest bosh.BoshManifest,
+	serviceReleases serviceadapter.ServiceReleases,
+	planProperties serviceadapter.Properties,
+) error {
+	minimumVersion, found, err := minimumPreviousReleaseVersion(planProperties)
+	if err != nil || !found {
+		return err
+	}
+
+	newRedisRelease, err := findReleaseForJob(redisJobName(planProperties), serviceReleases, redisReleaseName(planProperties))
 	if err != nil {
 		return err
 	}
@@ -645,27 +3150,299 @@ func (m *ManifestGenerator) validUpgradePath(previousManifest bosh.BoshManifest,
 		return err
 	}
 
-	// Allow upgrade to/from latest
-	if newRedisRelease.Version == "latest" || oldRedisRelease.Version == "latest" {
+	if oldRedisRelease.Version == "latest" {
+		m.events.Warn(fmt.Sprintf(
+			"previous manifest uses release %s at version latest, skipping minimum previous release version %s check",
+			oldRedisRelease.Name,
+			minimumVersion,
+		))
 		return nil
 	}
 
-	newMajorVersion, newMinorVersion, newPatchVersion, err := parseReleaseVersion(newRedisRelease.Version)
+	belowMinimum, err := isDowngrade(minimumVersion, oldRedisRelease.Version)
 	if err != nil {
 		return err
 	}
+	if belowMinimum {
+		return operatorError(
+			"cannot upgrade from release %s version %s: the minimum supported previous version is %s, upgrade the instance via an intermediate release first",
+			oldRedisRelease.Name,
+			oldRedisRelease.Version,
+			minimumVersion,
+		)
+	}
 
-	oldMajorVersion, oldMinorVersion, oldPatchVersion, err := parseReleaseVersion(oldRedisRelease.Version)
+	return nil
+}
+
+// minimumPreviousReleaseVersion also takes a number, as YAML reads an unquoted
+// 12 or 12.5 as one.
+func minimumPreviousReleaseVersion(planProperties serviceadapter.Properties) (string, bool, error) {
+	value, found := planProperties[MinimumPreviousReleaseVersionKey]
+	if !found {
+		return "", false, nil
+	}
+
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			return v, true, nil
+		}
+	case int:
+		return strconv.Itoa(v), true, nil
+	case int64:
+		return strconv.FormatInt(v, 10), true, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true, nil
+	}
+	return "", false, operatorError("invalid value for plan property '%s': %v, must be a release version", MinimumPreviousReleaseVersionKey, value)
+}
+
+func isDowngrade(oldVersion, newVersion string) (bool, error) {
+	// Allow upgrade to/from latest
+	if newVersion == "latest" || oldVersion == "latest" {
+		return false, nil
+	}
+
+	parsedNewVersion, err := parseReleaseVersion(newVersion)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	if oldGreaterThanNew(oldMajorVersion, oldMinorVersion, oldPatchVersion, newMajorVersion, newMinorVersion, newPatchVersion) {
-		return fmt.Errorf(
-			"error generating manifest: new release version %s is lower than existing release version %s",
-			newRedisRelease.Version,
-			oldRedisRelease.Version,
-		)
+	parsedOldVersion, err := parseReleaseVersion(oldVersion)
+	if err != nil {
+		return false, err
+	}
+
+	return oldGreaterThanNew(parsedOldVersion, parsedNewVersion), nil
+}
+
+func findPreviousInstanceGroup(previousManifest bosh.BoshManifest, instanceGroup serviceadapter.InstanceGroup) *bosh.InstanceGroup {
+	names := []string{instanceGroup.Name}
+	for _, migration := range instanceGroup.MigratedFrom {
+		names = append(names, migration.Name)
+	}
+
+	for i, previousInstanceGroup := range previousManifest.InstanceGroups {
+		for _, name := range names {
+			if previousInstanceGroup.Name == name {
+				return &previousManifest.InstanceGroups[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *ManifestGenerator) validPersistentDiskChange(
+	previousManifest bosh.BoshManifest,
+	redisServerInstanceGroup serviceadapter.InstanceGroup,
+	planProperties serviceadapter.Properties,
+	arbitraryParams map[string]interface{},
+) error {
+	previousInstanceGroup := findPreviousInstanceGroup(previousManifest, redisServerInstanceGroup)
+	if previousInstanceGroup == nil || previousInstanceGroup.PersistentDiskType == "" {
+		return nil
+	}
+
+	oldDiskType := previousInstanceGroup.PersistentDiskType
+	newDiskType := redisServerInstanceGroup.PersistentDiskType
+	if oldDiskType == newDiskType {
+		return nil
+	}
+
+	dataLossAccepted := arbitraryParams[AcceptDataLossKey] == true
+
+	if newDiskType == "" {
+		if dataLossAccepted {
+			return nil
+		}
+		return &Error{
+			OperatorMessage: fmt.Sprintf(
+				"plan change removes persistent disk type %s and would lose data; set '%s: true' to proceed",
+				oldDiskType,
+				AcceptDataLossKey,
+			),
+			UserMessage: fmt.Sprintf("plan change removes the persistent disk and would lose data; set '%s: true' to proceed", AcceptDataLossKey),
+		}
+	}
+
+	// Without both sizes the change may be a shrink, so it is treated as one.
+	diskSizes, _ := planProperties[PersistentDiskSizesPropertyKey].(map[string]interface{})
+	oldSize, oldFound := toInt(diskSizes[oldDiskType])
+	newSize, newFound := toInt(diskSizes[newDiskType])
+	if (!oldFound || !newFound) && !dataLossAccepted {
+		return &Error{
+			OperatorMessage: fmt.Sprintf(
+				"plan change switches persistent disk from %s to %s, which may truncate data as their sizes are missing from plan property '%s'; set '%s: true' to proceed",
+				oldDiskType,
+				newDiskType,
+				PersistentDiskSizesPropertyKey,
+				AcceptDataLossKey,
+			),
+			UserMessage: fmt.Sprintf("plan change may shrink the persistent disk and truncate data; set '%s: true' to proceed", AcceptDataLossKey),
+		}
+	}
+
+	if newSize < oldSize && !dataLossAccepted {
+		return &Error{
+			OperatorMessage: fmt.Sprintf(
+				"plan change shrinks persistent disk from %s to %s and may truncate data; set '%s: true' to proceed",
+				oldDiskType,
+				newDiskType,
+				AcceptDataLossKey,
+			),
+			UserMessage: fmt.Sprintf("plan change shrinks the persistent disk and may truncate data; set '%s: true' to proceed", AcceptDataLossKey),
+		}
+	}
+
+	return nil
+}
+
+func toInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, false
+		}
+		return int(v), true
+	case string:
+		i, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return 0, false
+		}
+		return i, true
+	}
+	return 0, false
+}
+
+func planName(plan serviceadapter.Plan) string {
+	name, _ := plan.Properties[PlanNamePropertyKey].(string)
+	return name
+}
+
+// planIdentity is what identifies a plan across requests, as the SDK's Plan
+// has no ID of its own. A named plan stays the same plan when the rest of its
+// definition is edited; an unnamed one can only be told apart by its
+// definition, so that two different unnamed plans are never taken for one.
+func planIdentity(plan serviceadapter.Plan) string {
+	if name := planName(plan); name != "" {
+		return name
+	}
+	planJSON, err := json.Marshal(plan)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(planJSON)
+	return "unnamed:" + hex.EncodeToString(sum[:])[:12]
+}
+
+// migratableFromForPlan returns the plan names, or "*" for any plan, that
+// instances may move from. It returns nil when the plan sets no restriction.
+func migratableFromForPlan(planProperties serviceadapter.Properties) ([]string, error) {
+	value, found := planProperties[MigratableFromPropertyKey]
+	if !found {
+		return nil, nil
+	}
+
+	invalid := operatorError("invalid value for plan property '%s': %v, must be a list of plan names or \"*\"", MigratableFromPropertyKey, value)
+	switch allowed := value.(type) {
+	case string:
+		if allowed == "" {
+			return nil, invalid
+		}
+		return []string{allowed}, nil
+	case []string:
+		return append([]string{}, allowed...), nil
+	case []interface{}:
+		names := make([]string, 0, len(allowed))
+		for _, entry := range allowed {
+			name, ok := entry.(string)
+			if !ok || name == "" {
+				return nil, invalid
+			}
+			names = append(names, name)
+		}
+		return names, nil
+	}
+	return nil, invalid
+}
+
+func planMigratableFrom(allowed []string, previousPlanName string) bool {
+	if allowed == nil {
+		return true
+	}
+	for _, name := range allowed {
+		if name == "*" || name == previousPlanName {
+			return true
+		}
+	}
+	return false
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string{}, a...)
+	sortedB := append([]string{}, b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *ManifestGenerator) validPlanTransition(
+	previousPlan serviceadapter.Plan,
+	plan serviceadapter.Plan,
+	redisServerInstanceGroup serviceadapter.InstanceGroup,
+	arbitraryParams map[string]interface{},
+) error {
+	// A malformed migratable_from is reported with the other plan problems.
+	allowed, allowedErr := migratableFromForPlan(plan.Properties)
+	previousPlanName := planName(previousPlan)
+	if allowedErr == nil && planIdentity(previousPlan) != planIdentity(plan) && !planMigratableFrom(allowed, previousPlanName) {
+		if previousPlanName == "" {
+			return userError("plan transition from a plan without a %s is not supported", PlanNamePropertyKey)
+		}
+		return userError("plan transition from %s is not supported", previousPlanName)
+	}
+
+	previousInstanceGroup := m.findRedisServerInstanceGroup(previousPlan)
+	if previousInstanceGroup == nil || arbitraryParams[ForcePlanChangeKey] == true {
+		return nil
+	}
+
+	if !sameStrings(previousInstanceGroup.Networks, redisServerInstanceGroup.Networks) {
+		return &Error{
+			OperatorMessage: fmt.Sprintf(
+				"plan transition changes networks from [%s] to [%s]; set '%s: true' to proceed",
+				strings.Join(previousInstanceGroup.Networks, ", "),
+				strings.Join(redisServerInstanceGroup.Networks, ", "),
+				ForcePlanChangeKey,
+			),
+			UserMessage: fmt.Sprintf("plan transition changes networks; set '%s: true' to proceed", ForcePlanChangeKey),
+		}
+	}
+
+	if !sameStrings(previousInstanceGroup.AZs, redisServerInstanceGroup.AZs) {
+		return &Error{
+			OperatorMessage: fmt.Sprintf(
+				"plan transition changes availability zones from [%s] to [%s]; set '%s: true' to proceed",
+				strings.Join(previousInstanceGroup.AZs, ", "),
+				strings.Join(redisServerInstanceGroup.AZs, ", "),
+				ForcePlanChangeKey,
+			),
+			UserMessage: fmt.Sprintf("plan transition changes availability zones; set '%s: true' to proceed", ForcePlanChangeKey),
+		}
 	}
 
 	return nil
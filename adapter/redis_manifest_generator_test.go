@@ -1,10 +1,15 @@
 package adapter_test
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"os"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/pivotal-cf-experimental/redis-example-service-adapter/adapter"
 	"github.com/pivotal-cf/on-demand-services-sdk/bosh"
@@ -16,6 +21,7 @@ import (
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/types"
 	"gopkg.in/yaml.v2"
 )
 
@@ -23,7 +29,7 @@ var _ = Describe("Redis Service Adapter", func() {
 
 	const ProvidedRedisServerInstanceGroupName = "redis-server"
 
-	adapter.CurrentPasswordGenerator = func() (string, error) {
+	adapter.CurrentPasswordGenerator = func(int) (string, error) {
 		return "really random password", nil
 	}
 
@@ -121,18 +127,18 @@ var _ = Describe("Redis Service Adapter", func() {
 	})
 
 	Describe("Generating manifests", func() {
+		It("marks the redis properties with the current schema version", func() {
+			generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+			Expect(generateErr).NotTo(HaveOccurred())
+			Expect(generated.Manifest.InstanceGroups[0].Properties["redis"]).To(
+				HaveKeyWithValue(adapter.PropertiesSchemaVersionKey, adapter.CurrentPropertiesSchemaVersion),
+			)
+		})
+
 		It("sets the instance group's redis persistence property to be 'no' when using high memory plan", func() {
 			oldManifest := createDefaultOldManifest()
 
-			generated, generateErr := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				highMemoryPlan,
-				defaultRequestParameters,
-				&oldManifest,
-				nil,
-				nil,
-			)
+			generated, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, highMemoryPlan, defaultRequestParameters, &oldManifest)
 
 			Expect(generateErr).NotTo(HaveOccurred())
 			Expect(
@@ -147,15 +153,7 @@ var _ = Describe("Redis Service Adapter", func() {
 			DescribeTable("logging validation of context and platform when requestParams is",
 				func(params map[string]interface{}) {
 					oldManifest := createDefaultOldManifest()
-					_, generateErr := generateManifest(
-						manifestGenerator,
-						defaultServiceReleases,
-						highMemoryPlan,
-						params,
-						&oldManifest,
-						nil,
-						nil,
-					)
+					_, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, highMemoryPlan, params, &oldManifest)
 					Expect(generateErr).NotTo(HaveOccurred())
 					Expect(stderr).To(gbytes.Say(`Non Cloud Foundry platform \(or pre OSBAPI 2\.13\) detected`))
 				},
@@ -181,15 +179,7 @@ var _ = Describe("Redis Service Adapter", func() {
 				}
 
 				oldManifest := createDefaultOldManifest()
-				_, generateErr := generateManifest(
-					manifestGenerator,
-					defaultServiceReleases,
-					highMemoryPlan,
-					params,
-					&oldManifest,
-					nil,
-					nil,
-				)
+				_, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, highMemoryPlan, params, &oldManifest)
 				Expect(generateErr).NotTo(HaveOccurred())
 				Expect(stderr).NotTo(gbytes.Say(`Non Cloud Foundry platform \(or pre OSBAPI 2\.13\) detected`))
 			})
@@ -239,15 +229,7 @@ var _ = Describe("Redis Service Adapter", func() {
 			}
 
 			colocatedPostDeployPlan := plan
-			generated, generateErr := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				colocatedPostDeployPlan,
-				defaultRequestParameters,
-				&oldManifest,
-				nil,
-				nil,
-			)
+			generated, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, colocatedPostDeployPlan, defaultRequestParameters, &oldManifest)
 
 			Expect(generateErr).NotTo(HaveOccurred())
 			Expect(containsJobName(generated.Manifest.InstanceGroups[0].Jobs, "redis-server")).To(BeTrue())
@@ -286,15 +268,7 @@ var _ = Describe("Redis Service Adapter", func() {
 			}
 
 			colocatedPostDeployPlan := plan
-			generated, generateErr := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				colocatedPostDeployPlan,
-				defaultRequestParameters,
-				&oldManifest,
-				nil,
-				nil,
-			)
+			generated, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, colocatedPostDeployPlan, defaultRequestParameters, &oldManifest)
 
 			Expect(generateErr).NotTo(HaveOccurred())
 			Expect(containsJobName(generated.Manifest.InstanceGroups[0].Jobs, "redis-server")).To(BeTrue())
@@ -337,15 +311,7 @@ var _ = Describe("Redis Service Adapter", func() {
 
 			colocatedPreDeletePlan := plan
 			defaultServiceReleases[0].Jobs = append(defaultServiceReleases[0].Jobs, "another-errand")
-			generated, generateErr := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				colocatedPreDeletePlan,
-				defaultRequestParameters,
-				&oldManifest,
-				nil,
-				nil,
-			)
+			generated, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, colocatedPreDeletePlan, defaultRequestParameters, &oldManifest)
 
 			Expect(generateErr).NotTo(HaveOccurred())
 			Expect(containsJobName(generated.Manifest.InstanceGroups[0].Jobs, "redis-server")).To(BeTrue())
@@ -354,19 +320,305 @@ var _ = Describe("Redis Service Adapter", func() {
 			Expect(generated.Manifest.InstanceGroups[0].Jobs).To(HaveLen(3))
 		})
 
+		Context("when consul_service_name is set in the plan", func() {
+			BeforeEach(func() {
+				dedicatedPlan.Properties[adapter.ConsulServiceNamePropertyKey] = "redis-service"
+			})
+
+			It("colocates the consul agent and registers the service", func() {
+				defaultServiceReleases = append(defaultServiceReleases, serviceadapter.ServiceRelease{
+					Name:    "consul",
+					Version: "200",
+					Jobs:    []string{adapter.ConsulAgentJobName},
+				})
+
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.InstanceGroups[0].Jobs).To(ContainElement(bosh.Job{Name: adapter.ConsulAgentJobName, Release: "consul"}))
+				Expect(generated.Manifest.InstanceGroups[0].Properties["consul"]).To(Equal(map[interface{}]interface{}{
+					"services": map[interface{}]interface{}{
+						"redis-service": map[interface{}]interface{}{
+							"name": "redis-service",
+							"check": map[interface{}]interface{}{
+								"tcp":      "127.0.0.1:6379",
+								"interval": "10s",
+							},
+						},
+					},
+				}))
+			})
+
+			It("returns an error when no release provides the consul agent", func() {
+				_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+
+				Expect(generateErr).To(matchOperatorError("plan property 'consul_service_name' is set but no release provided for job consul-agent, releases provide: some-release-name (redis-server, health-check, cleanup-data)"))
+			})
+		})
+
+		Context("when healthcheck_enabled is set in the plan", func() {
+			BeforeEach(func() {
+				dedicatedPlan.Properties[adapter.HealthCheckEnabledPropertyKey] = true
+				defaultServiceReleases = append(defaultServiceReleases, serviceadapter.ServiceRelease{
+					Name:    "redis-check-release",
+					Version: "3",
+					Jobs:    []string{adapter.RedisCheckJobName},
+				})
+			})
+
+			It("colocates the redis-check job linked to the redis server", func() {
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.InstanceGroups[0].Jobs).To(ContainElement(bosh.Job{
+					Name:       adapter.RedisCheckJobName,
+					Release:    "redis-check-release",
+					Consumes:   map[string]interface{}{"redis": bosh.ConsumesLink{From: "redis"}},
+					Properties: map[string]interface{}{"check_interval_seconds": adapter.DefaultHealthCheckIntervalSeconds},
+				}))
+			})
+
+			It("uses the configured check interval", func() {
+				dedicatedPlan.Properties[adapter.HealthCheckIntervalPropertyKey] = 10
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+
+				Expect(generateErr).NotTo(HaveOccurred())
+				redisCheckJob := findJob(generated.Manifest.InstanceGroups[0].Jobs, adapter.RedisCheckJobName)
+				Expect(redisCheckJob.Properties).To(HaveKeyWithValue("check_interval_seconds", 10))
+			})
+
+			It("consumes the link under its exported name", func() {
+				dedicatedPlan.Properties[adapter.ExportedAsPropertyKey] = "shared-redis"
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+
+				Expect(generateErr).NotTo(HaveOccurred())
+				redisCheckJob := findJob(generated.Manifest.InstanceGroups[0].Jobs, adapter.RedisCheckJobName)
+				Expect(redisCheckJob.Consumes).To(Equal(map[string]interface{}{"redis": bosh.ConsumesLink{From: "shared-redis"}}))
+			})
+
+			It("does not add the job when health checking is disabled", func() {
+				dedicatedPlan.Properties[adapter.HealthCheckEnabledPropertyKey] = false
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(containsJobName(generated.Manifest.InstanceGroups[0].Jobs, adapter.RedisCheckJobName)).To(BeFalse())
+			})
+
+			DescribeTable("returns an error for an invalid configuration",
+				func(property string, value interface{}, expectedErr string) {
+					dedicatedPlan.Properties[property] = value
+					_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+					Expect(generateErr).To(matchOperatorError(expectedErr))
+				},
+				Entry("a non-boolean flag", adapter.HealthCheckEnabledPropertyKey, "yes",
+					"invalid value for plan property 'healthcheck_enabled': yes, must be a boolean"),
+				Entry("a zero interval", adapter.HealthCheckIntervalPropertyKey, 0,
+					"invalid value for plan property 'healthcheck_interval': 0, must be a positive integer number of seconds"),
+			)
+
+			It("returns an error when no release provides the redis-check job", func() {
+				defaultServiceReleases = defaultServiceReleases[:len(defaultServiceReleases)-1]
+				_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).To(matchOperatorError("plan property 'healthcheck_enabled' is set but no release provided for job redis-check, releases provide: some-release-name (redis-server, health-check, cleanup-data)"))
+			})
+		})
+
+		Context("when colocated_smoke_tests is set in the plan", func() {
+			BeforeEach(func() {
+				dedicatedPlan.Properties[adapter.ColocatedSmokeTestsPropertyKey] = true
+				defaultServiceReleases = append(defaultServiceReleases, serviceadapter.ServiceRelease{
+					Name:    "redis-smoke-tests",
+					Version: "2",
+					Jobs:    []string{adapter.SmokeTestsJobName},
+				})
+			})
+
+			It("adds the smoke-tests job to the redis-server instance group after the redis-server job", func() {
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+
+				Expect(generateErr).NotTo(HaveOccurred())
+				jobs := generated.Manifest.InstanceGroups[0].Jobs
+				Expect(jobs[0].Name).To(Equal(adapter.RedisJobName))
+				Expect(jobs).To(ContainElement(bosh.Job{
+					Name:     adapter.SmokeTestsJobName,
+					Release:  "redis-smoke-tests",
+					Consumes: map[string]interface{}{"redis": bosh.ConsumesLink{From: "redis"}},
+				}))
+			})
+
+			It("does not add the job when the flag is false", func() {
+				dedicatedPlan.Properties[adapter.ColocatedSmokeTestsPropertyKey] = false
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(containsJobName(generated.Manifest.InstanceGroups[0].Jobs, adapter.SmokeTestsJobName)).To(BeFalse())
+			})
+
+			It("returns an error when the flag is not a boolean", func() {
+				dedicatedPlan.Properties[adapter.ColocatedSmokeTestsPropertyKey] = "yes"
+				_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).To(matchOperatorError("invalid value for plan property 'colocated_smoke_tests': yes, must be a boolean"))
+			})
+
+			It("returns an error when no release provides the smoke-tests job", func() {
+				defaultServiceReleases = defaultServiceReleases[:len(defaultServiceReleases)-1]
+				_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).To(matchOperatorError("plan property 'colocated_smoke_tests' is set but no release provided for job smoke-tests, releases provide: some-release-name (redis-server, health-check, cleanup-data)"))
+			})
+		})
+
+		It("does not add the smoke-tests job to plans without colocated_smoke_tests", func() {
+			defaultServiceReleases[0].Jobs = append(defaultServiceReleases[0].Jobs, adapter.SmokeTestsJobName)
+			generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+
+			Expect(generateErr).NotTo(HaveOccurred())
+			Expect(containsJobName(generated.Manifest.InstanceGroups[0].Jobs, adapter.SmokeTestsJobName)).To(BeFalse())
+		})
+
+		Context("when allowed VM extensions are configured", func() {
+			It("generates the manifest when every extension is allowed", func() {
+				manifestGenerator.AllowedVMExtensions = []string{"dedicated-extensions", "other-extensions"}
+
+				_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+			})
+
+			It("returns an error naming the disallowed extensions", func() {
+				manifestGenerator.AllowedVMExtensions = []string{"other-extensions"}
+				dedicatedPlan.InstanceGroups[0].VMExtensions = []string{"dedicated-extensions", "other-extensions", "public-ip"}
+
+				_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).To(matchOperatorError("vm extension(s) not allowed for this service: dedicated-extensions, public-ip"))
+			})
+		})
+
+		It("removes duplicate VM extensions and warns about them", func() {
+			dedicatedPlan.InstanceGroups[0].VMExtensions = []string{"dedicated-extensions", "public-ip", "dedicated-extensions", "public-ip"}
+
+			generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+
+			Expect(generateErr).NotTo(HaveOccurred())
+			Expect(generated.Manifest.InstanceGroups[0].VMExtensions).To(Equal([]string{"dedicated-extensions", "public-ip"}))
+			Expect(stderr).To(gbytes.Say("removed duplicate vm extension\\(s\\) from instance group redis-server: dedicated-extensions, public-ip"))
+		})
+
+		Describe("co-located jobs", func() {
+			generateJobs := func() ([]bosh.Job, error) {
+				generated, err := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				if err != nil {
+					return nil, err
+				}
+				return generated.Manifest.InstanceGroups[0].Jobs, nil
+			}
+
+			It("adds the co-located jobs after the redis-server job", func() {
+				defaultServiceReleases = append(defaultServiceReleases, serviceadapter.ServiceRelease{
+					Name:    "syslog",
+					Version: "11",
+					Jobs:    []string{"syslog-forwarder"},
+				})
+				dedicatedPlan.Properties[adapter.CoLocateJobsPropertyKey] = []interface{}{
+					map[string]interface{}{"name": "syslog-forwarder", "release": "syslog"},
+				}
+
+				jobs, err := generateJobs()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(jobs).To(HaveLen(2))
+				Expect(jobs[0].Name).To(Equal(adapter.RedisJobName))
+				Expect(jobs[1]).To(Equal(bosh.Job{Name: "syslog-forwarder", Release: "syslog"}))
+			})
+
+			Context("when co-located jobs consume the redis link", func() {
+				BeforeEach(func() {
+					defaultServiceReleases = append(defaultServiceReleases, serviceadapter.ServiceRelease{
+						Name:    "redis-addons",
+						Version: "3",
+						Jobs:    []string{"redis-exporter", "redis-sentinel"},
+					})
+					dedicatedPlan.Properties[adapter.CoLocateJobsPropertyKey] = []interface{}{
+						map[string]interface{}{"name": "redis-exporter", "release": "redis-addons", adapter.ConsumesRedisLinkKey: true},
+						map[string]interface{}{"name": "redis-sentinel", "release": "redis-addons", adapter.ConsumesRedisLinkKey: true},
+					}
+				})
+
+				It("wires the exporter and sentinel to the link the redis-server job provides", func() {
+					jobs, err := generateJobs()
+					Expect(err).NotTo(HaveOccurred())
+
+					jobsYAML, err := yaml.Marshal(jobs)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(jobsYAML).To(MatchYAML(`
+- name: redis-server
+  release: some-release-name
+  provides:
+    redis: {shared: true}
+  custom_provider_definitions:
+  - {name: redis-server-link, type: address}
+- name: redis-exporter
+  release: redis-addons
+  consumes:
+    redis: {from: redis}
+- name: redis-sentinel
+  release: redis-addons
+  consumes:
+    redis: {from: redis}
+`))
+				})
+
+				It("consumes the link under its exported alias", func() {
+					dedicatedPlan.Properties[adapter.ExportedAsPropertyKey] = "cache"
+
+					jobs, err := generateJobs()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(jobs[0].Provides["redis"]).To(Equal(bosh.ProvidesLink{As: "cache", Shared: true}))
+					Expect(jobs[1].Consumes["redis"]).To(Equal(bosh.ConsumesLink{From: "cache"}))
+					Expect(jobs[2].Consumes["redis"]).To(Equal(bosh.ConsumesLink{From: "cache"}))
+				})
+
+				It("leaves out the link for jobs that do not opt in", func() {
+					dedicatedPlan.Properties[adapter.CoLocateJobsPropertyKey] = []interface{}{
+						map[string]interface{}{"name": "redis-exporter", "release": "redis-addons"},
+					}
+
+					jobs, err := generateJobs()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(jobs[1].Consumes).To(BeNil())
+				})
+
+				It("returns an error when the opt-in is not a boolean", func() {
+					dedicatedPlan.Properties[adapter.CoLocateJobsPropertyKey] = []interface{}{
+						map[string]interface{}{"name": "redis-exporter", "release": "redis-addons", adapter.ConsumesRedisLinkKey: "yes"},
+					}
+
+					_, err := generateJobs()
+					Expect(err).To(matchOperatorError("invalid value for 'consumes_redis' of co-located job redis-exporter: yes, must be a boolean"))
+				})
+			})
+
+			It("returns an error when a co-located job duplicates the primary job", func() {
+				dedicatedPlan.Properties[adapter.CoLocateJobsPropertyKey] = []interface{}{
+					map[string]interface{}{"name": adapter.RedisJobName, "release": "some-release-name"},
+				}
+
+				_, err := generateJobs()
+				Expect(err).To(matchOperatorError("co-located job redis-server duplicates the primary job"))
+			})
+
+			It("returns an error naming a release missing from the service deployment", func() {
+				dedicatedPlan.Properties[adapter.CoLocateJobsPropertyKey] = []interface{}{
+					map[string]interface{}{"name": "syslog-forwarder", "release": "syslog"},
+				}
+
+				_, err := generateJobs()
+				Expect(err).To(matchOperatorError("release syslog for co-located job syslog-forwarder is not part of the service deployment"))
+			})
+		})
+
 		It("includes use_short_dns_addresses in bosh features block when property set in plan", func() {
 			dedicatedPlan.Properties["use_short_dns_addresses"] = true
 			oldManifest := createDefaultOldManifest()
 
-			generated, generateErr := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				dedicatedPlan,
-				defaultRequestParameters,
-				&oldManifest,
-				nil,
-				nil,
-			)
+			generated, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
 
 			Expect(generateErr).NotTo(HaveOccurred())
 			Expect(generated.Manifest.Features.UseShortDNSAddresses).ToNot(BeNil())
@@ -377,15 +629,7 @@ var _ = Describe("Redis Service Adapter", func() {
 			dedicatedPlan.Properties["use_short_dns_addresses"] = false
 			oldManifest := createDefaultOldManifest()
 
-			generated, generateErr := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				dedicatedPlan,
-				defaultRequestParameters,
-				&oldManifest,
-				nil,
-				nil,
-			)
+			generated, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
 
 			Expect(generateErr).NotTo(HaveOccurred())
 			Expect(generated.Manifest.Features.UseShortDNSAddresses).ToNot(BeNil())
@@ -395,30 +639,14 @@ var _ = Describe("Redis Service Adapter", func() {
 		It("does not include use_short_dns_addresses in bosh features block when property is not set in plan", func() {
 			oldManifest := createDefaultOldManifest()
 
-			generated, generateErr := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				dedicatedPlan,
-				defaultRequestParameters,
-				&oldManifest,
-				nil,
-				nil,
-			)
+			generated, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
 
 			Expect(generateErr).NotTo(HaveOccurred())
 			Expect(generated.Manifest.Features.UseShortDNSAddresses).To(BeNil())
 		})
 
 		It("always provides a shared link with redis server job", func() {
-			generated, generateErr := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				dedicatedPlan,
-				defaultRequestParameters,
-				nil,
-				nil,
-				nil,
-			)
+			generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
 
 			Expect(generateErr).NotTo(HaveOccurred())
 			redisServerJob := generated.Manifest.InstanceGroups[0].Jobs[0]
@@ -426,19 +654,22 @@ var _ = Describe("Redis Service Adapter", func() {
 			Expect(redisServerJob.Provides["redis"].Shared).To(BeTrue())
 		})
 
+		It("exports the redis link under the name set in the exported_as plan property", func() {
+			dedicatedPlan.Properties[adapter.ExportedAsPropertyKey] = "shared-redis"
+
+			generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+			Expect(generateErr).NotTo(HaveOccurred())
+
+			manifestYAML, err := yaml.Marshal(generated.Manifest)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(manifestYAML)).To(ContainSubstring("provides:\n      redis:\n        as: shared-redis\n        shared: true\n"))
+		})
+
 		It("includes arbitrary feature in bosh features block when property set in plan", func() {
 			dedicatedPlan.Properties["something_completely_different"] = "and_now"
 			oldManifest := createDefaultOldManifest()
 
-			generated, generateErr := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				dedicatedPlan,
-				defaultRequestParameters,
-				&oldManifest,
-				nil,
-				nil,
-			)
+			generated, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
 
 			Expect(generateErr).NotTo(HaveOccurred())
 			Expect(generated.Manifest.Features.ExtraFeatures).To(Equal(map[string]interface{}{
@@ -481,15 +712,7 @@ var _ = Describe("Redis Service Adapter", func() {
 				plan.Properties["systest_errand_sleep"] = 5
 				oldManifest := createDefaultOldManifest()
 
-				generated, generateErr := generateManifest(
-					manifestGenerator,
-					defaultServiceReleases,
-					plan,
-					defaultRequestParameters,
-					&oldManifest,
-					nil,
-					nil,
-				)
+				generated, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, plan, defaultRequestParameters, &oldManifest)
 
 				Expect(generateErr).NotTo(HaveOccurred())
 				Expect(
@@ -503,15 +726,7 @@ var _ = Describe("Redis Service Adapter", func() {
 				plan.Properties["systest_errand_failure_override"] = adapter.HealthCheckErrandName
 				oldManifest := createDefaultOldManifest()
 
-				generated, generateErr := generateManifest(
-					manifestGenerator,
-					defaultServiceReleases,
-					plan,
-					defaultRequestParameters,
-					&oldManifest,
-					nil,
-					nil,
-				)
+				generated, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, plan, defaultRequestParameters, &oldManifest)
 
 				Expect(generateErr).NotTo(HaveOccurred())
 				Expect(
@@ -552,15 +767,7 @@ var _ = Describe("Redis Service Adapter", func() {
 
 			oldManifest := createDefaultOldManifest()
 
-			generated, generateErr := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				plan,
-				defaultRequestParameters,
-				&oldManifest,
-				nil,
-				nil,
-			)
+			generated, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, plan, defaultRequestParameters, &oldManifest)
 
 			Expect(generateErr).NotTo(HaveOccurred())
 			Expect(
@@ -579,81 +786,1894 @@ var _ = Describe("Redis Service Adapter", func() {
 
 			oldManifest := createDefaultOldManifest()
 
-			generated, _ := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				dedicatedPlan,
-				requestParams,
-				&oldManifest,
-				nil,
-				nil,
-			)
+			generated, _ := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, requestParams, &oldManifest)
 
 			Expect(generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["maxclients"]).To(Equal(22))
 		})
 
-		It("uses that value in secrets map when odb_managed_secret is set in arbitrary parameters", func() {
-			requestParams := map[string]interface{}{
-				"parameters": map[string]interface{}{
-					adapter.ManagedSecretKey: "foo",
-				},
-			}
+		Describe("binding TTL", func() {
+			It("writes the binding TTL into the redis properties when set in the plan", func() {
+				dedicatedPlan.Properties[adapter.BindingTTLSecondsPropertyKey] = 3600.0
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})[adapter.BindingTTLSecondsPropertyKey]).To(Equal(3600))
+			})
 
-			oldManifest := createDefaultOldManifest()
+			It("returns an error when the binding TTL is not a positive integer", func() {
+				dedicatedPlan.Properties[adapter.BindingTTLSecondsPropertyKey] = 0.0
+				_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).To(matchOperatorError("invalid value for plan property 'binding_ttl_seconds': 0, must be a positive integer number of seconds"))
+			})
+		})
 
-			generated, _ := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				dedicatedPlan,
-				requestParams,
-				&oldManifest,
-				nil,
-				nil,
-			)
+		Describe("operator defaults", func() {
+			var passwordLength int
 
-			Expect(generated.ODBManagedSecrets[adapter.ManagedSecretKey]).To(Equal("foo"))
-		})
+			BeforeEach(func() {
+				adapter.CurrentPasswordGenerator = func(length int) (string, error) {
+					passwordLength = length
+					return "really random password", nil
+				}
+				manifestGenerator.AdapterConfig = adapter.AdapterConfig{
+					MaxClients:     20000,
+					PasswordLength: 32,
+					Port:           6380,
+					Update: adapter.UpdateDefaultConfig{
+						Canaries:        adapter.IntPointer(2),
+						MaxInFlight:     3,
+						CanaryWatchTime: "1000-60000",
+						UpdateWatchTime: "2000-90000",
+					},
+				}
+			})
 
-		It("set credhub reference if credhub_secret_path is set in arbitrary parameters", func() {
-			requestParams := map[string]interface{}{
-				"parameters": map[string]interface{}{
-					"credhub_secret_path": "/foo",
-				},
-			}
+			AfterEach(func() {
+				adapter.CurrentPasswordGenerator = func(int) (string, error) {
+					return "really random password", nil
+				}
+			})
 
-			oldManifest := createDefaultOldManifest()
+			It("applies the configured defaults when the plan and parameters do not set them", func() {
+				planWithoutUpdateBlock := dedicatedPlan
+				planWithoutUpdateBlock.Update = nil
 
-			generated, err := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				dedicatedPlan,
-				requestParams,
-				&oldManifest,
-				nil,
-				nil,
-			)
-			Expect(err).NotTo(HaveOccurred())
-			Expect(generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["secret"]).To(Equal("((/foo))"))
-		})
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, planWithoutUpdateBlock)
+				Expect(generateErr).NotTo(HaveOccurred())
 
-		It("returns an error when invalid arbitrary parameters are set", func() {
-			invalidRequestParams := map[string]interface{}{
-				"parameters": map[string]interface{}{"maxclients": 22.0, "foo": "bar", "baz": "barry"},
-			}
+				redisProperties := generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})
+				Expect(redisProperties["maxclients"]).To(Equal(20000))
+				Expect(redisProperties["port"]).To(Equal(6380))
+				Expect(passwordLength).To(Equal(32))
+				Expect(*generated.Manifest.Update).To(Equal(bosh.Update{
+					Canaries:        2,
+					MaxInFlight:     3,
+					CanaryWatchTime: "1000-60000",
+					UpdateWatchTime: "2000-90000",
+					VmStrategy:      "delete-create",
+				}))
+			})
 
-			oldManifest := createDefaultEmptyManifest()
+			It("deploys without canaries when the configured default is 0", func() {
+				manifestGenerator.AdapterConfig.Update.Canaries = adapter.IntPointer(0)
+				planWithoutUpdateBlock := dedicatedPlan
+				planWithoutUpdateBlock.Update = nil
 
-			_, generateErr := generateManifest(
-				manifestGenerator,
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, planWithoutUpdateBlock)
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.Update.Canaries).To(Equal(0))
+			})
+
+			It("prefers the plan and arbitrary parameters over the configured defaults", func() {
+				generated, generateErr := generateManifest(
+					manifestGenerator,
+					defaultServiceReleases,
+					dedicatedPlan,
+					map[string]interface{}{"parameters": map[string]interface{}{"maxclients": 50.0}},
+					nil,
+					nil,
+					nil,
+				)
+				Expect(generateErr).NotTo(HaveOccurred())
+
+				redisProperties := generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})
+				Expect(redisProperties["maxclients"]).To(Equal(50))
+				Expect(generated.Manifest.Update.Canaries).To(Equal(1))
+				Expect(generated.Manifest.Update.CanaryWatchTime).To(Equal("100-200"))
+			})
+
+			It("does not write the port when the default port is configured", func() {
+				manifestGenerator.AdapterConfig = adapter.AdapterConfig{}
+
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.InstanceGroups[0].Properties["redis"]).NotTo(HaveKey("port"))
+				Expect(passwordLength).To(Equal(20))
+			})
+
+			It("lets a binder without the adapter config read the configured port back from the manifest", func() {
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+
+				secrets := serviceadapter.ManifestSecrets{}
+				for _, value := range generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{}) {
+					if ref, ok := value.(string); ok && strings.HasPrefix(ref, "((") {
+						secrets[ref] = "resolved"
+					}
+				}
+
+				binder := adapter.Binder{StderrLogger: stderrLogger}
+				binding, err := binder.CreateBinding("binding-id", bosh.BoshVMs{"redis-server": {"an-ip"}}, generated.Manifest, nil, secrets, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Credentials["port"]).To(Equal(6380))
+			})
+		})
+
+		DescribeTable("previewing the credential keys of an instance that has not been deployed",
+			func(configure func()) {
+				configure()
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+
+				secrets := serviceadapter.ManifestSecrets{}
+				for _, value := range generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{}) {
+					if ref, ok := value.(string); ok && strings.HasPrefix(ref, "((") {
+						secrets[ref] = "resolved"
+					}
+				}
+
+				// credentials_json is only left out for Cloud Foundry.
+				cfRequest := serviceadapter.RequestParameters{"context": map[string]interface{}{"platform": "cloudfoundry"}}
+				binder := adapter.Binder{StderrLogger: stderrLogger}
+				binding, err := binder.CreateBinding("binding-id", bosh.BoshVMs{"redis-server": {"an-ip"}}, generated.Manifest, cfRequest, secrets, nil)
+				Expect(err).NotTo(HaveOccurred())
+
+				var bindingKeys []string
+				for key := range binding.Credentials {
+					bindingKeys = append(bindingKeys, key)
+				}
+				sort.Strings(bindingKeys)
+				Expect(binder.BindingCredentialKeys(bosh.BoshManifest{}, dedicatedPlan)).To(Equal(bindingKeys))
+			},
+			Entry("for a default plan", func() {}),
+			Entry("for a TLS plan", func() {
+				dedicatedPlan.Properties[adapter.TLSEnabledPropertyKey] = true
+			}),
+			Entry("for a cluster plan", func() {
+				dedicatedPlan.Properties[adapter.ClusterEnabledPropertyKey] = true
+			}),
+			Entry("for a shareable plan with a binding TTL", func() {
+				dedicatedPlan.Properties[adapter.ShareablePropertyKey] = true
+				dedicatedPlan.Properties[adapter.BindingTTLSecondsPropertyKey] = 3600
+			}),
+		)
+
+		Describe("shareable plans", func() {
+			It("records that the plan is shareable for the binder", func() {
+				dedicatedPlan.Properties[adapter.ShareablePropertyKey] = true
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, nil, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties).To(HaveKeyWithValue(adapter.ShareablePropertyKey, true))
+			})
+
+			It("does not record anything for plans that are not shareable", func() {
+				dedicatedPlan.Properties[adapter.ShareablePropertyKey] = false
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, nil, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties).NotTo(HaveKey(adapter.ShareablePropertyKey))
+			})
+
+			It("returns an error when shareable is not a boolean", func() {
+				dedicatedPlan.Properties[adapter.ShareablePropertyKey] = "yes"
+				_, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, nil, nil)
+				Expect(err).To(matchOperatorError("invalid value for plan property 'shareable': yes, must be a boolean"))
+			})
+		})
+
+		Describe("drain timeout", func() {
+			It("defaults the drain timeout to 0 when the plan does not set it", func() {
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["drain_timeout"]).To(Equal(0))
+			})
+
+			It("uses the drain timeout from the plan properties", func() {
+				dedicatedPlan.Properties[adapter.DrainTimeoutPropertyKey] = 30.0
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["drain_timeout"]).To(Equal(30))
+			})
+
+			DescribeTable("returns an error when the drain timeout is invalid",
+				func(drainTimeout interface{}) {
+					dedicatedPlan.Properties[adapter.DrainTimeoutPropertyKey] = drainTimeout
+					_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+					Expect(generateErr).To(matchAdapterError(adapter.ContactOperatorMessage, ContainSubstring("deployment some-instance-id: invalid value for plan property 'drain_timeout'")))
+				},
+				Entry("negative", -1.0),
+				Entry("too large", 3601.0),
+				Entry("fractional", 1.5),
+				Entry("not a number", "ten"),
+			)
+		})
+
+		Describe("agent drain timeout", func() {
+			agentSettings := func(manifest bosh.BoshManifest) map[string]interface{} {
+				boshEnv := manifest.InstanceGroups[0].Env["bosh"].(map[string]interface{})
+				return boshEnv["agent"].(map[string]interface{})["settings"].(map[string]interface{})
+			}
+
+			It("gives the BOSH agent 300 seconds to drain by default", func() {
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(agentSettings(generated.Manifest)).To(HaveKeyWithValue("drain_timeout", 300))
+			})
+
+			It("uses the timeout from the plan properties", func() {
+				dedicatedPlan.Properties[adapter.AgentDrainTimeoutPropertyKey] = 900.0
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(agentSettings(generated.Manifest)).To(HaveKeyWithValue("drain_timeout", 900))
+			})
+
+			DescribeTable("returns an error naming the allowed range",
+				func(drainTimeout interface{}) {
+					dedicatedPlan.Properties[adapter.AgentDrainTimeoutPropertyKey] = drainTimeout
+					_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+					Expect(generateErr).To(matchOperatorError(fmt.Sprintf(
+						"invalid value for plan property 'drain_timeout_seconds': %v, must be an integer number of seconds between 1 and 3600",
+						drainTimeout,
+					)))
+				},
+				Entry("zero", 0),
+				Entry("too large", 3601),
+				Entry("not a number", "long"),
+			)
+		})
+
+		Describe("TLS certificates", func() {
+			type yamlVariable struct {
+				Name    string                 `yaml:"name"`
+				Type    string                 `yaml:"type"`
+				Options map[string]interface{} `yaml:"options"`
+			}
+
+			generateVariables := func() ([]yamlVariable, map[interface{}]interface{}) {
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+
+				manifestYAML, err := yaml.Marshal(generated.Manifest)
+				Expect(err).NotTo(HaveOccurred())
+				var manifest struct {
+					Variables      []yamlVariable `yaml:"variables"`
+					InstanceGroups []struct {
+						Properties struct {
+							Redis map[interface{}]interface{} `yaml:"redis"`
+						} `yaml:"properties"`
+					} `yaml:"instance_groups"`
+				}
+				Expect(yaml.Unmarshal(manifestYAML, &manifest)).To(Succeed())
+				return manifest.Variables, manifest.InstanceGroups[0].Properties.Redis
+			}
+
+			It("does not generate TLS certificates by default", func() {
+				variables, _ := generateVariables()
+				for _, variable := range variables {
+					Expect(variable.Name).NotTo(HavePrefix("redis_tls"))
+				}
+			})
+
+			It("does not listen on a TLS port by default", func() {
+				_, redisProperties := generateVariables()
+				Expect(redisProperties).NotTo(HaveKey(adapter.TLSPortKey))
+				Expect(redisProperties).NotTo(HaveKey(adapter.TLSClientCertificateKey))
+				Expect(redisProperties).NotTo(HaveKey(adapter.TLSClientPrivateKeyKey))
+			})
+
+			It("generates a CA and certificates signed by it when TLS is enabled", func() {
+				dedicatedPlan.Properties[adapter.TLSEnabledPropertyKey] = true
+				variables, redisProperties := generateVariables()
+
+				Expect(variables).To(ContainElement(yamlVariable{
+					Name:    "redis_tls_ca",
+					Type:    "certificate",
+					Options: map[string]interface{}{"is_ca": true, "common_name": "redis-tls-ca"},
+				}))
+				Expect(variables).To(ContainElement(yamlVariable{
+					Name:    "redis_tls_cert",
+					Type:    "certificate",
+					Options: map[string]interface{}{"ca": "redis_tls_ca", "common_name": "redis"},
+				}))
+				Expect(variables).To(ContainElement(yamlVariable{
+					Name: "redis_tls_key",
+					Type: "certificate",
+					Options: map[string]interface{}{
+						"ca":                 "redis_tls_ca",
+						"common_name":        "redis-client",
+						"extended_key_usage": []interface{}{"client_auth"},
+					},
+				}))
+
+				Expect(redisProperties).To(HaveKeyWithValue("ca_cert", "((redis_tls_cert.ca))"))
+				Expect(redisProperties).To(HaveKeyWithValue("certificate", "((redis_tls_cert.certificate))"))
+				Expect(redisProperties).To(HaveKeyWithValue("private_key", "((redis_tls_cert.private_key))"))
+				Expect(redisProperties).To(HaveKeyWithValue("client_certificate", "((redis_tls_key.certificate))"))
+				Expect(redisProperties).To(HaveKeyWithValue("client_private_key", "((redis_tls_key.private_key))"))
+				Expect(redisProperties).To(HaveKeyWithValue(adapter.TLSPortKey, adapter.RedisServerTLSPort))
+			})
+
+			It("serves the certificate and key of redis_tls_cert and presents redis_tls_key as the client key pair", func() {
+				dedicatedPlan.Properties[adapter.TLSEnabledPropertyKey] = true
+				_, redisProperties := generateVariables()
+
+				keyPairs := map[interface{}]string{}
+				for key, value := range redisProperties {
+					if ref, ok := value.(string); ok && strings.HasPrefix(ref, "((redis_tls_") {
+						keyPairs[key] = strings.SplitN(strings.TrimPrefix(ref, "(("), ".", 2)[0]
+					}
+				}
+				Expect(keyPairs).To(Equal(map[interface{}]string{
+					"ca_cert":            "redis_tls_cert",
+					"certificate":        "redis_tls_cert",
+					"private_key":        "redis_tls_cert",
+					"client_certificate": "redis_tls_key",
+					"client_private_key": "redis_tls_key",
+				}))
+			})
+
+			It("gives bindings the TLS port and CA certificate when TLS is enabled", func() {
+				dedicatedPlan.Properties[adapter.TLSEnabledPropertyKey] = true
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+
+				secrets := serviceadapter.ManifestSecrets{}
+				for _, value := range generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{}) {
+					if ref, ok := value.(string); ok && strings.HasPrefix(ref, "((") {
+						secrets[ref] = "resolved " + ref
+					}
+				}
+
+				binder := adapter.Binder{StderrLogger: stderrLogger}
+				binding, err := binder.CreateBinding("binding-id", bosh.BoshVMs{"redis-server": {"an-ip"}}, generated.Manifest, nil, secrets, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Credentials["tls_enabled"]).To(Equal(true))
+				Expect(binding.Credentials["tls_port"]).To(Equal(adapter.RedisServerTLSPort))
+				Expect(binding.Credentials["ca_certificate"]).To(Equal("resolved ((redis_tls_cert.ca))"))
+			})
+
+			It("stops listening on the TLS port when a plan update disables TLS", func() {
+				dedicatedPlan.Properties[adapter.TLSEnabledPropertyKey] = true
+				previous, err := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(err).NotTo(HaveOccurred())
+
+				dedicatedPlan.Properties[adapter.TLSEnabledPropertyKey] = false
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &previous.Manifest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties).NotTo(HaveKey(adapter.TLSPortKey))
+				Expect(redisProperties).NotTo(HaveKey(adapter.TLSClientCertificateKey))
+				Expect(redisProperties).To(HaveKeyWithValue("certificate", "((instance_certificate.certificate))"))
+			})
+		})
+
+		Describe("IPv6", func() {
+			It("does not enable IPv6 by default", func() {
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.InstanceGroups[0].Env["bosh"]).NotTo(HaveKey("ipv6"))
+				Expect(generated.Manifest.InstanceGroups[0].Properties["redis"]).NotTo(HaveKey("bind"))
+			})
+
+			It("enables IPv6 on the instance group and binds redis to all interfaces", func() {
+				dedicatedPlan.Properties[adapter.IPv6EnabledPropertyKey] = true
+				dedicatedPlan.Properties[adapter.TLSEnabledPropertyKey] = true
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.InstanceGroups[0].Env).To(Equal(map[string]interface{}{
+					"bosh": map[string]interface{}{
+						"ipv6": map[string]interface{}{"enable": true},
+						"agent": map[string]interface{}{
+							"settings": map[string]interface{}{"drain_timeout": adapter.DefaultAgentDrainTimeoutSeconds},
+						},
+					},
+				}))
+				Expect(generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["bind"]).To(Equal("::"))
+			})
+
+			It("returns an error when IPv6 is enabled without TLS", func() {
+				dedicatedPlan.Properties[adapter.IPv6EnabledPropertyKey] = true
+				_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).To(matchOperatorError("plan property 'ipv6_enabled' requires 'tls_enabled' to be true, redis must not be exposed on IPv6 without TLS"))
+			})
+		})
+
+		Describe("protected mode", func() {
+			const unsafeCombination = "plan properties 'auth_required: false' and 'protected_mode: false' together let any client that can reach redis connect without a password; set 'i_know_what_i_am_doing: true' only if the plan's network is fully isolated"
+
+			It("leaves protected-mode to the redis default unless the plan sets it", func() {
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, nil, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties).NotTo(HaveKey(adapter.ProtectedModeKey))
+			})
+
+			DescribeTable("writes protected-mode as yes or no",
+				func(protectedMode bool, expected string) {
+					dedicatedPlan.Properties[adapter.ProtectedModePropertyKey] = protectedMode
+					redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, nil, nil)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(redisProperties).To(HaveKeyWithValue(adapter.ProtectedModeKey, expected))
+				},
+				Entry("on", true, "yes"),
+				Entry("off", false, "no"),
+			)
+
+			It("rejects a protected_mode that is not a boolean", func() {
+				dedicatedPlan.Properties[adapter.ProtectedModePropertyKey] = "off"
+				_, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, nil, nil)
+				Expect(err).To(matchOperatorError("invalid value for plan property 'protected_mode': off, must be a boolean"))
+			})
+
+			Context("when the plan does not require auth", func() {
+				BeforeEach(func() {
+					dedicatedPlan.Properties[adapter.AuthRequiredPropertyKey] = false
+				})
+
+				It("allows protected mode to stay on", func() {
+					dedicatedPlan.Properties[adapter.ProtectedModePropertyKey] = true
+					Expect(generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, nil, nil)).To(HaveKeyWithValue(adapter.ProtectedModeKey, "yes"))
+				})
+
+				It("refuses to turn protected mode off", func() {
+					dedicatedPlan.Properties[adapter.ProtectedModePropertyKey] = false
+					_, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, nil, nil)
+					Expect(err).To(matchOperatorError(unsafeCombination))
+				})
+
+				It("turns protected mode off once the operator acknowledges the risk", func() {
+					dedicatedPlan.Properties[adapter.ProtectedModePropertyKey] = false
+					dedicatedPlan.Properties[adapter.IKnowWhatIAmDoingPropertyKey] = true
+					Expect(generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, nil, nil)).To(HaveKeyWithValue(adapter.ProtectedModeKey, "no"))
+				})
+			})
+		})
+
+		Describe("strict plan properties", func() {
+			generateWithPlanProperties := func() error {
+				_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				return generateErr
+			}
+
+			BeforeEach(func() {
+				dedicatedPlan.Properties["persistance"] = true
+				dedicatedPlan.Properties["drain_timeuot"] = 60.0
+			})
+
+			It("ignores unknown plan properties by default", func() {
+				Expect(generateWithPlanProperties()).To(Succeed())
+			})
+
+			It("ignores unknown plan properties when strict mode is disabled", func() {
+				dedicatedPlan.Properties[adapter.StrictPropertiesKey] = false
+				Expect(generateWithPlanProperties()).To(Succeed())
+			})
+
+			It("returns the misspelled plan properties when strict mode is enabled", func() {
+				dedicatedPlan.Properties[adapter.StrictPropertiesKey] = true
+				Expect(generateWithPlanProperties()).To(matchOperatorError("unknown plan property(s) with 'strict_properties' enabled: drain_timeuot, persistance"))
+			})
+
+			It("accepts known plan properties when strict mode is enabled", func() {
+				delete(dedicatedPlan.Properties, "persistance")
+				delete(dedicatedPlan.Properties, "drain_timeuot")
+				dedicatedPlan.Properties[adapter.StrictPropertiesKey] = true
+				dedicatedPlan.Properties[adapter.DrainTimeoutPropertyKey] = 60.0
+				Expect(generateWithPlanProperties()).To(Succeed())
+			})
+
+			It("does not let the system test properties through strict mode", func() {
+				delete(dedicatedPlan.Properties, "persistance")
+				delete(dedicatedPlan.Properties, "drain_timeuot")
+				dedicatedPlan.Properties[adapter.StrictPropertiesKey] = true
+				dedicatedPlan.Properties["systest_errand_sleep"] = 5
+				dedicatedPlan.Properties["something_completely_different"] = "and_now"
+				Expect(generateWithPlanProperties()).To(matchOperatorError("unknown plan property(s) with 'strict_properties' enabled: something_completely_different, systest_errand_sleep"))
+			})
+
+			It("returns an error when strict mode is not a boolean", func() {
+				dedicatedPlan.Properties[adapter.StrictPropertiesKey] = "yes"
+				Expect(generateWithPlanProperties()).To(matchOperatorError("invalid value for plan property 'strict_properties': yes, must be a boolean"))
+			})
+		})
+
+		Describe("version tags", func() {
+			var originalVersion string
+
+			BeforeEach(func() {
+				originalVersion = adapter.Version
+				adapter.Version = "1.2.3"
+			})
+
+			AfterEach(func() {
+				adapter.Version = originalVersion
+			})
+
+			It("records the adapter and redis release versions", func() {
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.Tags).To(HaveKeyWithValue(adapter.AdapterVersionTagKey, "1.2.3"))
+				Expect(generated.Manifest.Tags).To(HaveKeyWithValue(adapter.RedisReleaseVersionTagKey, "4"))
+			})
+
+			It("records the version of the pinned redis release", func() {
+				dedicatedPlan.Properties[adapter.RedisReleaseNamePropertyKey] = "pinned-redis"
+				releases := append(defaultServiceReleases, serviceadapter.ServiceRelease{Name: "pinned-redis", Version: "7.2.1", Jobs: []string{adapter.RedisJobName}})
+
+				generated, generateErr := generateCreateManifest(manifestGenerator, releases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.Tags).To(HaveKeyWithValue(adapter.RedisReleaseVersionTagKey, "7.2.1"))
+			})
+
+			Context("on an upgrade", func() {
+				var oldManifest bosh.BoshManifest
+
+				BeforeEach(func() {
+					oldManifest = createDefaultOldManifest()
+					oldManifest.Tags = map[string]interface{}{
+						"product":                         "redis",
+						"cost_center":                     "team-a",
+						adapter.AdapterVersionTagKey:      "1.0.0",
+						adapter.RedisReleaseVersionTagKey: "3",
+					}
+				})
+
+				It("refreshes the versions rather than keeping the previous ones, and keeps the other previous tags verbatim", func() {
+					generated, generateErr := generateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest, &dedicatedPlan, nil)
+					Expect(generateErr).NotTo(HaveOccurred())
+					Expect(generated.Manifest.Tags).To(Equal(map[string]interface{}{
+						"product":                         "redis",
+						"cost_center":                     "team-a",
+						adapter.AdapterVersionTagKey:      "1.2.3",
+						adapter.RedisReleaseVersionTagKey: "4",
+					}))
+					Expect(generated.Manifest.Tags[adapter.AdapterVersionTagKey]).NotTo(Equal(oldManifest.Tags[adapter.AdapterVersionTagKey]))
+				})
+
+				It("is not reported as a change by the manifest comparator", func() {
+					adapter.Version = "1.0.0"
+					first, generateErr := generateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest, &dedicatedPlan, nil)
+					Expect(generateErr).NotTo(HaveOccurred())
+
+					adapter.Version = "1.2.3"
+					second, generateErr := generateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &first.Manifest, &dedicatedPlan, nil)
+					Expect(generateErr).NotTo(HaveOccurred())
+
+					Expect(second.Manifest.Tags).NotTo(Equal(first.Manifest.Tags))
+					Expect(adapter.ManifestComparator{}.Equal(first.Manifest, second.Manifest)).To(BeTrue())
+				})
+			})
+		})
+
+		Describe("operator tags", func() {
+			generateTags := func() (map[string]interface{}, error) {
+				generated, err := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				return generated.Manifest.Tags, err
+			}
+
+			It("adds the plan's tags alongside the adapter's", func() {
+				dedicatedPlan.Properties[adapter.TagsPropertyKey] = map[string]interface{}{"cost_center": "team-a", "owner": "data"}
+
+				tags, err := generateTags()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(tags).To(HaveKeyWithValue("cost_center", "team-a"))
+				Expect(tags).To(HaveKeyWithValue("owner", "data"))
+				Expect(tags).To(HaveKeyWithValue(adapter.ProductTagKey, "redis"))
+			})
+
+			DescribeTable("rejecting invalid tags",
+				func(tags interface{}, expectedErr string) {
+					dedicatedPlan.Properties[adapter.TagsPropertyKey] = tags
+					_, err := generateTags()
+					Expect(err).To(matchOperatorError(expectedErr))
+				},
+				Entry("a list", []interface{}{"cost_center"},
+					"invalid value for plan property 'tags': must be a map of tag names to values"),
+				Entry("a value that is not a string", map[string]interface{}{"cost_center": 42.0},
+					"invalid value for plan property 'tags': 42 for tag cost_center, must be a string"),
+				Entry("a tag the adapter sets", map[string]interface{}{adapter.ProductTagKey: "cache"},
+					"invalid value for plan property 'tags': tag product is set by the adapter"),
+			)
+		})
+
+		Describe("dashboard route", func() {
+			It("does not record a route when the plan has no dashboard domain", func() {
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.Tags).NotTo(HaveKey(adapter.DashboardRouteTagKey))
+			})
+
+			It("records the route for the instance", func() {
+				dedicatedPlan.Properties[adapter.DashboardDomainPropertyKey] = "apps.example.com"
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.Tags).To(HaveKeyWithValue(adapter.DashboardRouteTagKey, "redis-some-instance-id.apps.example.com"))
+			})
+
+			It("registers the route under the new domain when the plan changes it", func() {
+				oldManifest := createDefaultOldManifest()
+				oldManifest.Tags = map[string]interface{}{adapter.DashboardRouteTagKey: "redis-some-instance-id.apps.example.com"}
+				dedicatedPlan.Properties[adapter.DashboardDomainPropertyKey] = "apps.example.org"
+
+				generated, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.Tags).To(HaveKeyWithValue(adapter.DashboardRouteTagKey, "redis-some-instance-id.apps.example.org"))
+			})
+
+			It("returns an error when the dashboard domain is not a domain name", func() {
+				dedicatedPlan.Properties[adapter.DashboardDomainPropertyKey] = "https://apps.example.com"
+				_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).To(matchOperatorError("invalid value for plan property 'dashboard_domain': https://apps.example.com, must be a domain name"))
+			})
+		})
+
+		Describe("pre-start script", func() {
+			const preStartScript = "#!/bin/sh -e\nmkdir -p /var/vcap/store/redis\n"
+
+			It("writes the script into the agent settings of the YAML manifest", func() {
+				dedicatedPlan.Properties[adapter.PreStartScriptPropertyKey] = preStartScript
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+
+				manifestYAML, err := yaml.Marshal(generated.Manifest)
+				Expect(err).NotTo(HaveOccurred())
+				var manifest struct {
+					InstanceGroups []struct {
+						Env struct {
+							Bosh struct {
+								Agent struct {
+									Settings struct {
+										PreStart string `yaml:"pre_start"`
+									} `yaml:"settings"`
+								} `yaml:"agent"`
+							} `yaml:"bosh"`
+						} `yaml:"env"`
+					} `yaml:"instance_groups"`
+				}
+				Expect(yaml.Unmarshal(manifestYAML, &manifest)).To(Succeed())
+				Expect(manifest.InstanceGroups[0].Env.Bosh.Agent.Settings.PreStart).To(Equal(preStartScript))
+			})
+
+			It("keeps the IPv6 setting alongside the script", func() {
+				dedicatedPlan.Properties[adapter.PreStartScriptPropertyKey] = "#!/usr/bin/env bash\necho starting\n"
+				dedicatedPlan.Properties[adapter.IPv6EnabledPropertyKey] = true
+				dedicatedPlan.Properties[adapter.TLSEnabledPropertyKey] = true
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.InstanceGroups[0].Env).To(Equal(map[string]interface{}{
+					"bosh": map[string]interface{}{
+						"ipv6": map[string]interface{}{"enable": true},
+						"agent": map[string]interface{}{
+							"settings": map[string]interface{}{
+								"drain_timeout": adapter.DefaultAgentDrainTimeoutSeconds,
+								"pre_start":     "#!/usr/bin/env bash\necho starting\n",
+							},
+						},
+					},
+				}))
+			})
+
+			DescribeTable("rejects scripts without a POSIX shell shebang",
+				func(script interface{}) {
+					dedicatedPlan.Properties[adapter.PreStartScriptPropertyKey] = script
+					_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+					Expect(generateErr).To(matchOperatorError("invalid value for plan property 'pre_start_script': must be a POSIX shell script starting with a shebang such as #!/bin/sh"))
+				},
+				Entry("no shebang", "mkdir -p /var/vcap/store/redis"),
+				Entry("a non-shell interpreter", "#!/usr/bin/python\nprint('hi')"),
+				Entry("an empty script", ""),
+				Entry("a non-string value", 42),
+			)
+		})
+
+		Describe("NTP servers", func() {
+			var resolver *fakeResolver
+
+			generateWithNTPServers := func(servers ...interface{}) (serviceadapter.GenerateManifestOutput, error) {
+				dedicatedPlan.Properties[adapter.NTPServersPropertyKey] = servers
+				return generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+			}
+
+			BeforeEach(func() {
+				resolver = &fakeResolver{known: map[string]bool{"ntp.example.com": true}}
+				manifestGenerator.Resolver = resolver
+			})
+
+			It("does not configure NTP by default", func() {
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.InstanceGroups[0].Env["bosh"]).NotTo(HaveKey("ntp"))
+			})
+
+			It("writes the NTP servers into the instance group env", func() {
+				generated, generateErr := generateWithNTPServers("ntp.example.com", "10.0.0.123")
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.InstanceGroups[0].Env["bosh"]).To(HaveKeyWithValue("ntp", []string{"ntp.example.com", "10.0.0.123"}))
+				Expect(resolver.lookups).To(Equal([]string{"ntp.example.com"}))
+			})
+
+			It("returns an error when a hostname does not resolve", func() {
+				_, generateErr := generateWithNTPServers("ntp.example.com", "missing.example.com")
+				Expect(generateErr).To(matchOperatorError("invalid value for plan property 'ntp_servers': could not resolve missing.example.com: no such host"))
+			})
+
+			It("skips DNS lookups with the skip lookup resolver", func() {
+				manifestGenerator.Resolver = adapter.SkipLookupResolver{}
+				generated, generateErr := generateWithNTPServers("missing.example.com")
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.InstanceGroups[0].Env["bosh"]).To(HaveKeyWithValue("ntp", []string{"missing.example.com"}))
+			})
+
+			DescribeTable("rejects entries that are not hostnames or IP addresses",
+				func(server interface{}, expectedDetail string) {
+					_, generateErr := generateWithNTPServers(server)
+					Expect(generateErr).To(matchOperatorError(expectedDetail))
+					Expect(resolver.lookups).To(BeEmpty())
+				},
+				Entry("a URL", "ntp://ntp.example.com", "invalid value for plan property 'ntp_servers': ntp://ntp.example.com is not a valid hostname or IP address"),
+				Entry("an empty string", "", "invalid value for plan property 'ntp_servers':  is not a valid hostname or IP address"),
+				Entry("a number", 123, "invalid value for plan property 'ntp_servers': 123 is not a valid hostname or IP address"),
+			)
+
+			It("returns an error when the NTP servers are not a list", func() {
+				dedicatedPlan.Properties[adapter.NTPServersPropertyKey] = "ntp.example.com"
+				_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).To(matchOperatorError("invalid value for plan property 'ntp_servers': must be a list of hostnames or IP addresses"))
+			})
+		})
+
+		Describe("static IPs", func() {
+			BeforeEach(func() {
+				dedicatedPlan.InstanceGroups[0].Instances = 2
+			})
+
+			It("does not set static IPs when the plan does not configure them", func() {
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.InstanceGroups[0].Networks).To(Equal([]bosh.Network{{Name: "dedicated-network"}}))
+			})
+
+			It("sets the static IPs on the network of each configured instance group", func() {
+				dedicatedPlan.Properties[adapter.StaticIPsPropertyKey] = map[string]interface{}{
+					"redis-server": []interface{}{"10.0.0.10", "10.0.0.11"},
+					"health-check": []interface{}{"10.0.0.20"},
+				}
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.InstanceGroups[0].Networks).To(Equal([]bosh.Network{
+					{Name: "dedicated-network", StaticIPs: []string{"10.0.0.10", "10.0.0.11"}},
+				}))
+				Expect(generated.Manifest.InstanceGroups[1].Networks).To(Equal([]bosh.Network{
+					{Name: "health-check-network", StaticIPs: []string{"10.0.0.20"}},
+				}))
+			})
+
+			DescribeTable("returns an error when the number of static IPs does not match the instance count",
+				func(staticIPs []interface{}) {
+					dedicatedPlan.Properties[adapter.StaticIPsPropertyKey] = map[string]interface{}{
+						"redis-server": staticIPs,
+					}
+					_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+					Expect(generateErr).To(matchOperatorError(fmt.Sprintf(
+						"invalid value for plan property 'static_ips': instance group 'redis-server' has 2 instances but %d static IPs, the counts must match",
+						len(staticIPs),
+					)))
+				},
+				Entry("fewer IPs than instances", []interface{}{"10.0.0.10"}),
+				Entry("more IPs than instances", []interface{}{"10.0.0.10", "10.0.0.11", "10.0.0.12"}),
+			)
+
+			It("returns an error when a static IP is not an IP address", func() {
+				dedicatedPlan.Properties[adapter.StaticIPsPropertyKey] = map[string]interface{}{
+					"redis-server": []interface{}{"10.0.0.10", "not-an-ip"},
+				}
+				_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).To(matchOperatorError("invalid value for plan property 'static_ips': not-an-ip for instance group 'redis-server' is not an IP address"))
+			})
+		})
+
+		Describe("default network", func() {
+			generateNetworks := func() ([]bosh.Network, error) {
+				generated, err := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				if err != nil {
+					return nil, err
+				}
+				return generated.Manifest.InstanceGroups[0].Networks, nil
+			}
+
+			BeforeEach(func() {
+				dedicatedPlan.InstanceGroups[0].Networks = []string{"dedicated-network", "replication-network"}
+			})
+
+			It("does not mark a default network unless the plan names one", func() {
+				Expect(generateNetworks()).To(Equal([]bosh.Network{{Name: "dedicated-network"}, {Name: "replication-network"}}))
+			})
+
+			It("marks the named network as the default for dns and the gateway", func() {
+				dedicatedPlan.Properties[adapter.DefaultNetworkPropertyKey] = "replication-network"
+				Expect(generateNetworks()).To(Equal([]bosh.Network{
+					{Name: "dedicated-network"},
+					{Name: "replication-network", Default: []string{"dns", "gateway"}},
+				}))
+			})
+
+			It("returns an error when the instance group has no network of that name", func() {
+				dedicatedPlan.Properties[adapter.DefaultNetworkPropertyKey] = "other-network"
+				_, err := generateNetworks()
+				Expect(err).To(matchOperatorError("invalid value for plan property 'default_network': instance group 'redis-server' has no network other-network, its networks are: dedicated-network, replication-network"))
+			})
+
+			It("returns an error when the property is not a string", func() {
+				dedicatedPlan.Properties[adapter.DefaultNetworkPropertyKey] = []interface{}{"dedicated-network"}
+				_, err := generateNetworks()
+				Expect(err).To(matchOperatorError("invalid value for plan property 'default_network': [dedicated-network], must be a network name"))
+			})
+		})
+
+		Describe("auto scaling hints", func() {
+			generateWithAutoScaling := func(hints interface{}) (serviceadapter.GenerateManifestOutput, error) {
+				dedicatedPlan.Properties[adapter.AutoScalingPropertyKey] = hints
+				return generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+			}
+
+			It("does not write auto scaling properties by default", func() {
+				generated, err := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(generated.Manifest.Properties).NotTo(HaveKey(adapter.AutoScalingPropertyKey))
+			})
+
+			It("writes the hints into the top-level manifest properties", func() {
+				generated, err := generateWithAutoScaling(map[string]interface{}{"min_instances": 1.0, "max_instances": 5.0, "metric": "memory"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(generated.Manifest.Properties).To(HaveKeyWithValue(adapter.AutoScalingPropertyKey, map[string]interface{}{
+					"min_instances": 1,
+					"max_instances": 5,
+					"metric":        "memory",
+				}))
+			})
+
+			DescribeTable("rejecting invalid hints",
+				func(hints interface{}, expectedErr string) {
+					_, err := generateWithAutoScaling(hints)
+					Expect(err).To(matchOperatorError(expectedErr))
+				},
+				Entry("not a map", "lots",
+					"invalid value for plan property 'auto_scaling': lots, must be a map with min_instances, max_instances and metric"),
+				Entry("min_instances below one", map[string]interface{}{"min_instances": 0.0, "max_instances": 5.0, "metric": "cpu"},
+					"invalid value for plan property 'auto_scaling': min_instances is 0, must be at least 1"),
+				Entry("min_instances above max_instances", map[string]interface{}{"min_instances": 6.0, "max_instances": 5.0, "metric": "cpu"},
+					"invalid value for plan property 'auto_scaling': min_instances (6) must not be greater than max_instances (5)"),
+				Entry("a missing max_instances", map[string]interface{}{"min_instances": 1.0, "metric": "cpu"},
+					"invalid value for plan property 'auto_scaling': max_instances <nil>, must be an integer"),
+				Entry("a fractional min_instances", map[string]interface{}{"min_instances": 1.5, "max_instances": 5.0, "metric": "cpu"},
+					"invalid value for plan property 'auto_scaling': min_instances 1.5, must be an integer"),
+				Entry("an empty metric", map[string]interface{}{"min_instances": 1.0, "max_instances": 5.0, "metric": ""},
+					"invalid value for plan property 'auto_scaling': metric must be a non-empty string"),
+			)
+		})
+
+		Describe("maximum instances", func() {
+			generate := func() error {
+				_, err := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				return err
+			}
+
+			It("does not limit instance counts by default", func() {
+				dedicatedPlan.InstanceGroups[0].Instances = 500
+				Expect(generate()).To(Succeed())
+			})
+
+			It("allows instance counts up to the limit", func() {
+				dedicatedPlan.Properties[adapter.MaxInstancesPropertyKey] = 45
+				Expect(generate()).To(Succeed())
+			})
+
+			It("rejects an instance group above the limit", func() {
+				dedicatedPlan.Properties[adapter.MaxInstancesPropertyKey] = 10
+				dedicatedPlan.InstanceGroups[0].Instances = 500
+				Expect(generate()).To(matchOperatorError("instance group redis-server requests 500 instances, more than the 10 allowed by plan property 'max_instances'"))
+			})
+
+			It("returns an error when the limit is not a positive integer", func() {
+				dedicatedPlan.Properties[adapter.MaxInstancesPropertyKey] = "ten"
+				Expect(generate()).To(matchOperatorError("invalid value for plan property 'max_instances': ten, must be a positive integer"))
+			})
+		})
+
+		Describe("cluster mode", func() {
+			It("leaves cluster mode off by default", func() {
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, nil, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties).NotTo(HaveKey(adapter.ClusterEnabledKey))
+			})
+
+			It("enables cluster mode when the plan asks for it", func() {
+				dedicatedPlan.Properties[adapter.ClusterEnabledPropertyKey] = true
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, nil, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties).To(HaveKeyWithValue(adapter.ClusterEnabledKey, "yes"))
+			})
+
+			It("returns an error when the flag is not a boolean", func() {
+				dedicatedPlan.Properties[adapter.ClusterEnabledPropertyKey] = "yes"
+				_, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, nil, nil)
+				Expect(err).To(matchOperatorError("invalid value for plan property 'cluster_enabled': yes, must be a boolean"))
+			})
+		})
+
+		Describe("systemd overrides", func() {
+			It("does not write any overrides by default", func() {
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, nil, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties).NotTo(HaveKey(adapter.SystemdOverridesPropertyKey))
+			})
+
+			It("writes the plan's overrides into the redis properties", func() {
+				dedicatedPlan.Properties[adapter.SystemdOverridesPropertyKey] = map[string]interface{}{
+					"OOMScoreAdjust": "-900",
+					"LimitNOFILE":    "65536",
+				}
+
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, nil, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties[adapter.SystemdOverridesPropertyKey]).To(Equal(map[interface{}]interface{}{
+					"OOMScoreAdjust": "-900",
+					"LimitNOFILE":    "65536",
+				}))
+			})
+
+			It("returns an error when the overrides are not a map", func() {
+				dedicatedPlan.Properties[adapter.SystemdOverridesPropertyKey] = "OOMScoreAdjust=-900"
+				_, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, nil, nil)
+				Expect(err).To(matchOperatorError("invalid value for plan property 'systemd_overrides': must be a map of systemd directives to values"))
+			})
+
+			It("returns an error when a value is not a string", func() {
+				dedicatedPlan.Properties[adapter.SystemdOverridesPropertyKey] = map[string]interface{}{"OOMScoreAdjust": -900.0}
+				_, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, nil, nil)
+				Expect(err).To(matchOperatorError("invalid value for plan property 'systemd_overrides': -900 for directive OOMScoreAdjust, must be a string"))
+			})
+		})
+
+		Describe("job environment variables", func() {
+			generateRedisServerJob := func() (bosh.Job, error) {
+				generated, err := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				if err != nil {
+					return bosh.Job{}, err
+				}
+				return generated.Manifest.InstanceGroups[0].Jobs[0], nil
+			}
+
+			It("does not set run.env by default", func() {
+				job, err := generateRedisServerJob()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(job.Properties).NotTo(HaveKey("run"))
+			})
+
+			It("writes the plan's variables into run.env on the redis-server job", func() {
+				dedicatedPlan.Properties[adapter.JobEnvVarsPropertyKey] = map[string]interface{}{"MALLOC_ARENA_MAX": "2"}
+
+				job, err := generateRedisServerJob()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(job.Name).To(Equal("redis-server"))
+				Expect(job.Properties["run"]).To(Equal(map[string]interface{}{
+					"env": map[string]string{"MALLOC_ARENA_MAX": "2"},
+				}))
+			})
+
+			It("keeps the redis properties when they are scoped to the job", func() {
+				dedicatedPlan.Properties[adapter.JobEnvVarsPropertyKey] = map[string]interface{}{"MALLOC_ARENA_MAX": "2"}
+				dedicatedPlan.Properties[adapter.PropertyScopePropertyKey] = adapter.PropertyScopeJob
+
+				job, err := generateRedisServerJob()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(job.Properties).To(HaveKey("run"))
+				Expect(job.Properties).To(HaveKey("redis"))
+			})
+
+			DescribeTable("rejecting invalid variables",
+				func(vars interface{}, expectedErr string) {
+					dedicatedPlan.Properties[adapter.JobEnvVarsPropertyKey] = vars
+					_, err := generateRedisServerJob()
+					Expect(err).To(matchOperatorError(expectedErr))
+				},
+				Entry("a list", []interface{}{"MALLOC_ARENA_MAX=2"},
+					"invalid value for plan property 'job_env_vars': must be a map of environment variable names to values"),
+				Entry("a reserved name", map[string]interface{}{"REDIS_PORT": "6380"},
+					"invalid value for plan property 'job_env_vars': environment variable REDIS_PORT is reserved, names beginning REDIS_ are set by the redis job"),
+				Entry("a value that is not a string", map[string]interface{}{"MALLOC_ARENA_MAX": 2.0},
+					"invalid value for plan property 'job_env_vars': 2 for environment variable MALLOC_ARENA_MAX, must be a string"),
+				Entry("a value with a newline", map[string]interface{}{"GREETING": "hello\nworld"},
+					"invalid value for plan property 'job_env_vars': the value of environment variable GREETING must not contain newlines"),
+			)
+		})
+
+		Describe("redis.conf snippet", func() {
+			generateRedisServerJob := func() (bosh.Job, error) {
+				generated, err := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				if err != nil {
+					return bosh.Job{}, err
+				}
+				return generated.Manifest.InstanceGroups[0].Jobs[0], nil
+			}
+
+			It("does not set a snippet by default", func() {
+				job, err := generateRedisServerJob()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(job.Properties).NotTo(HaveKey(adapter.RedisConfSnippetPropertyKey))
+			})
+
+			It("passes the snippet to the redis-server job", func() {
+				snippet := "# tuning\nlatency-monitor-threshold 100\n\nslowlog-log-slower-than 5000\n"
+				dedicatedPlan.Properties[adapter.RedisConfSnippetPropertyKey] = snippet
+
+				job, err := generateRedisServerJob()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(job.Properties).To(HaveKeyWithValue(adapter.RedisConfSnippetPropertyKey, snippet))
+			})
+
+			DescribeTable("rejecting invalid snippets",
+				func(snippet interface{}, expectedErr string) {
+					dedicatedPlan.Properties[adapter.RedisConfSnippetPropertyKey] = snippet
+					_, err := generateRedisServerJob()
+					Expect(err).To(matchOperatorError(expectedErr))
+				},
+				Entry("a value that is not a string", []interface{}{"latency-monitor-threshold 100"},
+					"invalid value for plan property 'redis_conf_snippet': [latency-monitor-threshold 100], must be a string"),
+				Entry("a protected setting", "latency-monitor-threshold 100\nrequirepass hunter2",
+					"invalid value for plan property 'redis_conf_snippet': it overrides settings the adapter manages (line 2: requirepass)"),
+				Entry("several protected settings in any case", "  BIND 0.0.0.0\n# port 6380\nlatency-monitor-threshold 100\nrename-command CONFIG \"\"",
+					"invalid value for plan property 'redis_conf_snippet': it overrides settings the adapter manages (line 1: bind, line 4: rename-command)"),
+			)
+		})
+
+		Describe("release stemcell overrides", func() {
+			generate := func() (bosh.BoshManifest, error) {
+				generated, err := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				return generated.Manifest, err
+			}
+
+			BeforeEach(func() {
+				defaultServiceReleases = append(defaultServiceReleases, serviceadapter.ServiceRelease{
+					Name:    "redis-addons",
+					Version: "3",
+					Jobs:    []string{"redis-exporter"},
+				})
+			})
+
+			It("runs every instance group on the deployment's stemcell by default", func() {
+				manifest, err := generate()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(manifest.Stemcells).To(HaveLen(1))
+				for _, instanceGroup := range manifest.InstanceGroups {
+					Expect(instanceGroup.Stemcell).To(Equal("only-stemcell"))
+				}
+			})
+
+			It("pins the instance groups of a release's jobs to its stemcell", func() {
+				dedicatedPlan.Properties[adapter.ReleaseStemcellOverridesKey] = map[string]interface{}{
+					"some-release-name": map[string]interface{}{"os": "ubuntu-jammy", "version": "1.200"},
+				}
+
+				manifest, err := generate()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(manifest.Stemcells).To(Equal([]bosh.Stemcell{
+					{Alias: "only-stemcell", OS: manifest.Stemcells[0].OS, Version: manifest.Stemcells[0].Version},
+					{Alias: "stemcell-some-release-name", OS: "ubuntu-jammy", Version: "1.200"},
+				}))
+				for _, instanceGroup := range manifest.InstanceGroups {
+					Expect(instanceGroup.Stemcell).To(Equal("stemcell-some-release-name"))
+				}
+			})
+
+			It("leaves instance groups of other releases on the deployment's stemcell", func() {
+				dedicatedPlan.Properties[adapter.ReleaseStemcellOverridesKey] = map[string]interface{}{
+					"redis-addons": map[string]interface{}{"os": "ubuntu-jammy", "version": "1.200"},
+				}
+
+				manifest, err := generate()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(manifest.Stemcells).To(HaveLen(2))
+				Expect(manifest.InstanceGroups[0].Stemcell).To(Equal("only-stemcell"))
+			})
+
+			It("returns an error for a release outside the service deployment", func() {
+				dedicatedPlan.Properties[adapter.ReleaseStemcellOverridesKey] = map[string]interface{}{
+					"other-release": map[string]interface{}{"os": "ubuntu-jammy", "version": "1.200"},
+				}
+
+				_, err := generate()
+				Expect(err).To(matchOperatorError("invalid value for plan property 'release_stemcell_overrides': release other-release is not part of the service deployment"))
+			})
+
+			It("returns an error when a stemcell has no version", func() {
+				dedicatedPlan.Properties[adapter.ReleaseStemcellOverridesKey] = map[string]interface{}{
+					"redis-addons": map[string]interface{}{"os": "ubuntu-jammy"},
+				}
+
+				_, err := generate()
+				Expect(err).To(matchOperatorError("invalid value for plan property 'release_stemcell_overrides': the stemcell for release redis-addons must have an os and a version"))
+			})
+		})
+
+		Describe("instance group lifecycles", func() {
+			generate := func() error {
+				_, err := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				return err
+			}
+
+			It("accepts a redis server with errands alongside it", func() {
+				Expect(generate()).To(Succeed())
+			})
+
+			It("rejects a plan where the redis server is an errand", func() {
+				dedicatedPlan.InstanceGroups[0].Lifecycle = adapter.LifecycleErrandType
+				Expect(generate()).To(matchOperatorError("the redis-server instance group must have the service lifecycle"))
+			})
+
+			It("rejects a plan with a second long-running instance group", func() {
+				dedicatedPlan.InstanceGroups[1].Lifecycle = ""
+				Expect(generate()).To(matchOperatorError("plan defines 2 instance groups with the service lifecycle, only one is allowed: redis-server, health-check"))
+			})
+
+			It("rejects an unknown lifecycle", func() {
+				dedicatedPlan.InstanceGroups[1].Lifecycle = "batch"
+				Expect(generate()).To(matchOperatorError("invalid lifecycle 'batch' for instance group health-check, must be service or errand"))
+			})
+		})
+
+		Describe("deployment order", func() {
+			generateInstanceGroupNames := func() ([]string, error) {
+				generated, err := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				if err != nil {
+					return nil, err
+				}
+				var names []string
+				for _, instanceGroup := range generated.Manifest.InstanceGroups {
+					names = append(names, instanceGroup.Name)
+				}
+				return names, nil
+			}
+
+			It("keeps the generated order when no order is configured", func() {
+				Expect(generateInstanceGroupNames()).To(Equal([]string{"redis-server", "health-check", "cleanup-data"}))
+			})
+
+			It("sorts instance groups by their configured priority", func() {
+				dedicatedPlan.Properties[adapter.DeploymentOrderPropertyKey] = map[string]interface{}{
+					"redis-server": 3.0,
+					"health-check": 2.0,
+					"cleanup-data": 1.0,
+				}
+				Expect(generateInstanceGroupNames()).To(Equal([]string{"cleanup-data", "health-check", "redis-server"}))
+			})
+
+			It("preserves the generated order for equal or absent priorities", func() {
+				dedicatedPlan.Properties[adapter.DeploymentOrderPropertyKey] = map[string]interface{}{
+					"redis-server": 1.0,
+					"cleanup-data": 1.0,
+				}
+				Expect(generateInstanceGroupNames()).To(Equal([]string{"health-check", "redis-server", "cleanup-data"}))
+			})
+
+			It("returns an error when the order names an instance group the plan does not define", func() {
+				dedicatedPlan.Properties[adapter.DeploymentOrderPropertyKey] = map[string]interface{}{"redis-replica": 1.0}
+				_, err := generateInstanceGroupNames()
+				Expect(err).To(matchOperatorError("plan property 'deployment_order' names unknown instance group(s): redis-replica"))
+			})
+
+			It("returns an error when a priority is not an integer", func() {
+				dedicatedPlan.Properties[adapter.DeploymentOrderPropertyKey] = map[string]interface{}{"redis-server": "first"}
+				_, err := generateInstanceGroupNames()
+				Expect(err).To(matchOperatorError("invalid value for plan property 'deployment_order': first for instance group 'redis-server', must be an integer"))
+			})
+		})
+
+		Describe("maxmemory", func() {
+			generateMaxMemory := func(maxMemory interface{}) (interface{}, error) {
+				requestParams := map[string]interface{}{
+					"parameters": map[string]interface{}{adapter.MaxMemoryKey: maxMemory},
+				}
+				generated, err := generateManifest(
+					manifestGenerator,
+					defaultServiceReleases,
+					dedicatedPlan,
+					requestParams,
+					nil,
+					nil,
+					nil,
+				)
+				if err != nil {
+					return nil, err
+				}
+				return generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})[adapter.MaxMemoryKey], nil
+			}
+
+			DescribeTable("writes the requested maxmemory in bytes",
+				func(maxMemory interface{}, expected string) {
+					Expect(generateMaxMemory(maxMemory)).To(Equal(expected))
+				},
+				Entry("plain bytes", 1048576.0, "1048576"),
+				Entry("megabytes", "512mb", "536870912"),
+				Entry("gigabytes", "2GB", "2147483648"),
+			)
+
+			It("returns an error when maxmemory is not a valid size", func() {
+				_, err := generateMaxMemory("lots")
+				Expect(err).To(matchUserError("invalid value for parameter 'maxmemory': lots is not a valid memory size"))
+			})
+
+			Context("when the plan sets a maxmemory limit", func() {
+				BeforeEach(func() {
+					dedicatedPlan.Properties[adapter.MaxMemoryLimitPropertyKey] = "1gb"
+				})
+
+				It("allows a maxmemory within the limit", func() {
+					Expect(generateMaxMemory("1024mb")).To(Equal("1073741824"))
+				})
+
+				It("returns an error naming both values when maxmemory exceeds the limit", func() {
+					_, err := generateMaxMemory("2gb")
+					Expect(err).To(matchUserError("requested maxmemory 2gb exceeds the plan limit of 1gb"))
+				})
+			})
+		})
+
+		Describe("replication tuning", func() {
+			DescribeTable("writes the requested repl-backlog-size in bytes",
+				func(size interface{}, expected string) {
+					redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, withArbitraryParams(map[string]interface{}{adapter.ReplBacklogSizeKey: size}), nil)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(redisProperties).To(HaveKeyWithValue(adapter.ReplBacklogSizeKey, expected))
+				},
+				Entry("plain bytes", 1048576.0, "1048576"),
+				Entry("kilobytes", "512kb", "524288"),
+				Entry("megabytes with surrounding spaces", " 64MB ", "67108864"),
+				Entry("gigabytes", "1gb", "1073741824"),
+			)
+
+			DescribeTable("rejects an invalid repl-backlog-size",
+				func(size interface{}, expectedErr string) {
+					_, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, withArbitraryParams(map[string]interface{}{adapter.ReplBacklogSizeKey: size}), nil)
+					Expect(err).To(matchUserError(expectedErr))
+				},
+				Entry("an unknown unit", "1tb", "invalid value for parameter 'repl-backlog-size': 1tb is not a valid memory size"),
+				Entry("a negative size", -1.0, "invalid value for parameter 'repl-backlog-size': -1 is not a valid memory size"),
+				Entry("zero", "0mb", "invalid value for parameter 'repl-backlog-size': 0mb, must be greater than zero"),
+			)
+
+			It("writes repl-timeout in seconds", func() {
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, withArbitraryParams(map[string]interface{}{adapter.ReplTimeoutKey: 120.0}), nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties).To(HaveKeyWithValue(adapter.ReplTimeoutKey, 120))
+			})
+
+			It("rejects a repl-timeout that is not a positive integer", func() {
+				_, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, withArbitraryParams(map[string]interface{}{adapter.ReplTimeoutKey: "soon"}), nil)
+				Expect(err).To(matchUserError("invalid value for parameter 'repl-timeout': soon, must be a positive integer number of seconds"))
+			})
+
+			It("carries both settings forward from the previous manifest", func() {
+				oldManifest := createDefaultOldManifest()
+				previousRedisProperties := oldManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})
+				previousRedisProperties[adapter.ReplBacklogSizeKey] = "67108864"
+				previousRedisProperties[adapter.ReplTimeoutKey] = 120
+
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, withArbitraryParams(map[string]interface{}{"maxclients": 10.0}), &oldManifest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties).To(HaveKeyWithValue(adapter.ReplBacklogSizeKey, "67108864"))
+				Expect(redisProperties).To(HaveKeyWithValue(adapter.ReplTimeoutKey, 120))
+			})
+
+			It("warns when the plan has no replicas", func() {
+				_, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, withArbitraryParams(map[string]interface{}{adapter.ReplTimeoutKey: 120.0}), nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stderr).To(gbytes.Say("parameter 'repl-timeout' is set but the plan deploys no redis-replica instance group"))
+			})
+
+			It("does not warn when the plan deploys replicas", func() {
+				dedicatedPlan.InstanceGroups = append(dedicatedPlan.InstanceGroups, serviceadapter.InstanceGroup{
+					Name:      adapter.ReplicaInstanceGroupName,
+					Instances: 2,
+				})
+
+				_, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, withArbitraryParams(map[string]interface{}{adapter.ReplTimeoutKey: 120.0}), nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(stderr.Contents())).NotTo(ContainSubstring("has no effect without replicas"))
+			})
+		})
+
+		Describe("lazy freeing", func() {
+			It("writes yes or no for each configured toggle", func() {
+				requestParams := map[string]interface{}{
+					"parameters": map[string]interface{}{
+						"lazyfree-lazy-eviction": true,
+						"replica-lazy-flush":     false,
+					},
+				}
+
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, requestParams, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties["lazyfree-lazy-eviction"]).To(Equal("yes"))
+				Expect(redisProperties["replica-lazy-flush"]).To(Equal("no"))
+				Expect(redisProperties).NotTo(HaveKey("lazyfree-lazy-expire"))
+				Expect(redisProperties).NotTo(HaveKey("lazyfree-lazy-server-del"))
+			})
+
+			It("carries the toggles forward from the previous manifest", func() {
+				oldManifest := createDefaultOldManifest()
+				oldManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["lazyfree-lazy-expire"] = "yes"
+
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties["lazyfree-lazy-expire"]).To(Equal("yes"))
+			})
+
+			It("returns an error naming every toggle that is not a boolean", func() {
+				requestParams := map[string]interface{}{
+					"parameters": map[string]interface{}{
+						"lazyfree-lazy-eviction":   "yes",
+						"lazyfree-lazy-server-del": 1.0,
+					},
+				}
+
+				_, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, requestParams, nil)
+				Expect(err).To(matchUserError("invalid value for parameter(s) lazyfree-lazy-eviction, lazyfree-lazy-server-del: must be a boolean"))
+			})
+		})
+
+		Describe("eviction tenacity", func() {
+			withTenacity := func(tenacity interface{}) map[string]interface{} {
+				return map[string]interface{}{"parameters": map[string]interface{}{adapter.EvictionTenacityKey: tenacity}}
+			}
+
+			It("leaves maxmemory-eviction-tenacity unset by default", func() {
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties).NotTo(HaveKey(adapter.EvictionTenacityKey))
+			})
+
+			DescribeTable("writes a tenacity within range",
+				func(tenacity float64, expected int) {
+					redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, withTenacity(tenacity), nil)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(redisProperties).To(HaveKeyWithValue(adapter.EvictionTenacityKey, expected))
+				},
+				Entry("the lowest", 0.0, 0),
+				Entry("the highest", 100.0, 100),
+			)
+
+			It("carries the tenacity forward from the previous manifest", func() {
+				oldManifest := createDefaultOldManifest()
+				oldManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})[adapter.EvictionTenacityKey] = 0
+
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties).To(HaveKeyWithValue(adapter.EvictionTenacityKey, 0))
+			})
+
+			DescribeTable("returns an error when the tenacity is invalid",
+				func(tenacity interface{}) {
+					_, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, withTenacity(tenacity), nil)
+					Expect(err).To(matchUserError(fmt.Sprintf("invalid value for parameter 'maxmemory-eviction-tenacity': %v, must be an integer between 0 and 100", tenacity)))
+				},
+				Entry("negative", -1.0),
+				Entry("too large", 101.0),
+				Entry("fractional", 10.5),
+				Entry("not a number", "high"),
+			)
+		})
+
+		Describe("loglevel", func() {
+			withLogLevel := func(level interface{}) map[string]interface{} {
+				return map[string]interface{}{"parameters": map[string]interface{}{adapter.RedisLogLevelKey: level}}
+			}
+			oldManifestWithLogLevel := func(level string) *bosh.BoshManifest {
+				oldManifest := createDefaultOldManifest()
+				oldManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})[adapter.RedisLogLevelKey] = level
+				return &oldManifest
+			}
+
+			It("leaves loglevel unset when neither the instance nor the plan sets it", func() {
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties).NotTo(HaveKey(adapter.RedisLogLevelKey))
+			})
+
+			It("defaults to the plan's default_loglevel", func() {
+				dedicatedPlan.Properties[adapter.DefaultLogLevelPropertyKey] = "warning"
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties).To(HaveKeyWithValue(adapter.RedisLogLevelKey, "warning"))
+			})
+
+			DescribeTable("writes the requested loglevel",
+				func(level string) {
+					dedicatedPlan.Properties[adapter.DefaultLogLevelPropertyKey] = "warning"
+					redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, withLogLevel(level), nil)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(redisProperties).To(HaveKeyWithValue(adapter.RedisLogLevelKey, level))
+				},
+				Entry("debug", "debug"),
+				Entry("verbose", "verbose"),
+				Entry("notice", "notice"),
+				Entry("warning", "warning"),
+			)
+
+			It("carries the loglevel forward from the previous manifest", func() {
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, oldManifestWithLogLevel("debug"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties).To(HaveKeyWithValue(adapter.RedisLogLevelKey, "debug"))
+			})
+
+			It("resets to the plan default on an explicit null", func() {
+				dedicatedPlan.Properties[adapter.DefaultLogLevelPropertyKey] = "notice"
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, withLogLevel(nil), oldManifestWithLogLevel("debug"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties).To(HaveKeyWithValue(adapter.RedisLogLevelKey, "notice"))
+			})
+
+			It("removes the loglevel on an explicit null when the plan has no default", func() {
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, withLogLevel(nil), oldManifestWithLogLevel("debug"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties).NotTo(HaveKey(adapter.RedisLogLevelKey))
+			})
+
+			DescribeTable("returns an error when the loglevel is invalid",
+				func(level interface{}) {
+					_, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, withLogLevel(level), nil)
+					Expect(err).To(matchUserError(fmt.Sprintf("invalid value for parameter 'loglevel': %v, must be one of debug, verbose, notice, warning", level)))
+				},
+				Entry("unknown", "trace"),
+				Entry("upper case", "DEBUG"),
+				Entry("not a string", 1.0),
+			)
+
+			It("returns an error when the plan default is invalid", func() {
+				dedicatedPlan.Properties[adapter.DefaultLogLevelPropertyKey] = "silent"
+				_, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, nil)
+				Expect(err).To(matchOperatorError("invalid value for plan property 'default_loglevel': silent, must be one of debug, verbose, notice, warning"))
+			})
+		})
+
+		Describe("unix socket", func() {
+			const socketPath = "/var/vcap/sys/run/redis/redis.sock"
+
+			It("is disabled by default", func() {
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, withArbitraryParams(map[string]interface{}{}), nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties).NotTo(HaveKey(adapter.UnixSocketKey))
+				Expect(redisProperties).NotTo(HaveKey(adapter.UnixSocketPermKey))
+			})
+
+			DescribeTable("writes the socket path and its permissions",
+				func(perm interface{}, expected string) {
+					redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, withArbitraryParams(map[string]interface{}{
+						adapter.UnixSocketKey:     socketPath,
+						adapter.UnixSocketPermKey: perm,
+					}), nil)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(redisProperties).To(HaveKeyWithValue(adapter.UnixSocketKey, socketPath))
+					Expect(redisProperties).To(HaveKeyWithValue(adapter.UnixSocketPermKey, expected))
+				},
+				Entry("as a string", "770", "770"),
+				Entry("with a leading zero", "0700", "700"),
+				Entry("as a number", 755.0, "755"),
+			)
+
+			It("carries the socket forward from the previous manifest", func() {
+				oldManifest := createDefaultOldManifest()
+				previousRedisProperties := oldManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})
+				previousRedisProperties[adapter.UnixSocketKey] = socketPath
+				previousRedisProperties[adapter.UnixSocketPermKey] = "700"
+
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, withArbitraryParams(map[string]interface{}{}), &oldManifest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties).To(HaveKeyWithValue(adapter.UnixSocketKey, socketPath))
+				Expect(redisProperties).To(HaveKeyWithValue(adapter.UnixSocketPermKey, "700"))
+			})
+
+			DescribeTable("rejects invalid values",
+				func(params map[string]interface{}, expectedErr string) {
+					_, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, withArbitraryParams(params), nil)
+					Expect(err).To(matchUserError(expectedErr))
+				},
+				Entry("an empty path", map[string]interface{}{adapter.UnixSocketKey: " "}, "invalid value for parameter 'unixsocket':  , must be a non-empty path"),
+				Entry("a non-string path", map[string]interface{}{adapter.UnixSocketKey: true}, "invalid value for parameter 'unixsocket': true, must be a non-empty path"),
+				Entry("a non-octal perm", map[string]interface{}{adapter.UnixSocketKey: socketPath, adapter.UnixSocketPermKey: "789"}, "invalid value for parameter 'unixsocketperm': 789, must be an octal permission such as 700"),
+				Entry("a perm above 777", map[string]interface{}{adapter.UnixSocketKey: socketPath, adapter.UnixSocketPermKey: "1777"}, "invalid value for parameter 'unixsocketperm': 1777, must be an octal permission such as 700"),
+				Entry("a perm without a socket", map[string]interface{}{adapter.UnixSocketPermKey: "700"}, "parameter 'unixsocketperm' requires 'unixsocket' to be set"),
+			)
+		})
+
+		Describe("maintenance mode", func() {
+			maintenanceModeOn := map[string]interface{}{adapter.MaintenanceModeKey: true}
+
+			It("restricts redis to localhost without a password on update", func() {
+				oldManifest := createDefaultOldManifest()
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, withArbitraryParams(maintenanceModeOn), &oldManifest)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties).To(HaveKeyWithValue(adapter.RequirePassKey, ""))
+				Expect(redisProperties).To(HaveKeyWithValue("bind", adapter.MaintenanceBindAddress))
+				Expect(stderr).To(gbytes.Say("maintenance_mode is enabled: redis only listens on 127.0.0.1 and does not require a password"))
+			})
+
+			It("rejects the parameter at provision time", func() {
+				_, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, withArbitraryParams(maintenanceModeOn), nil)
+				Expect(err).To(matchUserError("parameter 'maintenance_mode' is only allowed when updating an instance"))
+			})
+
+			It("rejects a value that is not a boolean", func() {
+				oldManifest := createDefaultOldManifest()
+				_, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, withArbitraryParams(map[string]interface{}{adapter.MaintenanceModeKey: "on"}), &oldManifest)
+				Expect(err).To(matchUserError("invalid value for parameter 'maintenance_mode': on, must be a boolean"))
+			})
+
+			Context("when the previous manifest is in maintenance mode", func() {
+				var oldManifest bosh.BoshManifest
+
+				BeforeEach(func() {
+					oldManifest = createDefaultOldManifest()
+					previousRedisProperties := oldManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})
+					previousRedisProperties[adapter.RequirePassKey] = ""
+					previousRedisProperties["bind"] = adapter.MaintenanceBindAddress
+				})
+
+				It("stays in maintenance mode on updates that do not mention it", func() {
+					redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, withArbitraryParams(map[string]interface{}{"maxclients": 10.0}), &oldManifest)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(redisProperties).To(HaveKeyWithValue(adapter.RequirePassKey, ""))
+					Expect(redisProperties).To(HaveKeyWithValue("bind", adapter.MaintenanceBindAddress))
+				})
+
+				It("restores the password and bind address when it is turned off", func() {
+					redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, withArbitraryParams(map[string]interface{}{adapter.MaintenanceModeKey: false}), &oldManifest)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(redisProperties).NotTo(HaveKey(adapter.RequirePassKey))
+					Expect(redisProperties).NotTo(HaveKey("bind"))
+					Expect(redisProperties).To(HaveKeyWithValue("password", "some-password"))
+				})
+			})
+		})
+
+		Describe("CPU tuning", func() {
+			It("leaves hz, dynamic-hz and activerehashing unset by default", func() {
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties).NotTo(HaveKey("hz"))
+				Expect(redisProperties).NotTo(HaveKey("dynamic-hz"))
+				Expect(redisProperties).NotTo(HaveKey("activerehashing"))
+			})
+
+			It("writes the configured values", func() {
+				requestParams := map[string]interface{}{
+					"parameters": map[string]interface{}{
+						"hz":              50.0,
+						"dynamic-hz":      true,
+						"activerehashing": false,
+					},
+				}
+
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, requestParams, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties["hz"]).To(Equal(50))
+				Expect(redisProperties["dynamic-hz"]).To(Equal("yes"))
+				Expect(redisProperties["activerehashing"]).To(Equal("no"))
+			})
+
+			It("carries the values forward from the previous manifest", func() {
+				oldManifest := createDefaultOldManifest()
+				oldRedisProperties := oldManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})
+				oldRedisProperties["hz"] = 20
+				oldRedisProperties["dynamic-hz"] = "no"
+				oldRedisProperties["activerehashing"] = "yes"
+
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties["hz"]).To(Equal(20))
+				Expect(redisProperties["dynamic-hz"]).To(Equal("no"))
+				Expect(redisProperties["activerehashing"]).To(Equal("yes"))
+			})
+
+			DescribeTable("returns an error when hz is invalid",
+				func(hz interface{}) {
+					requestParams := map[string]interface{}{
+						"parameters": map[string]interface{}{"hz": hz},
+					}
+					_, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, requestParams, nil)
+					Expect(err).To(matchUserError(fmt.Sprintf("invalid value for parameter 'hz': %v, must be an integer between 1 and 500", hz)))
+				},
+				Entry("zero", 0.0),
+				Entry("too large", 501.0),
+				Entry("fractional", 10.5),
+				Entry("not a number", "fast"),
+			)
+
+			It("returns an error when dynamic-hz is not a boolean", func() {
+				requestParams := map[string]interface{}{
+					"parameters": map[string]interface{}{"dynamic-hz": "yes"},
+				}
+				_, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, requestParams, nil)
+				Expect(err).To(matchUserError("invalid value for parameter 'dynamic-hz': yes, must be a boolean"))
+			})
+		})
+
+		Describe("encoding limits", func() {
+			It("writes the encoding limits into the redis properties", func() {
+				requestParams := map[string]interface{}{
+					"parameters": map[string]interface{}{
+						adapter.EncodingLimitsKey: map[string]interface{}{
+							"hash-max-listpack-entries": 256.0,
+							"list-max-listpack-size":    -2.0,
+						},
+					},
+				}
+
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, requestParams, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties[adapter.EncodingLimitsKey]).To(Equal(map[interface{}]interface{}{
+					"hash-max-listpack-entries": 256,
+					"list-max-listpack-size":    -2,
+				}))
+			})
+
+			It("carries the encoding limits forward from the previous manifest", func() {
+				oldManifest := createDefaultOldManifest()
+				oldManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})[adapter.EncodingLimitsKey] = map[interface{}]interface{}{
+					"set-max-intset-entries": 1024,
+				}
+
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties[adapter.EncodingLimitsKey]).To(Equal(map[interface{}]interface{}{
+					"set-max-intset-entries": 1024,
+				}))
+			})
+
+			It("does not set encoding limits by default", func() {
+				redisProperties, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties).NotTo(HaveKey(adapter.EncodingLimitsKey))
+			})
+
+			It("returns an error for unknown encoding limits", func() {
+				requestParams := map[string]interface{}{
+					"parameters": map[string]interface{}{
+						adapter.EncodingLimitsKey: map[string]interface{}{"foo": 1.0, "bar": 2.0},
+					},
+				}
+
+				_, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, requestParams, nil)
+				Expect(err).To(matchUserError("unsupported encoding limit(s): bar, foo"))
+			})
+
+			It("returns an error for non-integer encoding limits", func() {
+				requestParams := map[string]interface{}{
+					"parameters": map[string]interface{}{
+						adapter.EncodingLimitsKey: map[string]interface{}{"zset-max-listpack-value": "big"},
+					},
+				}
+
+				_, err := generateRedisProperties(manifestGenerator, defaultServiceReleases, dedicatedPlan, requestParams, nil)
+				Expect(err).To(matchUserError("invalid value for encoding limit 'zset-max-listpack-value': big, must be an integer"))
+			})
+		})
+
+		DescribeTable("carries maxclients forward from a previous manifest regardless of its numeric encoding",
+			func(previousMaxClients interface{}) {
+				oldManifest := createDefaultOldManifest()
+				oldManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["maxclients"] = previousMaxClients
+
+				manifestYAML, err := yaml.Marshal(oldManifest)
+				Expect(err).NotTo(HaveOccurred())
+				var reparsedManifest bosh.BoshManifest
+				Expect(yaml.Unmarshal(manifestYAML, &reparsedManifest)).To(Succeed())
+
+				for _, previousManifest := range []bosh.BoshManifest{oldManifest, reparsedManifest} {
+					generated, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &previousManifest)
+					Expect(generateErr).NotTo(HaveOccurred())
+					Expect(generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["maxclients"]).To(Equal(47))
+				}
+			},
+			Entry("int", 47),
+			Entry("int64", int64(47)),
+			Entry("float64", 47.0),
+			Entry("quoted string", "47"),
+		)
+
+		It("returns an error when maxclients in the previous manifest is not numeric", func() {
+			oldManifest := createDefaultOldManifest()
+			oldManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["maxclients"] = "lots"
+
+			_, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
+			Expect(generateErr).To(matchOperatorError("error reading the previous manifest: invalid value for maxclients: lots (string)"))
+		})
+
+		Describe("maxclients bounds", func() {
+			generateMaxClients := func(requestParams map[string]interface{}, previousManifest *bosh.BoshManifest) (interface{}, error) {
+				generated, err := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, requestParams, previousManifest)
+				if err != nil {
+					return nil, err
+				}
+				return generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["maxclients"], nil
+			}
+			requestingMaxClients := func(maxClients float64) map[string]interface{} {
+				return map[string]interface{}{"parameters": map[string]interface{}{"maxclients": maxClients}}
+			}
+
+			BeforeEach(func() {
+				dedicatedPlan.Properties[adapter.MaxClientsMinPropertyKey] = 100
+				dedicatedPlan.Properties[adapter.MaxClientsMaxPropertyKey] = 2000
+			})
+
+			It("accepts a requested maxclients within the plan's range", func() {
+				Expect(generateMaxClients(requestingMaxClients(2000), nil)).To(Equal(2000))
+			})
+
+			It("returns a user error stating the range when the request is above it", func() {
+				_, err := generateMaxClients(requestingMaxClients(50000), nil)
+				Expect(err).To(matchUserError("invalid value for parameter 'maxclients': 50000, this plan allows between 100 and 2000"))
+			})
+
+			It("returns a user error when the request is below a plan's only bound", func() {
+				delete(dedicatedPlan.Properties, adapter.MaxClientsMaxPropertyKey)
+				_, err := generateMaxClients(requestingMaxClients(10), nil)
+				Expect(err).To(matchUserError("invalid value for parameter 'maxclients': 10, this plan allows at least 100"))
+			})
+
+			It("clamps a previous value outside a new plan's range and logs a warning", func() {
+				oldManifest := createDefaultOldManifest()
+				oldManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["maxclients"] = 50000
+
+				Expect(generateMaxClients(defaultRequestParameters, &oldManifest)).To(Equal(2000))
+				Expect(stderr).To(gbytes.Say("maxclients 50000 is outside the range this plan allows \\(between 100 and 2000\\), using 2000"))
+			})
+
+			It("returns an operator error when the adapter default is outside the plan's range", func() {
+				delete(dedicatedPlan.Properties, adapter.MaxClientsMinPropertyKey)
+				dedicatedPlan.Properties[adapter.MaxClientsMaxPropertyKey] = 50
+
+				_, err := generateMaxClients(defaultRequestParameters, nil)
+				Expect(err).To(matchOperatorError("the default maxclients 10000 is outside the range this plan allows (at most 50), adjust plan properties 'maxclients_min' and 'maxclients_max' or the adapter's maxclients"))
+			})
+
+			It("uses the adapter default when it is within the plan's range", func() {
+				dedicatedPlan.Properties[adapter.MaxClientsMaxPropertyKey] = 20000
+				Expect(generateMaxClients(defaultRequestParameters, nil)).To(Equal(10000))
+			})
+
+			It("returns an error when the bounds are reversed", func() {
+				dedicatedPlan.Properties[adapter.MaxClientsMinPropertyKey] = 5000
+				_, err := generateMaxClients(defaultRequestParameters, nil)
+				Expect(err).To(matchOperatorError("invalid maxclients bounds: plan property 'maxclients_min' (5000) is greater than 'maxclients_max' (2000)"))
+			})
+		})
+
+		It("uses that value in secrets map when odb_managed_secret is set in arbitrary parameters", func() {
+			requestParams := map[string]interface{}{
+				"parameters": map[string]interface{}{
+					adapter.ManagedSecretKey: "foo",
+				},
+			}
+
+			oldManifest := createDefaultOldManifest()
+
+			generated, _ := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, requestParams, &oldManifest)
+
+			Expect(generated.ODBManagedSecrets[adapter.ManagedSecretKey]).To(Equal("foo"))
+		})
+
+		It("set credhub reference if credhub_secret_path is set in arbitrary parameters", func() {
+			requestParams := map[string]interface{}{
+				"parameters": map[string]interface{}{
+					"credhub_secret_path": "/foo",
+				},
+			}
+
+			oldManifest := createDefaultOldManifest()
+
+			generated, err := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, requestParams, &oldManifest)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["secret"]).To(Equal("((/foo))"))
+		})
+
+		It("returns an error when invalid arbitrary parameters are set", func() {
+			invalidRequestParams := map[string]interface{}{
+				"parameters": map[string]interface{}{"maxclients": 22.0, "foo": "bar", "baz": "barry"},
+			}
+
+			oldManifest := createDefaultEmptyManifest()
+
+			_, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, invalidRequestParams, &oldManifest)
+			Expect(generateErr).To(MatchError(ContainSubstring("foo")))
+			Expect(generateErr).To(MatchError(ContainSubstring("baz")))
+			Expect(operatorMessage(generateErr)).To(ContainSubstring("unsupported parameter(s) for this service plan: "))
+		})
+
+		It("rejects arbitrary parameters the plan does not allow", func() {
+			dedicatedPlan.Properties[adapter.AllowedArbitraryParamsPropertyKey] = []interface{}{"maxclients"}
+			invalidRequestParams := map[string]interface{}{
+				"parameters": map[string]interface{}{"maxclients": 22.0, "hz": 10.0},
+			}
+
+			_, generateErr := generateManifest(
+				manifestGenerator,
 				defaultServiceReleases,
 				dedicatedPlan,
 				invalidRequestParams,
-				&oldManifest,
+				nil,
 				nil,
 				nil,
 			)
-			Expect(generateErr).To(MatchError(ContainSubstring("foo")))
-			Expect(generateErr).To(MatchError(ContainSubstring("baz")))
+			Expect(generateErr).To(matchUserError("unsupported parameter(s) for this service plan: hz"))
+		})
+
+		It("returns an error when the plan allows a parameter the adapter does not support", func() {
+			dedicatedPlan.Properties[adapter.AllowedArbitraryParamsPropertyKey] = []interface{}{"maxclients", "foo"}
+
+			_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+			Expect(generateErr).To(matchOperatorError("plan property 'allowed_arbitrary_params' lists unsupported parameter(s): foo"))
+		})
+
+		It("lists unsupported arbitrary parameters in alphabetical order", func() {
+			invalidRequestParams := map[string]interface{}{
+				"parameters": map[string]interface{}{"zeta": 1.0, "foo": "bar", "alpha": true, "baz": "barry"},
+			}
+
+			_, generateErr := generateManifest(
+				manifestGenerator,
+				defaultServiceReleases,
+				dedicatedPlan,
+				invalidRequestParams,
+				nil,
+				nil,
+				nil,
+			)
+			Expect(generateErr).To(matchUserError("unsupported parameter(s) for this service plan: alpha, baz, foo, zeta"))
+		})
+
+		It("reports every structural problem at once", func() {
+			delete(dedicatedPlan.Properties, "persistence")
+			invalidRequestParams := map[string]interface{}{
+				"parameters": map[string]interface{}{"foo": "bar", "hz": 1000.0},
+			}
+			missingRedisJobRelease := serviceadapter.ServiceReleases{
+				{
+					Name:    "some-release-name",
+					Version: "4",
+					Jobs:    []string{adapter.HealthCheckErrandName, adapter.CleanupDataErrandName},
+				},
+			}
+
+			_, generateErr := generateManifest(
+				manifestGenerator,
+				missingRedisJobRelease,
+				dedicatedPlan,
+				invalidRequestParams,
+				nil,
+				nil,
+				nil,
+			)
+			Expect(generateErr).To(MatchError(strings.Join([]string{
+				"the following problems must be fixed:",
+				"- unsupported parameter(s) for this service plan: foo",
+				"- invalid value for parameter 'hz': 1000, must be an integer between 1 and 500",
+				"- " + adapter.ContactOperatorMessage,
+			}, "\n")))
+			Expect(operatorMessage(generateErr)).To(Equal(strings.Join([]string{
+				"deployment some-instance-id: 4 problems found:",
+				"- unsupported parameter(s) for this service plan: foo",
+				"- invalid value for parameter 'hz': 1000, must be an integer between 1 and 500",
+				"- the plan property 'persistence' is missing",
+				"- error gathering redis server job: no release provided for job redis-server, releases provide: some-release-name (health-check, cleanup-data)",
+			}, "\n")))
 		})
 
 		It("returns an error when the health-check job is missing from the service releases", func() {
@@ -670,23 +2690,115 @@ var _ = Describe("Redis Service Adapter", func() {
 
 			oldManifest := createDefaultOldManifest()
 
-			_, generateErr := generateManifest(
-				manifestGenerator,
-				missingHealthCheckJobReleases,
-				dedicatedPlan,
-				defaultRequestParameters,
-				&oldManifest,
-				nil,
-				nil,
-			)
+			_, generateErr := generateUpdateManifest(manifestGenerator, missingHealthCheckJobReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
 
 			Expect(generateErr).To(HaveOccurred())
-			Expect(generateErr).To(MatchError(fmt.Sprintf(
-				"no release provided for job %s",
+			Expect(generateErr).To(matchOperatorError(fmt.Sprintf(
+				"no release provided for job %s, releases provide: some-release-name (redis-server, cleanup-data)",
 				adapter.HealthCheckErrandName,
 			)))
 		})
 
+		DescribeTable("rejects an incomplete service deployment",
+			func(modify func(*serviceadapter.ServiceDeployment), expectedDetail string) {
+				serviceDeployment := serviceadapter.ServiceDeployment{
+					DeploymentName: "some-instance-id",
+					Stemcell:       serviceadapter.Stemcell{OS: "some-stemcell-os", Version: "1234"},
+					Releases:       defaultServiceReleases,
+				}
+				modify(&serviceDeployment)
+
+				_, generateErr := manifestGenerator.GenerateManifest(serviceDeployment, dedicatedPlan, nil, nil, nil, nil)
+				Expect(generateErr).To(matchOperatorError(expectedDetail))
+				Expect(stderr).To(gbytes.Say("deployment some-instance-id: "))
+			},
+			Entry("with no releases", func(d *serviceadapter.ServiceDeployment) {
+				d.Releases = nil
+			}, "service deployment is missing 'releases'"),
+			Entry("with a release missing its name", func(d *serviceadapter.ServiceDeployment) {
+				d.Releases = serviceadapter.ServiceReleases{{Version: "4", Jobs: []string{adapter.RedisJobName}}}
+			}, "service deployment release at index 0 is missing 'name'"),
+			Entry("with a release missing its version", func(d *serviceadapter.ServiceDeployment) {
+				d.Releases = serviceadapter.ServiceReleases{{Name: "some-release-name", Jobs: []string{adapter.RedisJobName}}}
+			}, "service deployment release 'some-release-name' is missing 'version'"),
+			Entry("with a release missing its name and version", func(d *serviceadapter.ServiceDeployment) {
+				d.Releases = serviceadapter.ServiceReleases{{Jobs: []string{adapter.RedisJobName}}}
+			}, "2 problems found:\n"+
+				"- service deployment release at index 0 is missing 'name'\n"+
+				"- service deployment release at index 0 is missing 'version'"),
+			Entry("with a stemcell missing its OS", func(d *serviceadapter.ServiceDeployment) {
+				d.Stemcell.OS = ""
+			}, "service deployment stemcell is missing 'stemcell_os'"),
+			Entry("with a stemcell missing its version", func(d *serviceadapter.ServiceDeployment) {
+				d.Stemcell.Version = ""
+			}, "service deployment stemcell is missing 'stemcell_version'"),
+			Entry("with a zero-value stemcell", func(d *serviceadapter.ServiceDeployment) {
+				d.Stemcell = serviceadapter.Stemcell{}
+			}, "2 problems found:\n"+
+				"- service deployment stemcell is missing 'stemcell_os'\n"+
+				"- service deployment stemcell is missing 'stemcell_version'"),
+		)
+
+		Describe("strict generation", func() {
+			var serviceDeployment serviceadapter.ServiceDeployment
+
+			BeforeEach(func() {
+				serviceDeployment = serviceadapter.ServiceDeployment{
+					DeploymentName: "some-instance-id",
+					Stemcell:       serviceadapter.Stemcell{OS: "some-stemcell-os"},
+					Releases:       defaultServiceReleases,
+				}
+				delete(dedicatedPlan.Properties, "persistence")
+			})
+
+			requestParams := map[string]interface{}{"parameters": map[string]interface{}{"maxclients": "lots"}}
+
+			It("reports the service deployment, plan and parameter problems together", func() {
+				_, generateErr := manifestGenerator.GenerateManifestStrict(serviceDeployment, dedicatedPlan, requestParams, nil, nil, nil)
+
+				Expect(generateErr).To(matchAdapterError(
+					ContainSubstring("invalid value for parameter 'maxclients': lots, must be an integer"),
+					And(
+						ContainSubstring("3 problems found:"),
+						ContainSubstring("- service deployment stemcell is missing 'stemcell_version'"),
+						ContainSubstring("- the plan property 'persistence' is missing"),
+						ContainSubstring("- invalid value for parameter 'maxclients': lots, must be an integer"),
+					),
+				))
+			})
+
+			It("leaves GenerateManifest stopping at the service deployment", func() {
+				_, generateErr := manifestGenerator.GenerateManifest(serviceDeployment, dedicatedPlan, requestParams, nil, nil, nil)
+
+				Expect(generateErr).To(matchOperatorError("service deployment stemcell is missing 'stemcell_version'"))
+			})
+
+			It("refuses a manifest that GenerateManifest only warns about", func() {
+				dedicatedPlan.Properties["persistence"] = true
+				serviceDeployment.Stemcell.Version = "1234"
+				replicationParams := map[string]interface{}{"parameters": map[string]interface{}{adapter.ReplBacklogSizeKey: 1048576.0}}
+
+				generated, err := manifestGenerator.GenerateManifest(serviceDeployment, dedicatedPlan, replicationParams, nil, nil, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(generated.Manifest.InstanceGroups).NotTo(BeEmpty())
+				Expect(stderr).To(gbytes.Say("parameter 'repl-backlog-size' is set but the plan deploys no redis-replica instance group"))
+
+				_, generateErr := manifestGenerator.GenerateManifestStrict(serviceDeployment, dedicatedPlan, replicationParams, nil, nil, nil)
+				Expect(generateErr).To(matchOperatorError("parameter 'repl-backlog-size' is set but the plan deploys no redis-replica instance group, it has no effect without replicas"))
+			})
+
+			It("generates the same manifest as GenerateManifest when there are no problems", func() {
+				dedicatedPlan.Properties["persistence"] = true
+				serviceDeployment.Stemcell.Version = "1234"
+
+				strict, err := manifestGenerator.GenerateManifestStrict(serviceDeployment, dedicatedPlan, defaultRequestParameters, nil, nil, nil)
+				Expect(err).NotTo(HaveOccurred())
+				generated, err := manifestGenerator.GenerateManifest(serviceDeployment, dedicatedPlan, defaultRequestParameters, nil, nil, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(strict.Manifest.InstanceGroups).To(Equal(generated.Manifest.InstanceGroups))
+			})
+		})
+
 		It("returns an error when redis job is missing from the service releases", func() {
 			oldManifest := createDefaultOldManifest()
 
@@ -701,18 +2813,10 @@ var _ = Describe("Redis Service Adapter", func() {
 				},
 			}
 
-			_, generateErr := generateManifest(
-				manifestGenerator,
-				missingRedisJobRelease,
-				dedicatedPlan,
-				defaultRequestParameters,
-				&oldManifest,
-				nil,
-				nil,
-			)
+			_, generateErr := generateUpdateManifest(manifestGenerator, missingRedisJobRelease, dedicatedPlan, defaultRequestParameters, &oldManifest)
 
 			Expect(generateErr).To(HaveOccurred())
-			Expect(generateErr).To(MatchError("no release provided for job redis-server"))
+			Expect(generateErr).To(matchOperatorError("error gathering redis server job: no release provided for job redis-server, releases provide: some-release-name (health-check, cleanup-data)"))
 		})
 
 		It("returns an error when the cleanup data job is missing from the service releases", func() {
@@ -729,19 +2833,11 @@ var _ = Describe("Redis Service Adapter", func() {
 
 			oldManifest := createDefaultOldManifest()
 
-			_, generateErr := generateManifest(
-				manifestGenerator,
-				missingCleanupDataJobRelease,
-				dedicatedPlan,
-				defaultRequestParameters,
-				&oldManifest,
-				nil,
-				nil,
-			)
+			_, generateErr := generateUpdateManifest(manifestGenerator, missingCleanupDataJobRelease, dedicatedPlan, defaultRequestParameters, &oldManifest)
 
 			Expect(generateErr).To(HaveOccurred())
-			Expect(generateErr).To(MatchError(fmt.Sprintf(
-				"no release provided for job %s",
+			Expect(generateErr).To(matchOperatorError(fmt.Sprintf(
+				"no release provided for job %s, releases provide: some-release-name (redis-server, health-check)",
 				adapter.CleanupDataErrandName,
 			)))
 		})
@@ -755,17 +2851,129 @@ var _ = Describe("Redis Service Adapter", func() {
 
 			oldManifest := createDefaultEmptyManifest()
 
-			_, generateErr := generateManifest(
-				manifestGenerator,
-				multipleServiceReleases,
-				dedicatedPlan,
-				defaultRequestParameters,
-				&oldManifest,
-				nil,
-				nil,
-			)
+			_, generateErr := generateUpdateManifest(manifestGenerator, multipleServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
+
+			Expect(generateErr).To(matchOperatorError(fmt.Sprintf("error gathering redis server job: job %s defined in multiple releases: some-release-name, some-other-release", ProvidedRedisServerInstanceGroupName)))
+		})
+
+		Context("when the redis-server job is provided by more than one release", func() {
+			BeforeEach(func() {
+				defaultServiceReleases = append(defaultServiceReleases, serviceadapter.ServiceRelease{
+					Name:    "redis-edge",
+					Version: "5",
+					Jobs:    []string{adapter.RedisJobName},
+				})
+			})
+
+			It("uses the release pinned in the plan", func() {
+				dedicatedPlan.Properties[adapter.RedisReleaseNamePropertyKey] = "redis-edge"
+
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.InstanceGroups[0].Jobs[0].Release).To(Equal("redis-edge"))
+			})
+
+			It("returns an error when the pinned release does not provide the job", func() {
+				dedicatedPlan.Properties[adapter.RedisReleaseNamePropertyKey] = "redis-missing"
+
+				_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+
+				Expect(generateErr).To(matchOperatorError("error gathering redis server job: pinned release redis-missing does not provide job redis-server"))
+			})
+
+			It("returns an error when no release is pinned", func() {
+				_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+
+				Expect(generateErr).To(matchOperatorError("error gathering redis server job: job redis-server defined in multiple releases: some-release-name, redis-edge"))
+			})
+		})
+
+		Context("when the release calls the redis job something else", func() {
+			BeforeEach(func() {
+				defaultServiceReleases[0].Jobs = []string{"redis", adapter.HealthCheckErrandName, adapter.CleanupDataErrandName}
+				dedicatedPlan.Properties[adapter.RedisJobNamePropertyKey] = "redis"
+			})
+
+			It("uses the configured job name and keeps the instance group name", func() {
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.InstanceGroups[0].Name).To(Equal("redis-server"))
+				Expect(generated.Manifest.InstanceGroups[0].Jobs[0].Name).To(Equal("redis"))
+				Expect(generated.Manifest.InstanceGroups[0].Jobs[0].Release).To(Equal("some-release-name"))
+				Expect(generated.Manifest.InstanceGroups[0].Properties).To(HaveKey("redis"))
+			})
+
+			It("checks the upgrade path against the release providing the configured job", func() {
+				oldManifest := createDefaultOldManifest()
+				oldManifest.Releases[0].Version = "5"
+
+				_, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
+
+				Expect(generateErr).To(matchOperatorError("error generating manifest: new release versions are lower than existing release versions: some-release-name (existing 5, new 4)"))
+			})
+
+			It("rejects a co-located job with the configured name", func() {
+				dedicatedPlan.Properties[adapter.CoLocateJobsPropertyKey] = []interface{}{
+					map[string]interface{}{"name": "redis", "release": "some-release-name"},
+				}
+				_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+
+				Expect(generateErr).To(matchOperatorError("co-located job redis duplicates the primary job"))
+			})
+
+			It("lists the jobs each release provides when the configured job is missing", func() {
+				dedicatedPlan.Properties[adapter.RedisJobNamePropertyKey] = "redis-community"
+				_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+
+				Expect(generateErr).To(matchOperatorError("error gathering redis server job: no release provided for job redis-community, releases provide: some-release-name (redis, health-check, cleanup-data)"))
+			})
+		})
+
+		Context("when the plan scopes the redis properties to the job", func() {
+			BeforeEach(func() {
+				dedicatedPlan.Properties[adapter.PropertyScopePropertyKey] = adapter.PropertyScopeJob
+			})
+
+			It("writes the redis properties on the redis-server job", func() {
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+
+				Expect(generateErr).NotTo(HaveOccurred())
+				redisInstanceGroup := generated.Manifest.InstanceGroups[0]
+				Expect(redisInstanceGroup.Properties).NotTo(HaveKey("redis"))
+				Expect(redisInstanceGroup.Jobs[0].Name).To(Equal("redis-server"))
+				Expect(redisInstanceGroup.Jobs[0].Properties["redis"]).To(HaveKeyWithValue("persistence", "yes"))
+			})
+
+			It("reads the previous redis properties from the instance group", func() {
+				oldManifest := createDefaultOldManifest()
+
+				generated, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
+
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.InstanceGroups[0].Jobs[0].Properties["redis"]).To(HaveKeyWithValue("password", "some-password"))
+			})
+
+			It("reads the previous redis properties from the job when going back to the instance group", func() {
+				oldManifest := createDefaultOldManifest()
+				oldManifest.InstanceGroups[0].Jobs = []bosh.Job{{Name: "redis-server", Properties: oldManifest.InstanceGroups[0].Properties}}
+				oldManifest.InstanceGroups[0].Properties = nil
+				dedicatedPlan.Properties[adapter.PropertyScopePropertyKey] = adapter.PropertyScopeInstanceGroup
+
+				generated, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
+
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.InstanceGroups[0].Jobs[0].Properties).NotTo(HaveKey("redis"))
+				Expect(generated.Manifest.InstanceGroups[0].Properties["redis"]).To(HaveKeyWithValue("password", "some-password"))
+			})
 
-			Expect(generateErr).To(MatchError(fmt.Sprintf("job %s defined in multiple releases: some-release-name, some-other-release", ProvidedRedisServerInstanceGroupName)))
+			It("returns an error for an unknown scope", func() {
+				dedicatedPlan.Properties[adapter.PropertyScopePropertyKey] = "deployment"
+				_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+
+				Expect(generateErr).To(matchOperatorError("invalid value for plan property 'property_scope': deployment, must be job or instance_group"))
+			})
 		})
 
 		It("returns an error with a message for the cli user when a plan does not have an instance group named redis-server", func() {
@@ -775,36 +2983,164 @@ var _ = Describe("Redis Service Adapter", func() {
 
 			oldManifest := createDefaultOldManifest()
 
-			_, generateErr := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				planWithoutExpectedInstanceGroupName,
-				defaultRequestParameters,
-				&oldManifest,
-				nil,
-				nil,
-			)
+			_, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, planWithoutExpectedInstanceGroupName, defaultRequestParameters, &oldManifest)
+
+			Expect(generateErr).To(HaveOccurred())
+			Expect(generateErr).To(MatchError(adapter.ContactOperatorMessage))
+			Expect(stderr).To(gbytes.Say("- no redis-server instance group definition found"))
+			Expect(string(stderr.Contents())).NotTo(ContainSubstring("plan defines no instance groups"))
+		})
+
+		It("returns a distinct error when the plan has no instance groups at all", func() {
+			emptyPlan := serviceadapter.Plan{Properties: dedicatedPlan.Properties}
+
+			_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, emptyPlan)
+
+			Expect(generateErr).To(MatchError(adapter.ContactOperatorMessage))
+			Expect(stderr).To(gbytes.Say("plan defines no instance groups"))
+			Expect(string(stderr.Contents())).NotTo(ContainSubstring("instance group definition found"))
+		})
+
+		Describe("availability zones", func() {
+			generateAZs := func() ([]string, error) {
+				generated, err := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				if err != nil {
+					return nil, err
+				}
+				return generated.Manifest.InstanceGroups[0].AZs, nil
+			}
+
+			It("passes a non-empty AZ list through unchanged", func() {
+				Expect(generateAZs()).To(Equal([]string{"dedicated-az1", "dedicated-az2"}))
+			})
+
+			It("passes an empty AZ list through to spread across all AZs", func() {
+				dedicatedPlan.InstanceGroups[0].AZs = []string{}
+				azs, err := generateAZs()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(azs).NotTo(BeNil())
+				Expect(azs).To(BeEmpty())
+			})
+
+			It("returns an error when the AZ list is missing", func() {
+				dedicatedPlan.InstanceGroups[0].AZs = nil
+				_, err := generateAZs()
+				Expect(err).To(matchOperatorError("the redis-server instance group does not specify azs, use an empty list to spread instances across all availability zones"))
+			})
+
+			It("is never given an empty AZ list by the SDK, which rejects such plans before generating", func() {
+				Expect(dedicatedPlan.Validate()).To(Succeed())
+				dedicatedPlan.InstanceGroups[0].AZs = []string{}
+				Expect(dedicatedPlan.Validate()).To(MatchError(ContainSubstring("AZs")))
+			})
+		})
+
+		Describe("networks", func() {
+			generateNetworks := func() ([]bosh.Network, error) {
+				generated, err := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				if err != nil {
+					return nil, err
+				}
+				return generated.Manifest.InstanceGroups[0].Networks, nil
+			}
+
+			It("uses the networks from the plan", func() {
+				manifestGenerator.DefaultNetworkName = "default-network"
+				Expect(generateNetworks()).To(Equal([]bosh.Network{{Name: "dedicated-network"}}))
+			})
+
+			It("falls back to the default network when the plan has no networks", func() {
+				manifestGenerator.DefaultNetworkName = "default-network"
+				dedicatedPlan.InstanceGroups[0].Networks = nil
+				Expect(generateNetworks()).To(Equal([]bosh.Network{{Name: "default-network"}}))
+			})
+
+			It("returns an error when neither the plan nor the generator specifies a network", func() {
+				dedicatedPlan.InstanceGroups[0].Networks = nil
+				_, err := generateNetworks()
+				Expect(err).To(matchOperatorError("no network specified for the redis-server instance group and no default network is configured"))
+			})
+		})
+
+		It("returns an error when persistence is enabled but the plan does not specify a persistent disk type", func() {
+			dedicatedPlan.InstanceGroups[0].PersistentDiskType = ""
+
+			_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+			Expect(generateErr).To(matchOperatorError("a persistent disk type must be specified for the redis-server instance group when persistence is enabled"))
+		})
+
+		It("logs a warning when persistence is disabled but the plan specifies a persistent disk type", func() {
+			_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, highMemoryPlan)
+			Expect(generateErr).NotTo(HaveOccurred())
+			Expect(stderr).To(gbytes.Say("persistent disk type high-memory-disk is set for the redis-server instance group but persistence is disabled"))
+		})
+
+		It("logs and returns an error when a plan defines two instance groups named redis-server", func() {
+			dedicatedPlan.InstanceGroups = append(dedicatedPlan.InstanceGroups, dedicatedPlan.InstanceGroups[0])
+
+			_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+
+			Expect(generateErr).To(MatchError(adapter.ContactOperatorMessage))
+			Expect(stderr).To(gbytes.Say("deployment some-instance-id: plan defines 2 instance groups named redis-server"))
+		})
 
+		It("logs and returns an error when a plan does not define a required property", func() {
+			oldManifest := createDefaultOldManifest()
+
+			_, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, planWithPropertyRemoved(dedicatedPlan, "persistence"), defaultRequestParameters, &oldManifest)
 			Expect(generateErr).To(HaveOccurred())
-			Expect(generateErr).To(MatchError(ContainSubstring("Contact your operator, service configuration issue occurred")))
-			Expect(stderr).To(gbytes.Say("no redis-server instance group definition found"))
+			Expect(generateErr).To(MatchError(adapter.ContactOperatorMessage))
+			Expect(stderr).To(gbytes.Say("deployment some-instance-id: the plan property 'persistence' is missing"))
+		})
+
+		DescribeTable("accepts boolean and string values for the persistence plan property",
+			func(persistence interface{}, expected string) {
+				dedicatedPlan.Properties["persistence"] = persistence
+
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["persistence"]).To(Equal(expected))
+			},
+			Entry("true", true, "yes"),
+			Entry("false", false, "no"),
+			Entry(`"true"`, "true", "yes"),
+			Entry(`"False"`, "False", "no"),
+			Entry(`"YES"`, "YES", "yes"),
+			Entry(`"no"`, "no", "no"),
+		)
+
+		It("logs and returns an error when the persistence plan property has an unsupported value", func() {
+			dedicatedPlan.Properties["persistence"] = 1.0
+
+			_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+			Expect(generateErr).To(matchAdapterError(adapter.ContactOperatorMessage, ContainSubstring("deployment some-instance-id: invalid value for plan property 'persistence': 1 (float64)")))
+			Expect(stderr).To(gbytes.Say(`deployment some-instance-id: invalid value for plan property 'persistence': 1 \(float64\)`))
 		})
 
-		It("logs and returns an error when a plan does not define a required property", func() {
-			oldManifest := createDefaultOldManifest()
+		Context("when the persistence property key is configured", func() {
+			BeforeEach(func() {
+				manifestGenerator.Config.PersistencePropertyKey = "enable_persistence"
+				delete(dedicatedPlan.Properties, "persistence")
+				dedicatedPlan.Properties["enable_persistence"] = false
+			})
 
-			_, generateErr := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				planWithPropertyRemoved(dedicatedPlan, "persistence"),
-				defaultRequestParameters,
-				&oldManifest,
-				nil,
-				nil,
-			)
-			Expect(generateErr).To(HaveOccurred())
-			Expect(generateErr).To(MatchError(""))
-			Expect(stderr).To(gbytes.Say("the plan property 'persistence' is missing"))
+			It("reads persistence from the alternate key", func() {
+				generated, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+				Expect(generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["persistence"]).To(Equal("no"))
+			})
+
+			It("names the alternate key when it is missing", func() {
+				delete(dedicatedPlan.Properties, "enable_persistence")
+				_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).To(matchOperatorError("the plan property 'enable_persistence' is missing"))
+			})
+
+			It("accepts the alternate key in strict mode", func() {
+				dedicatedPlan.Properties[adapter.StrictPropertiesKey] = true
+				_, generateErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(generateErr).NotTo(HaveOccurred())
+			})
 		})
 
 		It("returns an error when the new release version (of the release that provides redis-server) cannot be parsed", func() {
@@ -812,63 +3148,31 @@ var _ = Describe("Redis Service Adapter", func() {
 
 			oldManifest := createDefaultOldManifest()
 
-			_, generateErr := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				dedicatedPlan,
-				defaultRequestParameters,
-				&oldManifest,
-				nil,
-				nil,
-			)
-			Expect(generateErr).To(MatchError("oi is not a valid BOSH release version"))
+			_, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
+			Expect(generateErr).To(matchOperatorError("oi is not a valid BOSH release version"))
 		})
 
 		It("returns an error when the old release version (of the release that provides redis-server) cannot be parsed", func() {
 			oldManifest := createDefaultOldManifest()
 			oldManifest.Releases[0].Version = "oi"
 
-			_, generateErr := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				dedicatedPlan,
-				defaultRequestParameters,
-				&oldManifest,
-				nil,
-				nil,
-			)
-			Expect(generateErr).To(MatchError("oi is not a valid BOSH release version"))
+			_, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
+			Expect(generateErr).To(matchOperatorError("oi is not a valid BOSH release version"))
 		})
 
 		It("returns an error when the old manifest does not contain any releases with the same name as the configured release that provides redis-server job", func() {
 			oldManifest := createDefaultOldManifest()
 			oldManifest.Releases[0].Name = "i-dont-exist-in-newer-config"
 
-			_, generateErr := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				dedicatedPlan,
-				defaultRequestParameters,
-				&oldManifest,
-				nil,
-				nil,
-			)
-			Expect(generateErr).To(MatchError("no release with name some-release-name found in previous manifest"))
+			_, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
+			Expect(generateErr).To(matchOperatorError("no release with name some-release-name found in previous manifest"))
 		})
 
 		It("generates the expected manifest when the old manifest is valid", func() {
 			oldManifest := createDefaultOldManifest()
 			oldManifest.Releases[0].Version = "1"
 
-			generated, _ := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				dedicatedPlan,
-				defaultRequestParameters,
-				&oldManifest,
-				nil,
-				nil,
-			)
+			generated, _ := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
 
 			var expectedManifest bosh.BoshManifest
 			expectedManifestRaw, _ := ioutil.ReadFile(getFixturePath("dedicated-plan-updated-manifest.yml"))
@@ -876,22 +3180,14 @@ var _ = Describe("Redis Service Adapter", func() {
 			Expect(err).NotTo(HaveOccurred(), "Generated manifest not marshaled to yaml")
 
 			removePlanSecret(generated.Manifest)
-			Expect(generated.Manifest).To(Equal(expectedManifest))
+			Expect(reloadManifest(generated.Manifest)).To(Equal(reloadManifest(expectedManifest)))
 		})
 
 		It("generates the expected manifest when the old manifest is valid and ignores appended commit hash", func() {
 			oldManifest := createDefaultOldManifest()
 			oldManifest.Releases[0].Version = "0.1+dev.8-fa37909"
 
-			generated, _ := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				dedicatedPlan,
-				defaultRequestParameters,
-				&oldManifest,
-				nil,
-				nil,
-			)
+			generated, _ := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
 
 			var expectedManifest bosh.BoshManifest
 			expectedManifestRaw, _ := ioutil.ReadFile(getFixturePath("dedicated-plan-updated-manifest.yml"))
@@ -899,26 +3195,18 @@ var _ = Describe("Redis Service Adapter", func() {
 			Expect(err).NotTo(HaveOccurred(), "Generated manifest not marshaled to yaml")
 
 			removePlanSecret(generated.Manifest)
-			Expect(generated.Manifest).To(Equal(expectedManifest))
+			Expect(reloadManifest(generated.Manifest)).To(Equal(reloadManifest(expectedManifest)))
 		})
 
 		It("generates the expected manifest when arbitrary parameters are present that clash with values in the valid old manifest", func() {
 			oldManifest := createDefaultOldManifest()
 			oldManifest.Releases[0].Version = "1"
 
-			generated, _ := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				dedicatedPlan,
-				map[string]interface{}{
-					"parameters": map[string]interface{}{
-						"maxclients": 56.0, // From JSON. No integers.
-					},
+			generated, _ := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, map[string]interface{}{
+				"parameters": map[string]interface{}{
+					"maxclients": 56.0, // From JSON. No integers.
 				},
-				&oldManifest,
-				nil,
-				nil,
-			)
+			}, &oldManifest)
 
 			var expectedManifest bosh.BoshManifest
 			expectedManifestRaw, _ := ioutil.ReadFile(getFixturePath("dedicated-plan-updated-manifest-arbitrary-params.yml"))
@@ -926,7 +3214,7 @@ var _ = Describe("Redis Service Adapter", func() {
 			Expect(err).NotTo(HaveOccurred(), "Generated manifest not marshaled to yaml")
 
 			removePlanSecret(generated.Manifest)
-			Expect(generated.Manifest).To(Equal(expectedManifest))
+			Expect(reloadManifest(generated.Manifest)).To(Equal(reloadManifest(expectedManifest)))
 		})
 
 		It("generates the expected manifest when an instance group has been migrated", func() {
@@ -940,15 +3228,7 @@ var _ = Describe("Redis Service Adapter", func() {
 				{Name: "redis-server"},
 			}
 
-			generatedManifest, generatedErr := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				updatedDedicatedPlan,
-				map[string]interface{}{},
-				&oldManifest,
-				nil,
-				nil,
-			)
+			generatedManifest, generatedErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, updatedDedicatedPlan, map[string]interface{}{}, &oldManifest)
 
 			Expect(generatedErr).ToNot(HaveOccurred())
 			Expect(generatedManifest.Manifest.InstanceGroups[0].Name).To(Equal("redis"))
@@ -966,74 +3246,587 @@ var _ = Describe("Redis Service Adapter", func() {
 				{Name: "redis-server"},
 			}
 
-			_, generatedErr := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				updatedDedicatedPlan,
-				map[string]interface{}{},
-				&oldManifest,
-				nil,
-				nil,
-			)
+			_, generatedErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, updatedDedicatedPlan, map[string]interface{}{}, &oldManifest)
+
+			Expect(generatedErr).To(HaveOccurred())
+			Expect(generatedErr).To(MatchError(adapter.ContactOperatorMessage))
+			Expect(stderr).To(gbytes.Say("deployment some-instance-id: no foo instance group definition found"))
+		})
+
+		It("returns an error when the redis server job does not have a release", func() {
+			serviceReleaseWithMissingJobName := defaultServiceReleases
+			serviceReleaseWithMissingJobName[0].Jobs = []string{"overrides-redis-server", "health-check", "cleanup-data"}
+
+			_, generatedErr := generateCreateManifest(manifestGenerator, serviceReleaseWithMissingJobName, dedicatedPlan)
+			Expect(generatedErr).To(matchOperatorError("error gathering redis server job: no release provided for job redis-server, releases provide: some-release-name (overrides-redis-server, health-check, cleanup-data)"))
+		})
+
+		It("sets the expected update block when the plan update block is empty and old manifest does not exist", func() {
+			planWithoutUpdateBlock := dedicatedPlan
+			planWithoutUpdateBlock.Update = nil
+
+			generatedManifest, generatedErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, planWithoutUpdateBlock)
+
+			Expect(generatedErr).ToNot(HaveOccurred())
+			Expect(generatedManifest.Manifest.Update.MaxInFlight).To(Equal(4))
+			Expect(generatedManifest.Manifest.Update.Canaries).To(Equal(4))
+			Expect(generatedManifest.Manifest.Update.VmStrategy).To(Equal("delete-create"))
+		})
+
+		DescribeTable("rejects plan update watch times that are not a min-max range",
+			func(canaryWatchTime, updateWatchTime, expectedDetail string) {
+				planWithBadUpdate := dedicatedPlan
+				planWithBadUpdate.Update = &serviceadapter.Update{
+					Canaries:        1,
+					CanaryWatchTime: canaryWatchTime,
+					UpdateWatchTime: updateWatchTime,
+					MaxInFlight:     5,
+				}
+
+				_, generatedErr := generateCreateManifest(manifestGenerator, defaultServiceReleases, planWithBadUpdate)
+				Expect(generatedErr).To(matchOperatorError(expectedDetail))
+			},
+			Entry("single value canary_watch_time", "30000", "100-200",
+				`invalid value for plan update 'canary_watch_time': "30000", must be a min-max range in milliseconds such as 30000-240000`),
+			Entry("empty canary_watch_time", "", "100-200",
+				`invalid value for plan update 'canary_watch_time': "", must be a min-max range in milliseconds such as 30000-240000`),
+			Entry("update_watch_time with units", "100-200", "30s-240s",
+				`invalid value for plan update 'update_watch_time': "30s-240s", must be a min-max range in milliseconds such as 30000-240000`),
+		)
+
+		Describe("upgrade strategy", func() {
+			generateUpdateBlock := func() (*bosh.Update, error) {
+				generated, err := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				return generated.Manifest.Update, err
+			}
+
+			It("updates every instance at once for the rolling strategy", func() {
+				dedicatedPlan.Properties[adapter.UpgradeStrategyPropertyKey] = adapter.UpgradeStrategyRolling
+				update, err := generateUpdateBlock()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(update.Canaries).To(Equal(0))
+				Expect(update.MaxInFlight).To(Equal("100%"))
+			})
+
+			It("keeps the plan update block for the canary strategy", func() {
+				dedicatedPlan.Properties[adapter.UpgradeStrategyPropertyKey] = adapter.UpgradeStrategyCanary
+				update, err := generateUpdateBlock()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(update.Canaries).To(Equal(1))
+				Expect(update.MaxInFlight).To(Equal(5))
+			})
+
+			It("updates serially one instance at a time for the one-at-a-time strategy", func() {
+				dedicatedPlan.Properties[adapter.UpgradeStrategyPropertyKey] = adapter.UpgradeStrategyOneAtATime
+				update, err := generateUpdateBlock()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(update.Canaries).To(Equal(1))
+				Expect(update.MaxInFlight).To(Equal(1))
+				Expect(*update.Serial).To(BeTrue())
+			})
+
+			It("returns an error for an unknown strategy", func() {
+				dedicatedPlan.Properties[adapter.UpgradeStrategyPropertyKey] = "blue-green"
+				_, err := generateUpdateBlock()
+				Expect(err).To(matchOperatorError("invalid value for plan property 'upgrade_strategy': blue-green, must be one of rolling, canary, one-at-a-time"))
+			})
+		})
+
+		It("sets the secret property using the old manifest value when credhub_secret_path not present in arbitrary parameters", func() {
+			oldManifest := createDefaultOldManifest()
+			oldManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["secret"] = "/some/special/path"
+			emptyArbitraryParams := map[string]interface{}{}
+
+			generatedManifest, generatedErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, emptyArbitraryParams, &oldManifest)
+
+			Expect(generatedErr).ToNot(HaveOccurred())
+			Expect(generatedManifest.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["secret"]).To(Equal("/some/special/path"))
+		})
+
+		Describe("log format", func() {
+			const secretValue = "some-secret-value"
+
+			var (
+				previousSecrets serviceadapter.ManifestSecrets
+				generatedErr    error
+			)
+
+			generateWithSecretInError := func() {
+				dedicatedPlan.Properties[adapter.UpgradeStrategyPropertyKey] = secretValue
+				_, generatedErr = generateManifest(
+					manifestGenerator,
+					defaultServiceReleases,
+					dedicatedPlan,
+					map[string]interface{}{},
+					nil,
+					nil,
+					previousSecrets,
+				)
+			}
+
+			logEvents := func() []map[string]interface{} {
+				var events []map[string]interface{}
+				for _, line := range strings.Split(strings.TrimSpace(string(stderr.Contents())), "\n") {
+					event := map[string]interface{}{}
+					Expect(json.Unmarshal([]byte(line), &event)).To(Succeed(), line)
+					events = append(events, event)
+				}
+				return events
+			}
+
+			BeforeEach(func() {
+				previousSecrets = serviceadapter.ManifestSecrets{"((some_secret))": secretValue}
+			})
+
+			It("logs plain lines by default", func() {
+				generateWithSecretInError()
+				Expect(generatedErr).To(HaveOccurred())
+				Expect(stderr).To(gbytes.Say("Non Cloud Foundry platform"))
+				Expect(string(stderr.Contents())).NotTo(ContainSubstring("{"))
+			})
+
+			It("logs one JSON object per event when the json format is configured", func() {
+				manifestGenerator.LogFormat = adapter.LogFormatJSON
+				generateWithSecretInError()
+				Expect(generatedErr).To(HaveOccurred())
+
+				events := logEvents()
+				Expect(events).To(HaveLen(3))
+				Expect(events[0]).To(And(
+					HaveKeyWithValue("level", adapter.LogLevelInfo),
+					HaveKeyWithValue("msg", "Non Cloud Foundry platform (or pre OSBAPI 2.13) detected"),
+					HaveKeyWithValue("deployment", "some-instance-id"),
+					HaveKeyWithValue("operation", "generate-manifest"),
+				))
+				Expect(events[1]).To(And(
+					HaveKeyWithValue("level", adapter.LogLevelInfo),
+					HaveKeyWithValue("msg", "generating manifest, operation type: create"),
+				))
+				Expect(events[2]).To(And(
+					HaveKeyWithValue("level", adapter.LogLevelError),
+					HaveKeyWithValue("msg", HavePrefix("deployment some-instance-id: invalid value for plan property 'upgrade_strategy'")),
+				))
+				Expect(events[2]["timestamp"]).To(WithTransform(func(timestamp interface{}) error {
+					_, err := time.Parse(time.RFC3339Nano, timestamp.(string))
+					return err
+				}, Succeed()))
+			})
+
+			It("selects the json format from the environment", func() {
+				os.Setenv(adapter.LogFormatEnvVar, adapter.LogFormatJSON)
+				defer os.Unsetenv(adapter.LogFormatEnvVar)
+
+				generateWithSecretInError()
+				Expect(logEvents()).To(HaveLen(3))
+			})
+
+			DescribeTable("redacts secrets",
+				func(format string) {
+					manifestGenerator.LogFormat = format
+					generateWithSecretInError()
+					Expect(generatedErr).To(HaveOccurred())
+					Expect(string(stderr.Contents())).To(ContainSubstring(adapter.RedactedValue))
+					Expect(string(stderr.Contents())).NotTo(ContainSubstring(secretValue))
+				},
+				Entry("in the plain format", adapter.LogFormatPlain),
+				Entry("in the json format", adapter.LogFormatJSON),
+			)
+
+			It("redacts the password of the previous manifest from errors", func() {
+				oldManifest := createDefaultOldManifest()
+				dedicatedPlan.Properties[adapter.UpgradeStrategyPropertyKey] = "some-password"
+
+				_, err := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, map[string]interface{}{}, &oldManifest)
+
+				Expect(err).To(HaveOccurred())
+				Expect(stderr).To(gbytes.Say("invalid value for plan property 'upgrade_strategy': \\*\\*\\*"))
+				Expect(string(stderr.Contents())).NotTo(ContainSubstring("some-password"))
+			})
+
+			DescribeTable("redacts secret-keyed values quoted in errors",
+				func(value, redacted string) {
+					dedicatedPlan.Properties[adapter.UpgradeStrategyPropertyKey] = value
+					_, err := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+					Expect(err).To(HaveOccurred())
+					Expect(string(stderr.Contents())).To(ContainSubstring(redacted))
+					Expect(string(stderr.Contents())).NotTo(ContainSubstring("hunter2"))
+				},
+				Entry("a password assignment", "password=hunter2", "password=***"),
+				Entry("a quoted secret", "client_secret: 'hunter2'", "client_secret: '***'"),
+				Entry("a token", "auth_token:hunter2,", "auth_token:***,"),
+			)
+		})
+
+		Describe("operation classification", func() {
+			var (
+				previousManifest bosh.BoshManifest
+				cfContext        map[string]interface{}
+			)
+
+			BeforeEach(func() {
+				previousManifest = createDefaultOldManifest()
+				cfContext = map[string]interface{}{"platform": "cloudfoundry"}
+			})
+
+			DescribeTable("logs the classified operation",
+				func(withPreviousManifest bool, requestParams map[string]interface{}, planChange bool, expectedOperation adapter.Operation) {
+					var oldManifest *bosh.BoshManifest
+					if withPreviousManifest {
+						oldManifest = &previousManifest
+					}
+					oldPlan := dedicatedPlan
+					if planChange {
+						oldPlan.Properties = serviceadapter.Properties{adapter.PlanNamePropertyKey: "previous-plan"}
+					}
+
+					_, err := generateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, requestParams, oldManifest, &oldPlan, nil)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(stderr).To(gbytes.Say("generating manifest, operation type: %s", expectedOperation))
+				},
+				Entry("without a previous manifest", false, map[string]interface{}{}, false, adapter.OperationCreate),
+				Entry("with arbitrary parameters", true, map[string]interface{}{"parameters": map[string]interface{}{"maxclients": 10}}, false, adapter.OperationUpdate),
+				Entry("with a request context", true, map[string]interface{}{"context": map[string]interface{}{"platform": "cloudfoundry"}}, false, adapter.OperationUpdate),
+				Entry("with a different previous plan", true, map[string]interface{}{}, true, adapter.OperationPlanChange),
+				Entry("with the same plan, no parameters and no context", true, map[string]interface{}{}, false, adapter.OperationUpgrade),
+			)
+
+			It("classifies an edited definition of the same plan as an upgrade, not a plan change", func() {
+				dedicatedPlan.Properties[adapter.PlanNamePropertyKey] = "dedicated"
+				oldPlan := dedicatedPlan
+				oldPlan.Properties = serviceadapter.Properties{"persistence": true, "maxclients": 100, adapter.PlanNamePropertyKey: "dedicated"}
+
+				_, err := generateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &previousManifest, &oldPlan, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stderr).To(gbytes.Say("generating manifest, operation type: upgrade"))
+			})
+
+			Context("on an upgrade", func() {
+				BeforeEach(func() {
+					dedicatedPlan.Properties[adapter.AllowedArbitraryParamsPropertyKey] = []interface{}{"maxclients"}
+					previousManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["notify-keyspace-events"] = "Ex"
+				})
+
+				It("preserves every previous redis property", func() {
+					generated, err := generateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, map[string]interface{}{}, &previousManifest, &dedicatedPlan, nil)
+					Expect(err).NotTo(HaveOccurred())
+
+					redisProperties := generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})
+					Expect(redisProperties).To(HaveKeyWithValue("notify-keyspace-events", "Ex"))
+					Expect(redisProperties).To(HaveKeyWithValue("maxclients", 47))
+					Expect(redisProperties).To(HaveKeyWithValue("persistence", "yes"))
+				})
+			})
+
+			Context("on an update", func() {
+				It("does not carry forward properties the adapter does not manage when the plan discards them", func() {
+					dedicatedPlan.Properties[adapter.DiscardUnmanagedPropertiesKey] = true
+					previousManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["notify-keyspace-events"] = "Ex"
+					requestParams := map[string]interface{}{"context": cfContext}
+
+					generated, err := generateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, requestParams, &previousManifest, &dedicatedPlan, nil)
+					Expect(err).NotTo(HaveOccurred())
+
+					redisProperties := generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})
+					Expect(redisProperties).NotTo(HaveKey("notify-keyspace-events"))
+				})
+
+				It("still rejects unsupported parameters", func() {
+					requestParams := map[string]interface{}{"context": cfContext, "parameters": map[string]interface{}{"foo": "bar"}}
+
+					_, err := generateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, requestParams, &previousManifest, &dedicatedPlan, nil)
+					Expect(err).To(MatchError(ContainSubstring("unsupported parameter(s) for this service plan: foo")))
+				})
+			})
+		})
+
+		Describe("operator-added redis properties", func() {
+			var (
+				previousManifest bosh.BoshManifest
+				requestParams    map[string]interface{}
+			)
+
+			BeforeEach(func() {
+				previousManifest = createDefaultOldManifest()
+				previousRedis := previousManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})
+				previousRedis["tcp-keepalive"] = 60
+				previousRedis[adapter.BindHostnameKey] = "redis.example.com"
+				previousRedis["bind"] = "::"
+				requestParams = map[string]interface{}{
+					"context":    map[string]interface{}{"platform": "cloudfoundry"},
+					"parameters": map[string]interface{}{"maxclients": 100},
+				}
+			})
+
+			generateUpdate := func() map[interface{}]interface{} {
+				generated, err := generateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, requestParams, &previousManifest, &dedicatedPlan, nil)
+				Expect(err).NotTo(HaveOccurred())
+				return generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})
+			}
+
+			It("keeps the properties the adapter does not manage", func() {
+				redisProperties := generateUpdate()
+				Expect(redisProperties).To(HaveKeyWithValue("tcp-keepalive", 60))
+				Expect(redisProperties).To(HaveKeyWithValue(adapter.BindHostnameKey, "redis.example.com"))
+			})
+
+			It("overlays the adapter-managed properties and request parameters", func() {
+				redisProperties := generateUpdate()
+				Expect(redisProperties).To(HaveKeyWithValue("maxclients", 100))
+				Expect(redisProperties).NotTo(HaveKey("bind"))
+			})
+
+			It("drops them when the plan sets discard_unmanaged_properties", func() {
+				dedicatedPlan.Properties[adapter.DiscardUnmanagedPropertiesKey] = true
+				redisProperties := generateUpdate()
+				Expect(redisProperties).NotTo(HaveKey("tcp-keepalive"))
+				Expect(redisProperties).NotTo(HaveKey(adapter.BindHostnameKey))
+				Expect(redisProperties).To(HaveKeyWithValue("maxclients", 100))
+			})
+
+			It("drops them on an upgrade when the plan sets discard_unmanaged_properties", func() {
+				dedicatedPlan.Properties[adapter.DiscardUnmanagedPropertiesKey] = true
+				generated, err := generateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &previousManifest, &dedicatedPlan, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stderr).To(gbytes.Say("operation type: upgrade"))
+
+				redisProperties := generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})
+				Expect(redisProperties).NotTo(HaveKey("tcp-keepalive"))
+				Expect(redisProperties).NotTo(HaveKey(adapter.BindHostnameKey))
+				Expect(redisProperties).NotTo(HaveKey("bind"))
+			})
+
+			It("keeps them when the plan only sets strict_properties", func() {
+				dedicatedPlan.Properties[adapter.StrictPropertiesKey] = true
+				redisProperties := generateUpdate()
+				Expect(redisProperties).To(HaveKeyWithValue("tcp-keepalive", 60))
+				Expect(redisProperties).To(HaveKeyWithValue(adapter.BindHostnameKey, "redis.example.com"))
+			})
+
+			It("returns an error when discard_unmanaged_properties is not a boolean", func() {
+				dedicatedPlan.Properties[adapter.DiscardUnmanagedPropertiesKey] = "yes"
+				_, err := generateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, requestParams, &previousManifest, &dedicatedPlan, nil)
+				Expect(err).To(matchOperatorError("invalid value for plan property 'discard_unmanaged_properties': yes, must be a boolean"))
+			})
+		})
+
+		Describe("regenerating from an unchanged deployment", func() {
+			roundTrip := func(plan serviceadapter.Plan, requestParams map[string]interface{}, existing *bosh.BoshManifest) ([]byte, []byte) {
+				first := existing
+				if first == nil {
+					created, err := generateManifest(manifestGenerator, defaultServiceReleases, plan, requestParams, nil, nil, nil)
+					Expect(err).NotTo(HaveOccurred())
+					first = &created.Manifest
+				}
+				firstYAML, err := yaml.Marshal(first)
+				Expect(err).NotTo(HaveOccurred())
+
+				var previousManifest bosh.BoshManifest
+				Expect(yaml.Unmarshal(firstYAML, &previousManifest)).To(Succeed())
+
+				second, err := generateManifest(manifestGenerator, defaultServiceReleases, plan, requestParams, &previousManifest, &plan, nil)
+				Expect(err).NotTo(HaveOccurred())
+				secondYAML, err := yaml.Marshal(second.Manifest)
+				Expect(err).NotTo(HaveOccurred())
+				return firstYAML, secondYAML
+			}
+
+			It("reproduces the previous manifest byte for byte", func() {
+				firstYAML, secondYAML := roundTrip(dedicatedPlan, defaultRequestParameters, nil)
+				Expect(string(secondYAML)).To(Equal(string(firstYAML)))
+			})
+
+			It("logs that the regenerated manifest does not differ", func() {
+				roundTrip(dedicatedPlan, defaultRequestParameters, nil)
+				Expect(stderr).To(gbytes.Say("the generated manifest does not differ from the previous one"))
+			})
+
+			It("does not log it when the manifest changes", func() {
+				oldManifest := createDefaultOldManifest()
+				_, err := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stderr).NotTo(gbytes.Say("the generated manifest does not differ"))
+			})
+
+			It("reproduces it when arbitrary parameters were set", func() {
+				requestParams := map[string]interface{}{
+					"parameters": map[string]interface{}{
+						"maxclients":             100.0,
+						adapter.MaxMemoryKey:     "512mb",
+						adapter.HzKey:            50.0,
+						"lazyfree-lazy-eviction": true,
+						adapter.EncodingLimitsKey: map[string]interface{}{
+							"hash-max-listpack-entries": 256.0,
+						},
+					},
+				}
+				firstYAML, secondYAML := roundTrip(dedicatedPlan, requestParams, nil)
+				Expect(string(secondYAML)).To(Equal(string(firstYAML)))
+			})
+
+			It("reproduces it when the plan relies on defaults and optional properties", func() {
+				dedicatedPlan.Update = nil
+				dedicatedPlan.Properties[adapter.TLSEnabledPropertyKey] = true
+				dedicatedPlan.Properties[adapter.IPv6EnabledPropertyKey] = true
+				dedicatedPlan.Properties[adapter.ShareablePropertyKey] = true
+				dedicatedPlan.Properties[adapter.DashboardDomainPropertyKey] = "redis.example.com"
+				dedicatedPlan.Properties[adapter.BindingTTLSecondsPropertyKey] = 3600
+				dedicatedPlan.Properties[adapter.PreStartScriptPropertyKey] = "#!/bin/bash\necho hello"
+
+				// Without a plan update block the first update deliberately
+				// rolls out one instance at a time, so compare from there.
+				oldManifest := createDefaultOldManifest()
+				updated, err := generateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest, &dedicatedPlan, nil)
+				Expect(err).NotTo(HaveOccurred())
+
+				firstYAML, secondYAML := roundTrip(dedicatedPlan, defaultRequestParameters, &updated.Manifest)
+				Expect(string(secondYAML)).To(Equal(string(firstYAML)))
+			})
+		})
+
+		Describe("password from the previous manifest", func() {
+			var oldManifest bosh.BoshManifest
+
+			BeforeEach(func() {
+				oldManifest = createDefaultOldManifest()
+			})
+
+			generatePassword := func(previousManifest *bosh.BoshManifest) (interface{}, error) {
+				generated, err := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, previousManifest)
+				if err != nil {
+					return nil, err
+				}
+				return generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["password"], nil
+			}
+
+			It("reuses a string password", func() {
+				Expect(generatePassword(&oldManifest)).To(Equal("some-password"))
+			})
+
+			It("passes a credhub reference through untouched", func() {
+				oldManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["password"] = "((redis_password))"
+				Expect(generatePassword(&oldManifest)).To(Equal("((redis_password))"))
+			})
+
+			It("generates a password when there is no previous manifest", func() {
+				Expect(generatePassword(nil)).To(Equal("((odb_secret:redis-password))"))
+				Expect(stderr).NotTo(gbytes.Say("no password found in the previous manifest"))
+			})
+
+			It("generates a password with a warning when the previous manifest has no password", func() {
+				delete(oldManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{}), "password")
+				Expect(generatePassword(&oldManifest)).To(Equal("((odb_secret:redis-password))"))
+				Expect(stderr).To(gbytes.Say("no password found in the previous manifest, generating a new one"))
+			})
+
+			It("returns a generated password as an ODB-managed secret", func() {
+				generated, err := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(generated.ODBManagedSecrets).To(HaveKeyWithValue(adapter.PasswordSecretName, "really random password"))
+			})
+
+			It("does not return the password again when the previous manifest already refers to it", func() {
+				oldManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["password"] = "((/odb/redis/some-instance-id/redis-password))"
+
+				generated, err := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(generated.ODBManagedSecrets).NotTo(HaveKey(adapter.PasswordSecretName))
+				redisProperties := generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})
+				Expect(redisProperties["password"]).To(Equal("((/odb/redis/some-instance-id/redis-password))"))
+			})
+
+			It("embeds a generated password literally when secure manifests are disabled", func() {
+				manifestGenerator.Config.SecureManifestsEnabled = false
+				generated, err := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(generated.ODBManagedSecrets).NotTo(HaveKey(adapter.PasswordSecretName))
+				redisProperties := generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})
+				Expect(redisProperties["password"]).To(Equal("really random password"))
+			})
 
-			Expect(generatedErr).To(HaveOccurred())
-			Expect(generatedErr).To(MatchError("Contact your operator, service configuration issue occurred"))
-			Expect(stderr).To(gbytes.Say("no foo instance group definition found"))
+			It("returns an error when the previous password is not a string", func() {
+				oldManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["password"] = map[interface{}]interface{}{"value": "secret"}
+				_, err := generatePassword(&oldManifest)
+				Expect(err).To(matchOperatorError("error reading the previous manifest: unexpected type map[interface {}]interface {} for the password"))
+			})
 		})
 
-		It("returns an error when the redis server job does not have a release", func() {
-			serviceReleaseWithMissingJobName := defaultServiceReleases
-			serviceReleaseWithMissingJobName[0].Jobs = []string{"overrides-redis-server", "health-check", "cleanup-data"}
+		Describe("reading redis properties from the previous manifest", func() {
+			const previousManifestJSON = `{
+				"name": "some-instance-id",
+				"releases": [{"name": "some-release-name", "version": "4"}],
+				"instance_groups": [
+					{"name": "health-check", "properties": {}},
+					{"name": "redis-server", "properties": {"redis": {"password": "some-password", "maxclients": 47}}}
+				]
+			}`
+
+			const previousManifestYAML = `
+name: some-instance-id
+releases:
+- name: some-release-name
+  version: "4"
+instance_groups:
+- name: health-check
+- name: redis-server
+  properties:
+    redis:
+      password: some-password
+      maxclients: 47
+`
+
+			generateFrom := func(previousManifest bosh.BoshManifest) (map[interface{}]interface{}, error) {
+				generated, err := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &previousManifest)
+				if err != nil {
+					return nil, err
+				}
+				return generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{}), nil
+			}
 
-			_, generatedErr := generateManifest(
-				manifestGenerator,
-				serviceReleaseWithMissingJobName,
-				dedicatedPlan,
-				map[string]interface{}{},
-				nil,
-				nil,
-				nil,
-			)
-			Expect(generatedErr).To(MatchError("error gathering redis server job: no release provided for job redis-server"))
-		})
+			It("finds the redis instance group by name in a JSON-decoded manifest", func() {
+				var previousManifest bosh.BoshManifest
+				Expect(json.Unmarshal([]byte(previousManifestJSON), &previousManifest)).To(Succeed())
 
-		It("sets the expected update block when the plan update block is empty and old manifest does not exist", func() {
-			planWithoutUpdateBlock := dedicatedPlan
-			planWithoutUpdateBlock.Update = nil
+				redisProperties, err := generateFrom(previousManifest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties["password"]).To(Equal("some-password"))
+				Expect(redisProperties["maxclients"]).To(Equal(47))
+			})
 
-			generatedManifest, generatedErr := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				planWithoutUpdateBlock,
-				map[string]interface{}{},
-				nil,
-				nil,
-				nil,
-			)
+			It("finds the redis instance group by name in a YAML-decoded manifest", func() {
+				var previousManifest bosh.BoshManifest
+				Expect(yaml.Unmarshal([]byte(previousManifestYAML), &previousManifest)).To(Succeed())
 
-			Expect(generatedErr).ToNot(HaveOccurred())
-			Expect(generatedManifest.Manifest.Update.MaxInFlight).To(Equal(4))
-			Expect(generatedManifest.Manifest.Update.Canaries).To(Equal(4))
-			Expect(generatedManifest.Manifest.Update.VmStrategy).To(Equal("delete-create"))
-		})
+				redisProperties, err := generateFrom(previousManifest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(redisProperties["password"]).To(Equal("some-password"))
+				Expect(redisProperties["maxclients"]).To(Equal(47))
+			})
 
-		It("sets the secret property using the old manifest value when credhub_secret_path not present in arbitrary parameters", func() {
-			oldManifest := createDefaultOldManifest()
-			oldManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["secret"] = "/some/special/path"
-			emptyArbitraryParams := map[string]interface{}{}
+			It("logs and returns an error when the previous manifest has no instance groups", func() {
+				previousManifest := createDefaultOldManifest()
+				previousManifest.InstanceGroups = nil
 
-			generatedManifest, generatedErr := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				dedicatedPlan,
-				emptyArbitraryParams,
-				&oldManifest,
-				nil,
-				nil,
-			)
+				_, err := generateFrom(previousManifest)
+				Expect(err).To(MatchError(adapter.ContactOperatorMessage))
+				Expect(stderr).To(gbytes.Say("deployment some-instance-id: error reading the previous manifest: no instance group with redis properties found in manifest"))
+			})
 
-			Expect(generatedErr).ToNot(HaveOccurred())
-			Expect(generatedManifest.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["secret"]).To(Equal("/some/special/path"))
+			It("redacts secrets when it logs the unreadable previous manifest", func() {
+				previousManifest := createDefaultOldManifest()
+				previousManifest.InstanceGroups[0].Properties = map[string]interface{}{
+					"syslog": map[interface{}]interface{}{"address": "logs.example.com", "client_secret": "syslog-secret"},
+					"backup": map[interface{}]interface{}{"destination": "s3://bucket?key=resolved-credhub-value"},
+				}
+				previousSecrets := serviceadapter.ManifestSecrets{"((/backup/key))": "resolved-credhub-value"}
+
+				_, err := generateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &previousManifest, nil, previousSecrets)
+				Expect(err).To(MatchError(adapter.ContactOperatorMessage))
+				Expect(stderr).To(gbytes.Say("could not read the redis properties from the previous manifest"))
+				Expect(stderr).To(gbytes.Say("logs.example.com"))
+				Expect(string(stderr.Contents())).NotTo(ContainSubstring("syslog-secret"))
+				Expect(string(stderr.Contents())).NotTo(ContainSubstring("resolved-credhub-value"))
+				Expect(string(stderr.Contents())).To(ContainSubstring("client_secret: '***'"))
+			})
 		})
 
 		It("sets the expected update block when the plan update block is empty and old manifest exists", func() {
@@ -1042,15 +3835,7 @@ var _ = Describe("Redis Service Adapter", func() {
 			planWithoutUpdateBlock := dedicatedPlan
 			planWithoutUpdateBlock.Update = nil
 
-			generatedManifest, generatedErr := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				planWithoutUpdateBlock,
-				map[string]interface{}{},
-				&oldManifest,
-				nil,
-				nil,
-			)
+			generatedManifest, generatedErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, planWithoutUpdateBlock, map[string]interface{}{}, &oldManifest)
 
 			Expect(generatedErr).ToNot(HaveOccurred())
 			Expect(generatedManifest.Manifest.Update.Canaries).To(Equal(1))
@@ -1062,15 +3847,7 @@ var _ = Describe("Redis Service Adapter", func() {
 			oldManifest := createDefaultOldManifest()
 			oldManifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})[adapter.ManagedSecretKey] = "((/odb/generated/path/yeee))"
 
-			manifestOutput, generateErr := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				dedicatedPlan,
-				defaultRequestParameters,
-				&oldManifest,
-				nil,
-				nil,
-			)
+			manifestOutput, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
 			Expect(generateErr).ToNot(HaveOccurred())
 			odbManagedSecret := manifestOutput.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})[adapter.ManagedSecretKey]
 			Expect(odbManagedSecret.(string)).To(Equal("((/odb/generated/path/yeee))"))
@@ -1082,15 +3859,7 @@ var _ = Describe("Redis Service Adapter", func() {
 
 			manifestGenerator.Config.IgnoreODBManagedSecretOnUpdate = true
 
-			manifestOutput, generatedErr := generateManifest(
-				manifestGenerator,
-				defaultServiceReleases,
-				dedicatedPlan,
-				map[string]interface{}{},
-				&oldManifest,
-				nil,
-				nil,
-			)
+			manifestOutput, generatedErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, map[string]interface{}{}, &oldManifest)
 
 			Expect(generatedErr).NotTo(HaveOccurred())
 			odbManagedSecret := manifestOutput.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})[adapter.ManagedSecretKey]
@@ -1113,7 +3882,7 @@ var _ = Describe("Redis Service Adapter", func() {
 						"plan_secret": "plansecret",
 						"persistence": true,
 					},
-					InstanceGroups: []serviceadapter.InstanceGroup{{Name: config.RedisInstanceGroupName}},
+					InstanceGroups: []serviceadapter.InstanceGroup{{Name: config.RedisInstanceGroupName, PersistentDiskType: "some-disk", AZs: []string{}, Networks: []string{"some-network"}}},
 				}
 			})
 
@@ -1170,15 +3939,7 @@ var _ = Describe("Redis Service Adapter", func() {
 			})
 
 			It("does not reuse the odb secret name when regenerating a secret", func() {
-				provisionManifestOutput, err := generateManifest(
-					manifestGenerator,
-					defaultServiceReleases,
-					planWithSecret,
-					map[string]interface{}{},
-					nil,
-					nil,
-					nil,
-				)
+				provisionManifestOutput, err := generateCreateManifest(manifestGenerator, defaultServiceReleases, planWithSecret)
 				Expect(err).NotTo(HaveOccurred())
 				provisionSecretKey := getSecretKey(provisionManifestOutput.ODBManagedSecrets, "plansecret")
 
@@ -1204,17 +3965,9 @@ var _ = Describe("Redis Service Adapter", func() {
 					Properties: map[string]interface{}{
 						"persistence": true,
 					},
-					InstanceGroups: []serviceadapter.InstanceGroup{{Name: config.RedisInstanceGroupName}},
+					InstanceGroups: []serviceadapter.InstanceGroup{{Name: config.RedisInstanceGroupName, PersistentDiskType: "some-disk", AZs: []string{}, Networks: []string{"some-network"}}},
 				}
-				provisionManifestOutput, err := generateManifest(
-					manifestGenerator,
-					defaultServiceReleases,
-					planWithoutSecret,
-					map[string]interface{}{},
-					nil,
-					nil,
-					nil,
-				)
+				provisionManifestOutput, err := generateCreateManifest(manifestGenerator, defaultServiceReleases, planWithoutSecret)
 				Expect(err).NotTo(HaveOccurred())
 				_, found := provisionManifestOutput.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["plan_secret"]
 				Expect(found).To(BeFalse(), "should not have plan_secret key in manifest")
@@ -1227,23 +3980,221 @@ var _ = Describe("Redis Service Adapter", func() {
 				config.SecureManifestsEnabled = false
 				manifestGenerator = adapter.ManifestGenerator{Config: config, StderrLogger: stderrLogger}
 
-				provisionManifestOutput, err := generateManifest(
+				provisionManifestOutput, err := generateCreateManifest(manifestGenerator, defaultServiceReleases, planWithSecret)
+				Expect(err).NotTo(HaveOccurred())
+				_, found := provisionManifestOutput.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["plan_secret"]
+				Expect(found).To(BeFalse(), "should not have plan_secret key in manifest")
+				for key, _ := range provisionManifestOutput.ODBManagedSecrets {
+					Expect(key).ToNot(HavePrefix("plan_secret_key"))
+				}
+			})
+
+		})
+
+		Describe("persistent disk changes", func() {
+			var oldManifest bosh.BoshManifest
+
+			BeforeEach(func() {
+				oldManifest = createDefaultOldManifest()
+				oldManifest.InstanceGroups[0].Name = "redis-server"
+				oldManifest.InstanceGroups[0].PersistentDiskType = "dedicated-disk"
+				dedicatedPlan.Properties[adapter.PersistentDiskSizesPropertyKey] = map[string]interface{}{
+					"small-disk":     1024,
+					"dedicated-disk": 10240,
+					"large-disk":     20480,
+				}
+			})
+
+			generate := func(plan serviceadapter.Plan, params map[string]interface{}) error {
+				_, err := generateUpdateManifest(manifestGenerator, defaultServiceReleases, plan, params, &oldManifest)
+				return err
+			}
+
+			It("allows the same disk type", func() {
+				Expect(generate(dedicatedPlan, defaultRequestParameters)).To(Succeed())
+			})
+
+			It("allows growing to a larger disk type", func() {
+				dedicatedPlan.InstanceGroups[0].PersistentDiskType = "large-disk"
+				Expect(generate(dedicatedPlan, defaultRequestParameters)).To(Succeed())
+			})
+
+			It("refuses to remove the persistent disk unless data loss is accepted", func() {
+				dedicatedPlan.Properties["persistence"] = false
+				dedicatedPlan.InstanceGroups[0].PersistentDiskType = ""
+				Expect(generate(dedicatedPlan, defaultRequestParameters)).To(matchAdapterError(
+					"plan change removes the persistent disk and would lose data; set 'accept_data_loss: true' to proceed",
+					Equal("deployment some-instance-id: plan change removes persistent disk type dedicated-disk and would lose data; set 'accept_data_loss: true' to proceed"),
+				))
+
+				params := map[string]interface{}{"parameters": map[string]interface{}{adapter.AcceptDataLossKey: true}}
+				Expect(generate(dedicatedPlan, params)).To(Succeed())
+			})
+
+			It("refuses to shrink the persistent disk unless data loss is accepted", func() {
+				dedicatedPlan.InstanceGroups[0].PersistentDiskType = "small-disk"
+				Expect(generate(dedicatedPlan, defaultRequestParameters)).To(matchAdapterError(
+					"plan change shrinks the persistent disk and may truncate data; set 'accept_data_loss: true' to proceed",
+					Equal("deployment some-instance-id: plan change shrinks persistent disk from dedicated-disk to small-disk and may truncate data; set 'accept_data_loss: true' to proceed"),
+				))
+
+				params := map[string]interface{}{"parameters": map[string]interface{}{adapter.AcceptDataLossKey: true}}
+				Expect(generate(dedicatedPlan, params)).To(Succeed())
+			})
+
+			It("treats a change between disk types of unknown size as a shrink", func() {
+				dedicatedPlan.InstanceGroups[0].PersistentDiskType = "unknown-disk"
+				Expect(generate(dedicatedPlan, defaultRequestParameters)).To(matchAdapterError(
+					"plan change may shrink the persistent disk and truncate data; set 'accept_data_loss: true' to proceed",
+					Equal("deployment some-instance-id: plan change switches persistent disk from dedicated-disk to unknown-disk, which may truncate data as their sizes are missing from plan property 'persistent_disk_sizes'; set 'accept_data_loss: true' to proceed"),
+				))
+
+				params := map[string]interface{}{"parameters": map[string]interface{}{adapter.AcceptDataLossKey: true}}
+				Expect(generate(dedicatedPlan, params)).To(Succeed())
+			})
+
+			It("treats a change as a shrink when the plan has no disk sizes at all", func() {
+				delete(dedicatedPlan.Properties, adapter.PersistentDiskSizesPropertyKey)
+				dedicatedPlan.InstanceGroups[0].PersistentDiskType = "large-disk"
+				Expect(generate(dedicatedPlan, defaultRequestParameters)).To(matchAdapterError(
+					"plan change may shrink the persistent disk and truncate data; set 'accept_data_loss: true' to proceed",
+					ContainSubstring("switches persistent disk from dedicated-disk to large-disk"),
+				))
+			})
+		})
+
+		Describe("plan transitions", func() {
+			var previousPlan serviceadapter.Plan
+
+			BeforeEach(func() {
+				previousPlan = serviceadapter.Plan{
+					Properties: map[string]interface{}{
+						"persistence":               true,
+						adapter.PlanNamePropertyKey: "small",
+					},
+					InstanceGroups: []serviceadapter.InstanceGroup{
+						{
+							Name:     "redis-server",
+							Networks: []string{"dedicated-network"},
+							AZs:      []string{"dedicated-az2", "dedicated-az1"},
+						},
+					},
+				}
+				dedicatedPlan.Properties[adapter.PlanNamePropertyKey] = "dedicated"
+			})
+
+			generate := func(params map[string]interface{}) error {
+				_, err := generateManifest(
 					manifestGenerator,
 					defaultServiceReleases,
-					planWithSecret,
-					map[string]interface{}{},
-					nil,
+					dedicatedPlan,
+					params,
 					nil,
+					&previousPlan,
 					nil,
 				)
+				return err
+			}
+
+			It("allows any transition when the plan does not declare migratable_from", func() {
+				Expect(generate(defaultRequestParameters)).To(Succeed())
+			})
+
+			It("allows a transition from a listed plan", func() {
+				dedicatedPlan.Properties[adapter.MigratableFromPropertyKey] = []interface{}{"small"}
+				Expect(generate(defaultRequestParameters)).To(Succeed())
+			})
+
+			It("allows a transition from any plan with a wildcard", func() {
+				dedicatedPlan.Properties[adapter.MigratableFromPropertyKey] = []interface{}{"*"}
+				Expect(generate(defaultRequestParameters)).To(Succeed())
+			})
+
+			It("allows a transition from any plan with a scalar wildcard", func() {
+				dedicatedPlan.Properties[adapter.MigratableFromPropertyKey] = "*"
+				Expect(generate(defaultRequestParameters)).To(Succeed())
+			})
+
+			It("refuses a transition from a plan that is not listed", func() {
+				dedicatedPlan.Properties[adapter.MigratableFromPropertyKey] = []interface{}{"medium"}
+				Expect(generate(defaultRequestParameters)).To(matchUserError("plan transition from small is not supported"))
+			})
+
+			It("refuses a transition from a plan without a name unless the plan allows any plan", func() {
+				delete(previousPlan.Properties, adapter.PlanNamePropertyKey)
+				dedicatedPlan.Properties[adapter.MigratableFromPropertyKey] = []interface{}{"small"}
+				Expect(generate(defaultRequestParameters)).To(matchUserError("plan transition from a plan without a plan_name is not supported"))
+
+				dedicatedPlan.Properties[adapter.MigratableFromPropertyKey] = []interface{}{"*"}
+				Expect(generate(defaultRequestParameters)).To(Succeed())
+			})
+
+			It("refuses a transition between two different plans that are both unnamed", func() {
+				delete(previousPlan.Properties, adapter.PlanNamePropertyKey)
+				delete(dedicatedPlan.Properties, adapter.PlanNamePropertyKey)
+				dedicatedPlan.Properties[adapter.MigratableFromPropertyKey] = []interface{}{"small"}
+				Expect(generate(defaultRequestParameters)).To(matchUserError("plan transition from a plan without a plan_name is not supported"))
+			})
+
+			It("classifies a move between two different unnamed plans as a plan change", func() {
+				delete(previousPlan.Properties, adapter.PlanNamePropertyKey)
+				delete(dedicatedPlan.Properties, adapter.PlanNamePropertyKey)
+				oldManifest := createDefaultOldManifest()
+				_, err := generateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest, &previousPlan, nil)
 				Expect(err).NotTo(HaveOccurred())
-				_, found := provisionManifestOutput.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})["plan_secret"]
-				Expect(found).To(BeFalse(), "should not have plan_secret key in manifest")
-				for key, _ := range provisionManifestOutput.ODBManagedSecrets {
-					Expect(key).ToNot(HavePrefix("plan_secret_key"))
+				Expect(stderr).To(gbytes.Say("generating manifest, operation type: plan-change"))
+			})
+
+			It("does not treat an edit to the definition of the same plan as a transition", func() {
+				previousPlan = dedicatedPlan
+				previousPlan.Properties = serviceadapter.Properties{}
+				for key, value := range dedicatedPlan.Properties {
+					previousPlan.Properties[key] = value
 				}
+				previousPlan.Properties["maxclients"] = 100
+				dedicatedPlan.Properties[adapter.MigratableFromPropertyKey] = []interface{}{"medium"}
+				Expect(generate(defaultRequestParameters)).To(Succeed())
 			})
 
+			DescribeTable("returns an operator error for a malformed migratable_from",
+				func(value interface{}) {
+					dedicatedPlan.Properties[adapter.MigratableFromPropertyKey] = value
+					Expect(generate(defaultRequestParameters)).To(matchOperatorError(
+						fmt.Sprintf("invalid value for plan property 'migratable_from': %v, must be a list of plan names or \"*\"", value),
+					))
+				},
+				Entry("a number", 42),
+				Entry("a list with a non-string entry", []interface{}{"small", 3}),
+				Entry("an empty string", ""),
+			)
+
+			It("reports a malformed migratable_from on create too", func() {
+				dedicatedPlan.Properties[adapter.MigratableFromPropertyKey] = map[string]interface{}{"small": true}
+				_, err := generateCreateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan)
+				Expect(err).To(matchOperatorError("invalid value for plan property 'migratable_from': map[small:true], must be a list of plan names or \"*\""))
+			})
+
+			It("refuses a network change unless forced", func() {
+				previousPlan.InstanceGroups[0].Networks = []string{"other-network"}
+				Expect(generate(defaultRequestParameters)).To(matchAdapterError(
+					"plan transition changes networks; set 'force_plan_change: true' to proceed",
+					Equal("deployment some-instance-id: plan transition changes networks from [other-network] to [dedicated-network]; set 'force_plan_change: true' to proceed"),
+				))
+
+				params := map[string]interface{}{"parameters": map[string]interface{}{adapter.ForcePlanChangeKey: true}}
+				Expect(generate(params)).To(Succeed())
+			})
+
+			It("refuses an availability zone change unless forced", func() {
+				previousPlan.InstanceGroups[0].AZs = []string{"dedicated-az1"}
+				Expect(generate(defaultRequestParameters)).To(matchAdapterError(
+					"plan transition changes availability zones; set 'force_plan_change: true' to proceed",
+					Equal("deployment some-instance-id: plan transition changes availability zones from [dedicated-az1] to [dedicated-az1, dedicated-az2]; set 'force_plan_change: true' to proceed"),
+				))
+
+				params := map[string]interface{}{"parameters": map[string]interface{}{adapter.ForcePlanChangeKey: true}}
+				Expect(generate(params)).To(Succeed())
+			})
 		})
 
 		Describe("release version tests", func() {
@@ -1254,7 +4205,7 @@ var _ = Describe("Redis Service Adapter", func() {
 			}
 
 			runReleaseVersionTests := func(t testInputs) {
-				errorString := fmt.Sprintf("error generating manifest: new release version %s is lower than existing release version %s", t.newVersion, t.oldVersion)
+				errorString := fmt.Sprintf("error generating manifest: new release versions are lower than existing release versions: some-release-name (existing %s, new %s)", t.oldVersion, t.newVersion)
 
 				Context(fmt.Sprintf("when the old version (of the release that provides redis-server) is %s and the new version is %s", t.oldVersion, t.newVersion), func() {
 					var itStatement string
@@ -1271,17 +4222,9 @@ var _ = Describe("Redis Service Adapter", func() {
 						oldManifest := createDefaultOldManifest()
 						oldManifest.Releases[0].Version = t.oldVersion
 
-						_, generateErr := generateManifest(
-							manifestGenerator,
-							defaultServiceReleases,
-							dedicatedPlan,
-							defaultRequestParameters,
-							&oldManifest,
-							nil,
-							nil,
-						)
+						_, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
 						if t.returnsError {
-							Expect(generateErr).To(MatchError(errorString))
+							Expect(generateErr).To(matchOperatorError(errorString))
 						} else {
 							Expect(generateErr).NotTo(HaveOccurred())
 						}
@@ -1289,6 +4232,129 @@ var _ = Describe("Redis Service Adapter", func() {
 				})
 			}
 
+			Context("when the deployment contains more than one release", func() {
+				var oldManifest bosh.BoshManifest
+
+				BeforeEach(func() {
+					defaultServiceReleases = append(defaultServiceReleases,
+						serviceadapter.ServiceRelease{Name: "syslog", Version: "11", Jobs: []string{"syslog-forwarder"}},
+						serviceadapter.ServiceRelease{Name: "exporter", Version: "2", Jobs: []string{"redis-exporter"}},
+					)
+					oldManifest = createDefaultOldManifest()
+					oldManifest.Releases = append(oldManifest.Releases,
+						bosh.Release{Name: "syslog", Version: "11"},
+						bosh.Release{Name: "exporter", Version: "2"},
+					)
+				})
+
+				generate := func() error {
+					_, err := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
+					return err
+				}
+
+				It("lists every release that would be downgraded", func() {
+					defaultServiceReleases[0].Version = "3"
+					defaultServiceReleases[1].Version = "10"
+					Expect(generate()).To(matchOperatorError("error generating manifest: new release versions are lower than existing release versions: some-release-name (existing 4, new 3), syslog (existing 11, new 10)"))
+				})
+
+				It("bypasses the comparison for a release at latest", func() {
+					defaultServiceReleases[1].Version = "latest"
+					oldManifest.Releases[2].Version = "latest"
+					Expect(generate()).To(Succeed())
+				})
+
+				It("ignores releases that are new or were removed", func() {
+					defaultServiceReleases[1].Name = "new-syslog"
+					defaultServiceReleases[1].Version = "1"
+					oldManifest.Releases = append(oldManifest.Releases, bosh.Release{Name: "removed", Version: "99"})
+					Expect(generate()).To(Succeed())
+				})
+			})
+
+			Context("when the upgrade check mode is warn", func() {
+				var oldManifest bosh.BoshManifest
+
+				BeforeEach(func() {
+					dedicatedPlan.Properties[adapter.UpgradeCheckModePropertyKey] = adapter.UpgradeCheckModeWarn
+					oldManifest = createDefaultOldManifest()
+				})
+
+				It("logs a warning with both versions and generates the manifest for a downgrade", func() {
+					defaultServiceReleases[0].Version = "3"
+
+					_, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
+					Expect(generateErr).NotTo(HaveOccurred())
+					Expect(stderr).To(gbytes.Say("upgrade check warning: release=some-release-name existing_version=4 new_version=3"))
+				})
+
+				It("still enforces other validations", func() {
+					defaultServiceReleases[0].Version = "3"
+					dedicatedPlan.InstanceGroups[0].PersistentDiskType = ""
+
+					_, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
+					Expect(generateErr).To(matchAdapterError(adapter.ContactOperatorMessage, ContainSubstring("a persistent disk type must be specified")))
+				})
+			})
+
+			It("returns an error when the upgrade check mode is invalid", func() {
+				dedicatedPlan.Properties[adapter.UpgradeCheckModePropertyKey] = "ignore"
+				oldManifest := createDefaultOldManifest()
+
+				_, generateErr := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
+				Expect(generateErr).To(matchOperatorError("invalid value for plan property 'upgrade_check_mode': ignore, must be one of enforce, warn"))
+			})
+
+			Context("when the plan sets a minimum previous release version", func() {
+				var oldManifest bosh.BoshManifest
+
+				BeforeEach(func() {
+					dedicatedPlan.Properties[adapter.MinimumPreviousReleaseVersionKey] = "12.0"
+					defaultServiceReleases[0].Version = "14"
+					oldManifest = createDefaultOldManifest()
+				})
+
+				generate := func() error {
+					_, err := generateUpdateManifest(manifestGenerator, defaultServiceReleases, dedicatedPlan, defaultRequestParameters, &oldManifest)
+					return err
+				}
+
+				It("returns an error when the previous release is older than the minimum", func() {
+					oldManifest.Releases[0].Version = "11.3"
+					Expect(generate()).To(matchOperatorError("cannot upgrade from release some-release-name version 11.3: the minimum supported previous version is 12.0, upgrade the instance via an intermediate release first"))
+					Expect(stderr).To(gbytes.Say("deployment some-instance-id: cannot upgrade from release some-release-name version 11.3: the minimum supported previous version is 12.0"))
+				})
+
+				It("succeeds when the previous release meets the minimum", func() {
+					oldManifest.Releases[0].Version = "12.0"
+					Expect(generate()).To(Succeed())
+				})
+
+				It("logs a warning and succeeds when the previous release is latest", func() {
+					oldManifest.Releases[0].Version = "latest"
+					Expect(generate()).To(Succeed())
+					Expect(stderr).To(gbytes.Say("skipping minimum previous release version 12.0 check"))
+				})
+
+				DescribeTable("enforces a minimum that YAML decoded as a number",
+					func(minimum interface{}, expectedMinimum string) {
+						dedicatedPlan.Properties[adapter.MinimumPreviousReleaseVersionKey] = minimum
+						oldManifest.Releases[0].Version = "1.4"
+						Expect(generate()).To(matchOperatorError(fmt.Sprintf("cannot upgrade from release some-release-name version 1.4: the minimum supported previous version is %s, upgrade the instance via an intermediate release first", expectedMinimum)))
+
+						oldManifest.Releases[0].Version = "2.1"
+						Expect(generate()).To(Succeed())
+					},
+					Entry("an integer", 2, "2"),
+					Entry("a float", 1.5, "1.5"),
+				)
+
+				It("returns an error when the minimum is neither a string nor a number", func() {
+					dedicatedPlan.Properties[adapter.MinimumPreviousReleaseVersionKey] = []interface{}{"12.0"}
+					Expect(generate()).To(matchOperatorError("invalid value for plan property 'minimum_previous_release_version': [12.0], must be a release version"))
+				})
+			})
+
 			for _, t := range []testInputs{
 				{"3", "3", false}, {"3", "4", false}, {"3", "2", true},
 				{"3.1", "3.1", false}, {"3.2", "3.10", false}, {"3.10", "3.2", true},
@@ -1300,6 +4366,10 @@ var _ = Describe("Redis Service Adapter", func() {
 				{"1+dev.2", "2+dev.1", false}, {"2+dev.1", "1+dev.2", true},
 				{"0.1+dev.2", "0.2+dev.1", false}, {"0.2+dev.1", "0.1+dev.2", true},
 				{"0+dev.1", "1", false}, {"1", "1+dev.1", false}, {"2", "1+dev.1", true},
+				{"1.2.3", "1.2.10", false}, {"1.2.10", "1.2.3", true}, {"1.2", "1.2.0", false},
+				{"1.2+dev.99", "1.2.3", false}, {"1.2.3", "1.2+dev.99", true},
+				{"1.2.0", "1.2+dev.99", false}, {"1.2+dev.99", "1.2.0", true},
+				{"1.2+dev.99", "1.3.0", false}, {"1.3.0", "1.2+dev.99", true},
 				{"latest", "latest", false},
 			} {
 				runReleaseVersionTests(t)
@@ -1360,6 +4430,57 @@ func generateManifest(
 	}, plan, requestParams, oldManifest, oldPlan, oldSecrets)
 }
 
+func generateCreateManifest(
+	manifestGenerator adapter.ManifestGenerator,
+	serviceReleases serviceadapter.ServiceReleases,
+	plan serviceadapter.Plan,
+) (serviceadapter.GenerateManifestOutput, error) {
+	return generateManifest(manifestGenerator, serviceReleases, plan, map[string]interface{}{}, nil, nil, nil)
+}
+
+func generateUpdateManifest(
+	manifestGenerator adapter.ManifestGenerator,
+	serviceReleases serviceadapter.ServiceReleases,
+	plan serviceadapter.Plan,
+	requestParams map[string]interface{},
+	oldManifest *bosh.BoshManifest,
+) (serviceadapter.GenerateManifestOutput, error) {
+	return generateManifest(manifestGenerator, serviceReleases, plan, requestParams, oldManifest, nil, nil)
+}
+
+// generateRedisProperties returns the redis block of the first instance group
+// of the generated manifest.
+func generateRedisProperties(
+	manifestGenerator adapter.ManifestGenerator,
+	serviceReleases serviceadapter.ServiceReleases,
+	plan serviceadapter.Plan,
+	requestParams map[string]interface{},
+	oldManifest *bosh.BoshManifest,
+) (map[interface{}]interface{}, error) {
+	generated, err := generateManifest(manifestGenerator, serviceReleases, plan, requestParams, oldManifest, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return generated.Manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{}), nil
+}
+
+func withArbitraryParams(params map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"parameters": params}
+}
+
+type fakeResolver struct {
+	known   map[string]bool
+	lookups []string
+}
+
+func (r *fakeResolver) LookupHost(host string) ([]string, error) {
+	r.lookups = append(r.lookups, host)
+	if !r.known[host] {
+		return nil, errors.New("no such host")
+	}
+	return []string{"10.0.0.1"}, nil
+}
+
 func containsJobName(list []bosh.Job, query string) bool {
 	for _, v := range list {
 		if v.Name == query {
@@ -1369,6 +4490,34 @@ func containsJobName(list []bosh.Job, query string) bool {
 	return false
 }
 
+func findJob(list []bosh.Job, name string) bosh.Job {
+	for _, job := range list {
+		if job.Name == name {
+			return job
+		}
+	}
+	Fail("no job named " + name)
+	return bosh.Job{}
+}
+
+// reloadManifest puts a manifest through YAML, so that a generated manifest
+// and a fixture compare equal whatever map types the generator used.
+func reloadManifest(manifest bosh.BoshManifest) bosh.BoshManifest {
+	manifestYAML, err := yaml.Marshal(manifest)
+	Expect(err).NotTo(HaveOccurred())
+	var reloaded bosh.BoshManifest
+	Expect(yaml.Unmarshal(manifestYAML, &reloaded)).To(Succeed())
+	return reloaded
+}
+
 func removePlanSecret(manifest bosh.BoshManifest) {
 	delete(manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{}), "plan_secret")
 }
+
+func matchOperatorError(detail string) types.GomegaMatcher {
+	return matchAdapterError(adapter.ContactOperatorMessage, Equal("deployment some-instance-id: "+detail))
+}
+
+func matchUserError(detail string) types.GomegaMatcher {
+	return matchAdapterError(detail, Equal("deployment some-instance-id: "+detail))
+}
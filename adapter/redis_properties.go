@@ -0,0 +1,259 @@
+package adapter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RedisProperties is the redis block of the redis-server instance group.
+// Persistence through the certificate references are always written; the
+// remaining fields only appear in the manifest when they are set.
+type RedisProperties struct {
+	Persistence     string
+	Password        string
+	MaxClients      int
+	DrainTimeout    int
+	GeneratedSecret string
+	ManagedSecret   string
+	CACert          string
+	Certificate     string
+	PrivateKey      string
+	SchemaVersion   int
+
+	Port                 int
+	TLSPort              int
+	TLSClientCertificate string
+	TLSClientPrivateKey  string
+	Bind                 string
+	BindHostname         string
+	PlanSecret           string
+	Secret               string
+	MaxMemory            string
+	EvictionTenacity     *int
+	LazyFree             map[string]string
+	Hz                   int
+	DynamicHz            string
+	ActiveRehashing      string
+	EncodingLimits       map[interface{}]interface{}
+	ReplBacklogSize      string
+	ReplTimeout          int
+	LogLevel             string
+	UnixSocket           string
+	UnixSocketPerm       string
+	MaintenanceMode      bool
+	ProtectedMode        string
+	BindingTTLSeconds    int
+	Shareable            bool
+	ClusterEnabled       string
+	SystemdOverrides     map[string]string
+
+	// Extra holds the keys the adapter does not model, such as those an
+	// operator added by hand, so that they survive a round trip.
+	Extra map[interface{}]interface{}
+}
+
+func (p RedisProperties) ToBOSHProperties() map[interface{}]interface{} {
+	properties := map[interface{}]interface{}{}
+	for key, value := range p.Extra {
+		properties[key] = value
+	}
+
+	properties["persistence"] = p.Persistence
+	properties["password"] = p.Password
+	properties["maxclients"] = p.MaxClients
+	properties["drain_timeout"] = p.DrainTimeout
+	properties[GeneratedSecretKey] = p.GeneratedSecret
+	properties[ManagedSecretKey] = p.ManagedSecret
+	properties["ca_cert"] = p.CACert
+	properties["certificate"] = p.Certificate
+	properties["private_key"] = p.PrivateKey
+
+	setInt := func(key string, value int) {
+		if value != 0 {
+			properties[key] = value
+		}
+	}
+	setString := func(key, value string) {
+		if value != "" {
+			properties[key] = value
+		}
+	}
+
+	setInt(PropertiesSchemaVersionKey, p.SchemaVersion)
+	setInt("port", p.Port)
+	setInt(TLSPortKey, p.TLSPort)
+	setString(TLSClientCertificateKey, p.TLSClientCertificate)
+	setString(TLSClientPrivateKeyKey, p.TLSClientPrivateKey)
+	setString("bind", p.Bind)
+	setString(BindHostnameKey, p.BindHostname)
+	setString("plan_secret", p.PlanSecret)
+	setString("secret", p.Secret)
+	setString(MaxMemoryKey, p.MaxMemory)
+	if p.EvictionTenacity != nil {
+		properties[EvictionTenacityKey] = *p.EvictionTenacity
+	}
+	for param, value := range p.LazyFree {
+		setString(param, value)
+	}
+	setInt(HzKey, p.Hz)
+	setString(DynamicHzKey, p.DynamicHz)
+	setString(ActiveRehashingKey, p.ActiveRehashing)
+	if p.EncodingLimits != nil {
+		properties[EncodingLimitsKey] = p.EncodingLimits
+	}
+	setString(ReplBacklogSizeKey, p.ReplBacklogSize)
+	setInt(ReplTimeoutKey, p.ReplTimeout)
+	setString(RedisLogLevelKey, p.LogLevel)
+	setString(UnixSocketKey, p.UnixSocket)
+	setString(UnixSocketPermKey, p.UnixSocketPerm)
+	if p.MaintenanceMode {
+		properties[RequirePassKey] = ""
+	}
+	setString(ProtectedModeKey, p.ProtectedMode)
+	setInt(BindingTTLSecondsPropertyKey, p.BindingTTLSeconds)
+	if p.Shareable {
+		properties[ShareablePropertyKey] = true
+	}
+	setString(ClusterEnabledKey, p.ClusterEnabled)
+	if len(p.SystemdOverrides) > 0 {
+		overrides := map[interface{}]interface{}{}
+		for directive, value := range p.SystemdOverrides {
+			overrides[directive] = value
+		}
+		properties[SystemdOverridesPropertyKey] = overrides
+	}
+	return properties
+}
+
+// FromBOSHProperties reads a redis block as decoded from either YAML or JSON.
+// Only the password, maxclients and bind_hostname are rejected when they have
+// the wrong type; other malformed values are ignored, as the adapter has
+// always done when carrying them forward.
+func FromBOSHProperties(properties map[interface{}]interface{}) (RedisProperties, error) {
+	p := RedisProperties{}
+
+	if value, found := properties["password"]; found {
+		password, ok := value.(string)
+		if !ok {
+			return RedisProperties{}, fmt.Errorf("unexpected type %T for the password", value)
+		}
+		p.Password = password
+	}
+
+	if value, found := properties["maxclients"]; found {
+		maxClients, ok := toInt(value)
+		if !ok {
+			return RedisProperties{}, fmt.Errorf("invalid value for maxclients: %v (%T)", value, value)
+		}
+		p.MaxClients = maxClients
+	}
+
+	if value, found := properties[BindHostnameKey]; found {
+		hostname, ok := value.(string)
+		if !ok || strings.TrimSpace(hostname) == "" {
+			return RedisProperties{}, fmt.Errorf("invalid value for manifest property '%s': %v, must be a non-empty string", BindHostnameKey, value)
+		}
+		p.BindHostname = hostname
+	}
+
+	stringProperty := func(key string) string {
+		value, _ := properties[key].(string)
+		return value
+	}
+	intProperty := func(key string) int {
+		value, _ := toInt(properties[key])
+		return value
+	}
+
+	p.Persistence = stringProperty("persistence")
+	p.DrainTimeout = intProperty("drain_timeout")
+	p.GeneratedSecret = stringProperty(GeneratedSecretKey)
+	p.ManagedSecret = stringProperty(ManagedSecretKey)
+	p.CACert = stringProperty("ca_cert")
+	p.Certificate = stringProperty("certificate")
+	p.PrivateKey = stringProperty("private_key")
+	p.SchemaVersion = intProperty(PropertiesSchemaVersionKey)
+	p.Port = intProperty("port")
+	p.TLSPort = intProperty(TLSPortKey)
+	p.TLSClientCertificate = stringProperty(TLSClientCertificateKey)
+	p.TLSClientPrivateKey = stringProperty(TLSClientPrivateKeyKey)
+	p.Bind = stringProperty("bind")
+	p.PlanSecret = stringProperty("plan_secret")
+	p.Secret = stringProperty("secret")
+	p.MaxMemory = stringProperty(MaxMemoryKey)
+	if tenacity, ok := toInt(properties[EvictionTenacityKey]); ok {
+		p.EvictionTenacity = &tenacity
+	}
+	for _, param := range lazyFreeParams {
+		if value := stringProperty(param); value != "" {
+			if p.LazyFree == nil {
+				p.LazyFree = map[string]string{}
+			}
+			p.LazyFree[param] = value
+		}
+	}
+	p.Hz = intProperty(HzKey)
+	p.DynamicHz = stringProperty(DynamicHzKey)
+	p.ActiveRehashing = stringProperty(ActiveRehashingKey)
+	p.EncodingLimits, _ = interfaceKeyedMap(properties[EncodingLimitsKey])
+	p.ReplBacklogSize = stringProperty(ReplBacklogSizeKey)
+	p.ReplTimeout = intProperty(ReplTimeoutKey)
+	p.LogLevel = stringProperty(RedisLogLevelKey)
+	p.UnixSocket = stringProperty(UnixSocketKey)
+	p.UnixSocketPerm = stringProperty(UnixSocketPermKey)
+	p.ProtectedMode = stringProperty(ProtectedModeKey)
+	if requirePass, found := properties[RequirePassKey]; found && requirePass == "" {
+		p.MaintenanceMode = true
+	}
+	p.BindingTTLSeconds = intProperty(BindingTTLSecondsPropertyKey)
+	p.Shareable, _ = properties[ShareablePropertyKey].(bool)
+	p.ClusterEnabled = stringProperty(ClusterEnabledKey)
+	if overrides, ok := interfaceKeyedMap(properties[SystemdOverridesPropertyKey]); ok {
+		p.SystemdOverrides = map[string]string{}
+		for directive, value := range overrides {
+			directiveName, _ := directive.(string)
+			p.SystemdOverrides[directiveName], _ = value.(string)
+		}
+	}
+
+	for key, value := range properties {
+		if key == RequirePassKey && p.MaintenanceMode {
+			continue
+		}
+		if name, ok := key.(string); !ok || !isModelledRedisProperty(name) {
+			if p.Extra == nil {
+				p.Extra = map[interface{}]interface{}{}
+			}
+			p.Extra[key] = value
+		}
+	}
+	return p, nil
+}
+
+func isModelledRedisProperty(key string) bool {
+	switch key {
+	case "persistence", "password", "maxclients", "drain_timeout", GeneratedSecretKey, ManagedSecretKey,
+		"ca_cert", "certificate", "private_key", PropertiesSchemaVersionKey, "port", TLSPortKey, TLSClientCertificateKey, TLSClientPrivateKeyKey, "bind", BindHostnameKey, "plan_secret",
+		"secret", MaxMemoryKey, EvictionTenacityKey, HzKey, DynamicHzKey, ActiveRehashingKey, EncodingLimitsKey, ReplBacklogSizeKey,
+		ReplTimeoutKey, RedisLogLevelKey, UnixSocketKey, UnixSocketPermKey, ProtectedModeKey, BindingTTLSecondsPropertyKey, ShareablePropertyKey, ClusterEnabledKey,
+		SystemdOverridesPropertyKey:
+		return true
+	}
+	return isLazyFreeParam(key)
+}
+
+// interfaceKeyedMap converts the string-keyed maps that JSON decoding produces
+// into the interface-keyed maps YAML decoding does.
+func interfaceKeyedMap(value interface{}) (map[interface{}]interface{}, bool) {
+	switch m := value.(type) {
+	case map[interface{}]interface{}:
+		return m, true
+	case map[string]interface{}:
+		converted := make(map[interface{}]interface{}, len(m))
+		for key, nested := range m {
+			converted[key] = nested
+		}
+		return converted, true
+	}
+	return nil, false
+}
@@ -0,0 +1,124 @@
+package adapter_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf-experimental/redis-example-service-adapter/adapter"
+	"github.com/pivotal-cf/on-demand-services-sdk/bosh"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var _ = Describe("RedisProperties", func() {
+	DescribeTable("round-trips the redis block of the golden manifests unchanged",
+		func(fixture string) {
+			raw, err := ioutil.ReadFile(getFixturePath(fixture))
+			Expect(err).NotTo(HaveOccurred())
+			var manifest bosh.BoshManifest
+			Expect(yaml.Unmarshal(raw, &manifest)).To(Succeed())
+
+			original := manifest.InstanceGroups[0].Properties["redis"].(map[interface{}]interface{})
+			properties, err := adapter.FromBOSHProperties(original)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(properties.ToBOSHProperties()).To(Equal(original))
+		},
+		Entry("dedicated plan", "dedicated-plan-updated-manifest.yml"),
+		Entry("dedicated plan with arbitrary parameters", "dedicated-plan-updated-manifest-arbitrary-params.yml"),
+	)
+
+	It("round-trips the optional properties and keys it does not model", func() {
+		original := map[interface{}]interface{}{}
+		Expect(yaml.Unmarshal([]byte(`
+persistence: "no"
+password: some-password
+maxclients: 100
+drain_timeout: 30
+generated_secret: ((secret_pass))
+odb_managed_secret: ((odb_secret:odb_managed_secret))
+ca_cert: ((tls_certificate.ca))
+certificate: ((tls_certificate.certificate))
+private_key: ((tls_certificate.private_key))
+port: 6400
+tls-port: 6380
+client_certificate: ((redis_tls_key.certificate))
+client_private_key: ((redis_tls_key.private_key))
+bind: "::"
+bind_hostname: redis.example.com
+secret: ((/some/path))
+maxmemory: "1048576"
+maxmemory-eviction-tenacity: 0
+lazyfree-lazy-eviction: "yes"
+hz: 50
+dynamic-hz: "no"
+activerehashing: "yes"
+encoding_limits:
+  hash-max-listpack-entries: 128
+repl-backlog-size: "67108864"
+repl-timeout: 120
+loglevel: verbose
+unixsocket: /var/vcap/sys/run/redis/redis.sock
+unixsocketperm: "770"
+protected-mode: "no"
+binding_ttl_seconds: 3600
+shareable: true
+cluster-enabled: "yes"
+systemd_overrides: {OOMScoreAdjust: "-900"}
+operator-tuning: {io-threads: 4}
+`), &original)).To(Succeed())
+
+		properties, err := adapter.FromBOSHProperties(original)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(properties.Extra).To(Equal(map[interface{}]interface{}{
+			"operator-tuning": map[interface{}]interface{}{"io-threads": 4},
+		}))
+		Expect(properties.ToBOSHProperties()).To(Equal(original))
+	})
+
+	It("reads a redis block decoded from JSON", func() {
+		var decoded map[string]interface{}
+		Expect(json.Unmarshal([]byte(`{
+			"password": "some-password",
+			"maxclients": 56.0,
+			"tls-port": 6380,
+			"binding_ttl_seconds": "3600",
+			"encoding_limits": {"set-max-intset-entries": 512}
+		}`), &decoded)).To(Succeed())
+		original := map[interface{}]interface{}{}
+		for key, value := range decoded {
+			original[key] = value
+		}
+
+		properties, err := adapter.FromBOSHProperties(original)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(properties.Password).To(Equal("some-password"))
+		Expect(properties.MaxClients).To(Equal(56))
+		Expect(properties.TLSPort).To(Equal(6380))
+		Expect(properties.BindingTTLSeconds).To(Equal(3600))
+		Expect(properties.EncodingLimits).To(Equal(map[interface{}]interface{}{"set-max-intset-entries": 512.0}))
+	})
+
+	DescribeTable("rejects properties the adapter cannot carry forward",
+		func(key string, value interface{}, expectedErr string) {
+			_, err := adapter.FromBOSHProperties(map[interface{}]interface{}{key: value})
+			Expect(err).To(MatchError(expectedErr))
+		},
+		Entry("a non-string password", "password", 42, "unexpected type int for the password"),
+		Entry("a non-numeric maxclients", "maxclients", "lots", "invalid value for maxclients: lots (string)"),
+		Entry("a blank bind_hostname", adapter.BindHostnameKey, " ", "invalid value for manifest property 'bind_hostname':  , must be a non-empty string"),
+	)
+
+	It("reads an empty requirepass as maintenance mode and keeps any other requirepass as is", func() {
+		properties, err := adapter.FromBOSHProperties(map[interface{}]interface{}{adapter.RequirePassKey: ""})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(properties.MaintenanceMode).To(BeTrue())
+		Expect(properties.Extra).To(BeEmpty())
+
+		properties, err = adapter.FromBOSHProperties(map[interface{}]interface{}{adapter.RequirePassKey: "hand-set"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(properties.MaintenanceMode).To(BeFalse())
+		Expect(properties.Extra).To(HaveKeyWithValue(adapter.RequirePassKey, "hand-set"))
+	})
+})
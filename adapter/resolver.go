@@ -0,0 +1,21 @@
+package adapter
+
+import "net"
+
+// Resolver looks up host names for plan property validation. Offline
+// environments can use SkipLookupResolver to avoid DNS queries.
+type Resolver interface {
+	LookupHost(host string) ([]string, error)
+}
+
+type NetResolver struct{}
+
+func (NetResolver) LookupHost(host string) ([]string, error) {
+	return net.LookupHost(host)
+}
+
+type SkipLookupResolver struct{}
+
+func (SkipLookupResolver) LookupHost(host string) ([]string, error) {
+	return []string{host}, nil
+}
@@ -0,0 +1,177 @@
+package adapter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pivotal-cf/on-demand-services-sdk/serviceadapter"
+)
+
+const (
+	AllowedArbitraryParamsPropertyKey = "allowed_arbitrary_params"
+	JSONSchemaVersion                 = "http://json-schema.org/draft-04/schema#"
+)
+
+// SchemaGenerator advertises the arbitrary parameters GenerateManifest and
+// CreateBinding accept, so the marketplace can show and validate them.
+type SchemaGenerator struct{}
+
+func (s SchemaGenerator) GeneratePlanSchema(plan serviceadapter.Plan) (serviceadapter.PlanSchema, error) {
+	allowedParams, err := allowedArbitraryParams(plan.Properties)
+	if err != nil {
+		// Plan schemas are generated for the broker, so the operator detail is
+		// what needs to surface.
+		return serviceadapter.PlanSchema{}, errors.New(asAdapterError(err).OperatorMessage)
+	}
+
+	instanceParams := arbitraryParamSchemas(plan.Properties)
+	if allowedParams != nil {
+		for param := range instanceParams {
+			if !allowedParams[param] {
+				delete(instanceParams, param)
+			}
+		}
+	}
+
+	return serviceadapter.PlanSchema{
+		ServiceInstance: serviceadapter.ServiceInstanceSchema{
+			Create: serviceadapter.JSONSchemas{Parameters: objectSchema(instanceParams)},
+			Update: serviceadapter.JSONSchemas{Parameters: objectSchema(instanceParams)},
+		},
+		ServiceBinding: serviceadapter.ServiceBindingSchema{
+			Create: serviceadapter.JSONSchemas{Parameters: objectSchema(bindingParamSchemas())},
+		},
+	}, nil
+}
+
+func objectSchema(properties map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"$schema":              JSONSchemaVersion,
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+// arbitraryParamSchemas has an entry for every arbitrary parameter the
+// adapter accepts. Only the descriptions and bounds depend on the plan.
+func arbitraryParamSchemas(planProperties serviceadapter.Properties) map[string]interface{} {
+	memorySizePattern := `^\s*\d+\s*([kK][bB]|[mM][bB]|[gG][bB])?\s*$`
+	maxMemory := map[string]interface{}{
+		"type":        []string{"string", "integer"},
+		"pattern":     memorySizePattern,
+		"description": "Memory limit in bytes, or with a kb, mb or gb suffix",
+	}
+	if limit, found := planProperties[MaxMemoryLimitPropertyKey]; found {
+		maxMemory["description"] = fmt.Sprintf("%s, up to the plan limit of %v", maxMemory["description"], limit)
+	}
+
+	encodingLimits := map[string]interface{}{}
+	for _, limit := range knownEncodingLimits {
+		encodingLimits[limit] = map[string]interface{}{"type": "integer"}
+	}
+
+	maxClients := map[string]interface{}{"type": "integer"}
+	if lowerBound, upperBound, err := maxClientsBounds(planProperties); err == nil {
+		if lowerBound != 0 {
+			maxClients["minimum"] = lowerBound
+		}
+		if upperBound != 0 {
+			maxClients["maximum"] = upperBound
+		}
+	}
+
+	// null resets the loglevel to the plan default.
+	logLevels := []interface{}{}
+	for _, level := range redisLogLevels {
+		logLevels = append(logLevels, level)
+	}
+	logLevels = append(logLevels, nil)
+
+	schemas := map[string]interface{}{
+		"maxclients":          maxClients,
+		"credhub_secret_path": map[string]interface{}{"type": "string"},
+		ManagedSecretKey:      map[string]interface{}{"type": "string"},
+		AcceptDataLossKey:     map[string]interface{}{"type": "boolean"},
+		ForcePlanChangeKey:    map[string]interface{}{"type": "boolean"},
+		MaxMemoryKey:          maxMemory,
+		EvictionTenacityKey:   map[string]interface{}{"type": "integer", "minimum": 0, "maximum": MaxEvictionTenacity},
+		HzKey:                 map[string]interface{}{"type": "integer", "minimum": MinHz, "maximum": MaxHz},
+		DynamicHzKey:          map[string]interface{}{"type": "boolean"},
+		ActiveRehashingKey:    map[string]interface{}{"type": "boolean"},
+		ReplBacklogSizeKey: map[string]interface{}{
+			"type":        []string{"string", "integer"},
+			"pattern":     memorySizePattern,
+			"description": "Replication backlog size in bytes, or with a kb, mb or gb suffix",
+		},
+		ReplTimeoutKey: map[string]interface{}{"type": "integer", "minimum": 1},
+		UnixSocketKey:  map[string]interface{}{"type": "string", "minLength": 1},
+		MaintenanceModeKey: map[string]interface{}{
+			"type":        "boolean",
+			"description": "Only on update: listen on localhost and disable the password",
+		},
+		UnixSocketPermKey: map[string]interface{}{
+			"type":        []string{"string", "integer"},
+			"pattern":     `^\s*0?[0-7]{1,3}\s*$`,
+			"description": "Permissions of the unix socket in octal, such as 700",
+		},
+		RedisLogLevelKey: map[string]interface{}{
+			"type": []string{"string", "null"},
+			"enum": logLevels,
+		},
+		EncodingLimitsKey: map[string]interface{}{
+			"type":                 "object",
+			"properties":           encodingLimits,
+			"additionalProperties": false,
+		},
+	}
+	for _, param := range lazyFreeParams {
+		schemas[param] = map[string]interface{}{"type": "boolean"}
+	}
+	return schemas
+}
+
+func bindingParamSchemas() map[string]interface{} {
+	return map[string]interface{}{
+		BindingRoleKey: map[string]interface{}{
+			"type": "string",
+			"enum": []string{BindingRoleMaster, BindingRoleReplica},
+		},
+	}
+}
+
+// allowedArbitraryParams returns nil when the plan does not restrict the
+// arbitrary parameters.
+func allowedArbitraryParams(planProperties serviceadapter.Properties) (map[string]bool, error) {
+	configuredParams, found := planProperties[AllowedArbitraryParamsPropertyKey]
+	if !found {
+		return nil, nil
+	}
+
+	params, ok := configuredParams.([]interface{})
+	if !ok {
+		return nil, operatorError("invalid value for plan property '%s': must be a list of parameter names", AllowedArbitraryParamsPropertyKey)
+	}
+
+	supportedParams := arbitraryParamSchemas(planProperties)
+	allowed := map[string]bool{}
+	var unsupported []string
+	for _, configuredParam := range params {
+		param, ok := configuredParam.(string)
+		if !ok {
+			return nil, operatorError("invalid value for plan property '%s': must be a list of parameter names", AllowedArbitraryParamsPropertyKey)
+		}
+		if _, supported := supportedParams[param]; !supported {
+			unsupported = append(unsupported, param)
+			continue
+		}
+		allowed[param] = true
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return nil, operatorError("plan property '%s' lists unsupported parameter(s): %s", AllowedArbitraryParamsPropertyKey, strings.Join(unsupported, ", "))
+	}
+	return allowed, nil
+}
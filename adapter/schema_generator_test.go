@@ -0,0 +1,230 @@
+package adapter_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf-experimental/redis-example-service-adapter/adapter"
+	"github.com/pivotal-cf/on-demand-services-sdk/serviceadapter"
+)
+
+var _ = Describe("SchemaGenerator", func() {
+	var (
+		plan       serviceadapter.Plan
+		planSchema serviceadapter.PlanSchema
+		schemaErr  error
+	)
+
+	BeforeEach(func() {
+		plan = serviceadapter.Plan{Properties: serviceadapter.Properties{"persistence": true}}
+	})
+
+	JustBeforeEach(func() {
+		planSchema, schemaErr = adapter.SchemaGenerator{}.GeneratePlanSchema(plan)
+	})
+
+	It("uses the same schema for instance create and update", func() {
+		Expect(schemaErr).NotTo(HaveOccurred())
+		Expect(planSchema.ServiceInstance.Update).To(Equal(planSchema.ServiceInstance.Create))
+		Expect(planSchema.ServiceInstance.Create.Parameters).To(HaveKeyWithValue("$schema", adapter.JSONSchemaVersion))
+	})
+
+	DescribeTable("validating instance parameters",
+		func(payload string, expectedProblems []string) {
+			Expect(schemaErr).NotTo(HaveOccurred())
+			Expect(validateAgainstSchema(planSchema.ServiceInstance.Create.Parameters, payload)).To(Equal(expectedProblems))
+		},
+		Entry("no parameters", `{}`, []string(nil)),
+		Entry("every supported parameter", `{
+			"maxclients": 100,
+			"maxmemory": "512mb",
+			"maxmemory-eviction-tenacity": 10,
+			"hz": 100,
+			"dynamic-hz": true,
+			"activerehashing": false,
+			"lazyfree-lazy-eviction": true,
+			"replica-lazy-flush": false,
+			"encoding_limits": {"hash-max-listpack-entries": 128},
+			"credhub_secret_path": "/some/path",
+			"odb_managed_secret": "some-secret",
+			"accept_data_loss": true,
+			"force_plan_change": true,
+			"repl-backlog-size": "64mb",
+			"repl-timeout": 120,
+			"loglevel": "debug",
+			"unixsocket": "/var/vcap/sys/run/redis/redis.sock",
+			"unixsocketperm": "770"
+		}`, []string(nil)),
+		Entry("a non-octal unixsocketperm", `{"unixsocketperm": "789"}`, []string{"unixsocketperm: does not match pattern"}),
+		Entry("a null loglevel", `{"loglevel": null}`, []string(nil)),
+		Entry("an unknown loglevel", `{"loglevel": "trace"}`, []string{"loglevel: not one of the allowed values"}),
+		Entry("maxmemory in bytes", `{"maxmemory": 1048576}`, []string(nil)),
+		Entry("an unsupported parameter", `{"foo": "bar"}`, []string{"foo: unsupported"}),
+		Entry("a non-integer maxclients", `{"maxclients": "lots"}`, []string{"maxclients: wrong type"}),
+		Entry("hz out of range", `{"hz": 1000}`, []string{"hz: above maximum"}),
+		Entry("eviction tenacity out of range", `{"maxmemory-eviction-tenacity": 101}`, []string{"maxmemory-eviction-tenacity: above maximum"}),
+		Entry("a malformed maxmemory", `{"maxmemory": "1tb"}`, []string{"maxmemory: does not match pattern"}),
+		Entry("a non-boolean lazyfree parameter", `{"lazyfree-lazy-expire": "yes"}`, []string{"lazyfree-lazy-expire: wrong type"}),
+		Entry("an unknown encoding limit", `{"encoding_limits": {"foo-max-entries": 1}}`, []string{"encoding_limits.foo-max-entries: unsupported"}),
+	)
+
+	DescribeTable("validating binding parameters",
+		func(payload string, expectedProblems []string) {
+			Expect(schemaErr).NotTo(HaveOccurred())
+			Expect(validateAgainstSchema(planSchema.ServiceBinding.Create.Parameters, payload)).To(Equal(expectedProblems))
+		},
+		Entry("no parameters", `{}`, []string(nil)),
+		Entry("the replica role", `{"role": "replica"}`, []string(nil)),
+		Entry("an unknown role", `{"role": "sentinel"}`, []string{"role: not one of the allowed values"}),
+		Entry("an unsupported parameter", `{"read_only": true}`, []string{"read_only: unsupported"}),
+	)
+
+	Context("when the plan bounds maxclients", func() {
+		BeforeEach(func() {
+			plan.Properties[adapter.MaxClientsMinPropertyKey] = 100
+			plan.Properties[adapter.MaxClientsMaxPropertyKey] = 2000
+		})
+
+		It("advertises the plan's range", func() {
+			Expect(schemaErr).NotTo(HaveOccurred())
+			schema := planSchema.ServiceInstance.Create.Parameters
+			Expect(validateAgainstSchema(schema, `{"maxclients": 2000}`)).To(BeEmpty())
+			Expect(validateAgainstSchema(schema, `{"maxclients": 50}`)).To(Equal([]string{"maxclients: below minimum"}))
+			Expect(validateAgainstSchema(schema, `{"maxclients": 50000}`)).To(Equal([]string{"maxclients: above maximum"}))
+		})
+	})
+
+	Context("when the plan restricts the arbitrary parameters", func() {
+		BeforeEach(func() {
+			plan.Properties[adapter.AllowedArbitraryParamsPropertyKey] = []interface{}{"maxclients", "hz"}
+		})
+
+		It("accepts maxmemory-eviction-tenacity in the allow-list", func() {
+			plan.Properties[adapter.AllowedArbitraryParamsPropertyKey] = []interface{}{"maxmemory-eviction-tenacity"}
+			schema, err := adapter.SchemaGenerator{}.GeneratePlanSchema(plan)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(validateAgainstSchema(schema.ServiceInstance.Create.Parameters, `{"maxmemory-eviction-tenacity": 10}`)).To(BeEmpty())
+		})
+
+		It("only advertises the allowed parameters", func() {
+			Expect(schemaErr).NotTo(HaveOccurred())
+			schema := planSchema.ServiceInstance.Create.Parameters
+			Expect(validateAgainstSchema(schema, `{"maxclients": 100, "hz": 10}`)).To(BeEmpty())
+			Expect(validateAgainstSchema(schema, `{"maxmemory": "512mb"}`)).To(Equal([]string{"maxmemory: unsupported"}))
+		})
+
+		It("returns an error naming parameters the adapter does not support", func() {
+			plan.Properties[adapter.AllowedArbitraryParamsPropertyKey] = []interface{}{"maxclients", "read_only", "foo"}
+			_, err := adapter.SchemaGenerator{}.GeneratePlanSchema(plan)
+			Expect(err).To(MatchError("plan property 'allowed_arbitrary_params' lists unsupported parameter(s): foo, read_only"))
+		})
+
+		It("returns an error when the allow-list is not a list", func() {
+			plan.Properties[adapter.AllowedArbitraryParamsPropertyKey] = "maxclients"
+			_, err := adapter.SchemaGenerator{}.GeneratePlanSchema(plan)
+			Expect(err).To(MatchError("invalid value for plan property 'allowed_arbitrary_params': must be a list of parameter names"))
+		})
+	})
+})
+
+// validateAgainstSchema checks a JSON payload against the subset of JSON
+// Schema the adapter emits, returning one sorted problem per offending field.
+func validateAgainstSchema(schema map[string]interface{}, payload string) []string {
+	var normalisedSchema map[string]interface{}
+	schemaJSON, err := json.Marshal(schema)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(json.Unmarshal(schemaJSON, &normalisedSchema)).To(Succeed())
+
+	var value interface{}
+	Expect(json.Unmarshal([]byte(payload), &value)).To(Succeed())
+
+	problems := schemaProblems("", normalisedSchema, value)
+	sort.Strings(problems)
+	return problems
+}
+
+func schemaProblems(path string, schema map[string]interface{}, value interface{}) []string {
+	if !matchesSchemaType(schema["type"], value) {
+		return []string{path + ": wrong type"}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			found = found || allowed == value
+		}
+		if !found {
+			return []string{path + ": not one of the allowed values"}
+		}
+	}
+	if maximum, ok := schema["maximum"].(float64); ok && value.(float64) > maximum {
+		return []string{path + ": above maximum"}
+	}
+	if minimum, ok := schema["minimum"].(float64); ok && value.(float64) < minimum {
+		return []string{path + ": below minimum"}
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		if str, isString := value.(string); isString && !regexp.MustCompile(pattern).MatchString(str) {
+			return []string{path + ": does not match pattern"}
+		}
+	}
+
+	object, isObject := value.(map[string]interface{})
+	if !isObject {
+		return nil
+	}
+	var problems []string
+	properties, _ := schema["properties"].(map[string]interface{})
+	for key, propertyValue := range object {
+		propertyPath := key
+		if path != "" {
+			propertyPath = fmt.Sprintf("%s.%s", path, key)
+		}
+		propertySchema, known := properties[key].(map[string]interface{})
+		if !known {
+			if schema["additionalProperties"] == false {
+				problems = append(problems, propertyPath+": unsupported")
+			}
+			continue
+		}
+		problems = append(problems, schemaProblems(propertyPath, propertySchema, propertyValue)...)
+	}
+	return problems
+}
+
+func matchesSchemaType(schemaType interface{}, value interface{}) bool {
+	switch t := schemaType.(type) {
+	case nil:
+		return true
+	case []interface{}:
+		for _, alternative := range t {
+			if matchesSchemaType(alternative, value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch schemaType {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	}
+	return false
+}
@@ -18,19 +18,31 @@ func main() {
 		os.Exit(serviceadapter.ErrorExitCode)
 	}
 
+	adapterConfig, err := adapter.LoadAdapterConfig(stderrLogger)
+	if err != nil {
+		os.Exit(serviceadapter.ErrorExitCode)
+	}
+
 	manifestGenerator := adapter.ManifestGenerator{
-		StderrLogger: stderrLogger,
-		Config:       config,
+		StderrLogger:        stderrLogger,
+		Config:              config,
+		AdapterConfig:       adapterConfig,
+		AllowedVMExtensions: adapterConfig.AllowedVMExtensions,
+		DefaultNetworkName:  adapterConfig.DefaultNetworkName,
 	}
 
+	// The binder reads the operator defaults it depends on, such as the port,
+	// back from the manifest the generator wrote them into.
 	binder := adapter.Binder{
 		StderrLogger: stderrLogger,
 		Config:       config,
 	}
 
 	handler := serviceadapter.CommandLineHandler{
-		ManifestGenerator: manifestGenerator,
-		Binder:            binder,
+		ManifestGenerator:     manifestGenerator,
+		Binder:                binder,
+		DashboardURLGenerator: adapter.DashboardUrlGenerator{},
+		SchemaGenerator:       adapter.SchemaGenerator{},
 	}
 
 	serviceadapter.HandleCLI(os.Args, handler)